@@ -21,12 +21,89 @@ import (
 
 // DataSource represents the actual source of truth path for a secret
 type DataSource struct {
-	// Path to the actual secret
-	Path string `json:"path"`
+	// Path to the actual secret. Optional if the transit ciphertext is set
+	Path string `json:"path,omitempty"`
 	// Key where the actual secret is stored
-	Key string `json:"key"`
+	Key string `json:"key,omitempty"`
 	// Encoding type for the secret. Only base64 supported. Optional
 	Encoding string `json:"encoding,omitempty"`
+	// Name of the backend the secret is read from. Defaults to the SecretDefinition store or backend. Optional
+	Backend string `json:"backend,omitempty"`
+	// Version of the secret, supported by the vault kv2 engine and azure-kv backends. Defaults to the latest one. Optional
+	Version string `json:"version,omitempty"`
+	// Type of the object read, supported by the azure-kv backend. Certificates are read as their PEM certificate chain,
+	// PEM private key or base64 PFX file with the certificate, privateKey or pfx keys, and keys as their PEM public key
+	// or JWK with the publicKey or jwk keys. Defaults to secret. Optional
+	// +kubebuilder:validation:Enum=secret;certificate;key
+	ObjectType string `json:"objectType,omitempty"`
+	// Sources tried in order when the secret can't be read from the backend. Optional
+	Fallbacks []FallbackSource `json:"fallbacks,omitempty"`
+	// Decrypts the secret, or the ciphertext set inline, with the Vault transit engine. Optional
+	Transit *TransitDecryption `json:"transit,omitempty"`
+	// Vault Enterprise namespace the secret is read from. Defaults to the backend namespace. Optional
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+}
+
+// TransitDecryption decrypts a ciphertext with a key of the Vault transit engine
+type TransitDecryption struct {
+	// Name of the backend decrypting the ciphertext. Defaults to the DataSource backend. Optional
+	Backend string `json:"backend,omitempty"`
+	// Path the transit engine is mounted at. Defaults to transit. Optional
+	Mount string `json:"mount,omitempty"`
+	// Name of the transit key the ciphertext was encrypted with
+	Key string `json:"key"`
+	// Ciphertext to decrypt, like vault:v1:... The secret at the DataSource path is decrypted if empty. Optional
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+// FallbackSource is an alternative source of truth for a secret, used when it can't be read from the previous ones
+type FallbackSource struct {
+	// Name of the backend the secret is read from. Defaults to the backend selected with --backend. Optional
+	Backend string `json:"backend,omitempty"`
+	// Store the secret is read from. Takes precedence over backend. Optional
+	StoreRef *StoreReference `json:"storeRef,omitempty"`
+	// Path to the secret in this source. Defaults to the DataSource path. Optional
+	Path string `json:"path,omitempty"`
+	// Key where the secret is stored in this source. Defaults to the DataSource key. Optional
+	Key string `json:"key,omitempty"`
+	// Version of the secret in this source. Not inherited from the DataSource, as versions are backend specific. Optional
+	Version string `json:"version,omitempty"`
+	// Type of the object read from this source. Not inherited from the DataSource, as object types are backend specific. Optional
+	// +kubebuilder:validation:Enum=secret;certificate;key
+	ObjectType string `json:"objectType,omitempty"`
+	// Vault Enterprise namespace the secret is read from. Not inherited from the DataSource. Optional
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+}
+
+// StoreReference selects the SecretStore or ClusterSecretStore secrets are read from
+type StoreReference struct {
+	// Kind of the store. Defaults to SecretStore
+	// +kubebuilder:validation:Enum=SecretStore;ClusterSecretStore
+	Kind string `json:"kind,omitempty"`
+	// Name of the store. SecretStores are looked up in the SecretDefinition namespace
+	Name string `json:"name"`
+}
+
+// PKICertificate describes a TLS certificate issued by the Vault PKI secrets engine
+type PKICertificate struct {
+	// Name of the backend issuing the certificate. Defaults to the SecretDefinition store or backend. Optional
+	Backend string `json:"backend,omitempty"`
+	// Path the PKI secrets engine is mounted at. Defaults to pki. Optional
+	Mount string `json:"mount,omitempty"`
+	// Role the certificate is issued with
+	Role string `json:"role"`
+	// Common name of the certificate
+	CommonName string `json:"commonName"`
+	// DNS and email subject alternative names. Optional
+	AltNames []string `json:"altNames,omitempty"`
+	// IP subject alternative names. Optional
+	IPSANs []string `json:"ipSans,omitempty"`
+	// Lifetime of the certificate, capped by the role max TTL. Defaults to the role TTL. Optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// Percentage of the certificate lifetime after which it is renewed. Defaults to 66. Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	RenewPercentage int32 `json:"renewPercentage,omitempty"`
 }
 
 // SecretDefinitionSpec defines the desired state of SecretDefinition
@@ -35,16 +112,25 @@ type SecretDefinitionSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Name    string                `json:"name"`
 	Type    string                `json:"type,omitempty"`
-	KeysMap map[string]DataSource `json:"keysMap"`
+	KeysMap map[string]DataSource `json:"keysMap,omitempty"`
+	// Name of the backend the secrets are read from. Defaults to the backend selected with --backend. Optional
+	Backend string `json:"backend,omitempty"`
+	// Store the secrets are read from. Takes precedence over backend. Optional
+	StoreRef *StoreReference `json:"storeRef,omitempty"`
+	// TLS certificate issued into the tls.crt, tls.key and ca.crt keys. Optional
+	PKI *PKICertificate `json:"pki,omitempty"`
 }
 
 // SecretDefinitionStatus defines the observed state of SecretDefinition
 type SecretDefinitionStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	// IDs of the leases issued for the dynamic secrets of the Secret. Only these leases are renewed and revoked. Optional
+	IssuedLeases []string `json:"issuedLeases,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 
 // SecretDefinition is the Schema for the secretdefinitions API
 type SecretDefinition struct {
@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SecretStoreKind is the kind of the namespaced stores
+	SecretStoreKind = "SecretStore"
+	// ClusterSecretStoreKind is the kind of the cluster scoped stores
+	ClusterSecretStoreKind = "ClusterSecretStore"
+	// SecretStoreReady is the condition reporting whether the store backend can be used
+	SecretStoreReady = "Ready"
+)
+
+// SecretKeyReference selects a key of a Secret
+type SecretKeyReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+	// Namespace of the Secret. Required by ClusterSecretStores, SecretStores always read Secrets from their own namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the Secret data holding the value
+	Key string `json:"key"`
+}
+
+// SecretStoreSpec defines the backend a store connects to
+type SecretStoreSpec struct {
+	// Backend type. One of vault, azure-kv, aws-sm, aws-ssm, gcp-sm, kubernetes, file, consul, conjur, onepassword, sops or bitwarden
+	Backend string `json:"backend"`
+	// Backend configuration keyed by flag name, like vault.url. Flags not set take their default value. Optional
+	Config map[string]string `json:"config,omitempty"`
+	// Backend configuration read from Secrets keyed by flag name, like vault.secret-id. Optional
+	ConfigFrom map[string]SecretKeyReference `json:"configFrom,omitempty"`
+}
+
+// SecretStoreStatus defines the observed state of a store
+type SecretStoreStatus struct {
+	// Conditions of the store. Ready reports whether the backend could be reached with the store configuration
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.spec.backend`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// SecretStore is the Schema for the secretstores API
+type SecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecretStoreSpec   `json:"spec,omitempty"`
+	Status SecretStoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretStoreList contains a list of SecretStore
+type SecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretStore `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.spec.backend`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterSecretStore is the Schema for the clustersecretstores API
+type ClusterSecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecretStoreSpec   `json:"spec,omitempty"`
+	Status SecretStoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterSecretStoreList contains a list of ClusterSecretStore
+type ClusterSecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecretStore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretStore{}, &SecretStoreList{}, &ClusterSecretStore{}, &ClusterSecretStoreList{})
+}
@@ -0,0 +1,91 @@
+package v1alpha1
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("SecretStore", func() {
+
+	Context("Create API", func() {
+
+		It("should create a SecretStore successfully", func() {
+
+			key := types.NamespacedName{
+				Name:      "vault",
+				Namespace: "default",
+			}
+			created := &SecretStore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "vault",
+					Namespace: "default",
+				},
+				Spec: SecretStoreSpec{
+					Backend: "vault",
+					Config: map[string]string{
+						"vault.url": "https://vault.example.com:8200",
+					},
+					ConfigFrom: map[string]SecretKeyReference{
+						"vault.secret-id": {Name: "vault-approle", Key: "secret_id"},
+					},
+				},
+			}
+
+			By("creating an API obj")
+			Expect(k8sClient.Create(context.TODO(), created)).To(Succeed())
+
+			fetched := &SecretStore{}
+			Expect(k8sClient.Get(context.TODO(), key, fetched)).To(Succeed())
+			Expect(fetched).To(Equal(created))
+
+			By("deleting the created object")
+			Expect(k8sClient.Delete(context.TODO(), created)).To(Succeed())
+			Expect(k8sClient.Get(context.TODO(), key, created)).ToNot(Succeed())
+		})
+
+		It("should create a ClusterSecretStore successfully", func() {
+
+			key := types.NamespacedName{
+				Name: "vault",
+			}
+			created := &ClusterSecretStore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "vault",
+				},
+				Spec: SecretStoreSpec{
+					Backend: "vault",
+				},
+			}
+
+			By("creating an API obj")
+			Expect(k8sClient.Create(context.TODO(), created)).To(Succeed())
+
+			fetched := &ClusterSecretStore{}
+			Expect(k8sClient.Get(context.TODO(), key, fetched)).To(Succeed())
+			Expect(fetched).To(Equal(created))
+
+			By("deleting the created object")
+			Expect(k8sClient.Delete(context.TODO(), created)).To(Succeed())
+			Expect(k8sClient.Get(context.TODO(), key, created)).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/go-logr/logr"
+)
+
+const (
+	awsStaticAuthMethod          = "static"
+	awsWebIdentityAuthMethod     = "web-identity"
+	awsInstanceProfileAuthMethod = "instance-profile"
+	awsDefaultRoleSessionName    = "secrets-manager"
+	awsAccessDeniedErrorCode     = "AccessDeniedException"
+)
+
+// awsConfig holds the settings shared by every AWS based backend
+type awsConfig struct {
+	region               string
+	endpoint             string
+	authMethod           string
+	accessKeyID          string
+	secretAccessKey      string
+	roleARN              string
+	webIdentityTokenFile string
+	timeout              time.Duration
+}
+
+// newAWSSession builds an AWS session using the selected authentication method.
+// An empty authentication method lets the SDK default credentials chain decide.
+func newAWSSession(logger logr.Logger, cfg awsConfig) (*session.Session, error) {
+	awsCfg := aws.NewConfig().WithRegion(cfg.region)
+	if cfg.endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.endpoint)
+	}
+	if cfg.timeout > 0 {
+		awsCfg = awsCfg.WithHTTPClient(&http.Client{Timeout: cfg.timeout})
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds *credentials.Credentials
+	switch cfg.authMethod {
+	case awsStaticAuthMethod:
+		logger.Info("AWS static credentials will be used as authentication method")
+		creds = credentials.NewStaticCredentials(cfg.accessKeyID, cfg.secretAccessKey, "")
+	case awsWebIdentityAuthMethod:
+		logger.Info("AWS web identity will be used as authentication method", "aws_role_arn", cfg.roleARN)
+		creds = stscreds.NewWebIdentityCredentials(sess, cfg.roleARN, awsDefaultRoleSessionName, cfg.webIdentityTokenFile)
+	case awsInstanceProfileAuthMethod:
+		logger.Info("AWS instance profile will be used as authentication method")
+		creds = ec2rolecreds.NewCredentials(sess)
+	case "":
+		logger.Info("AWS default credentials chain will be used as authentication method")
+		return sess, nil
+	default:
+		return nil, fmt.Errorf("unsupported AWS authentication method %s", cfg.authMethod)
+	}
+
+	return sess.Copy(aws.NewConfig().WithCredentials(creds)), nil
+}
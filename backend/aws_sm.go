@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	goerrors "errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+type awsSecretsManagerClient struct {
+	client  secretsmanageriface.SecretsManagerAPI
+	metrics *awsSecretsManagerMetrics
+	context context.Context
+	logger  logr.Logger
+}
+
+func awsSecretsManagerBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*awsSecretsManagerClient, error) {
+	logger := l.WithName("aws-sm").WithValues(
+		"aws_region", cfg.AWSSMRegion,
+		"aws_auth_method", cfg.AWSSMAuthMethod)
+
+	metrics := newAWSSecretsManagerMetrics(cfg.AWSSMRegion)
+
+	sess, err := newAWSSession(logger, awsConfig{
+		region:               cfg.AWSSMRegion,
+		endpoint:             cfg.AWSSMEndpoint,
+		authMethod:           cfg.AWSSMAuthMethod,
+		accessKeyID:          cfg.AWSSMAccessKeyID,
+		secretAccessKey:      cfg.AWSSMSecretAccessKey,
+		roleARN:              cfg.AWSSMRoleARN,
+		webIdentityTokenFile: cfg.AWSSMWebIdentityTokenFile,
+		timeout:              cfg.BackendTimeout,
+	})
+	if err != nil {
+		logger.Error(err, "Error while creating AWS session")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	if _, err = sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		logger.Error(err, "Error while retrieving AWS credentials")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully logged into AWS Secrets Manager")
+
+	client := awsSecretsManagerClient{
+		client:  secretsmanager.New(sess),
+		metrics: metrics,
+		context: ctx,
+		logger:  logger,
+	}
+
+	return &client, nil
+}
+
+// ReadSecret reads the secret named path (name or ARN). If key is set, the secret
+// string is expected to be a JSON object and the value of that field is returned.
+func (c *awsSecretsManagerClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	result, err := c.client.GetSecretValueWithContext(c.context, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(path),
+	})
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		var awsError awserr.Error
+		if goerrors.As(err, &awsError) {
+			switch awsError.Code() {
+			case secretsmanager.ErrCodeResourceNotFoundException:
+				errorType = errors.BackendSecretNotFoundErrorType
+				err = &errors.BackendSecretNotFoundError{ErrType: errorType, Path: path, Key: key}
+			case awsAccessDeniedErrorCode:
+				errorType = errors.BackendSecretForbiddenErrorType
+				err = &errors.BackendSecretForbiddenError{ErrType: errorType, Path: path, Key: key}
+			}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return data, err
+	}
+
+	if result.SecretString != nil {
+		data = *result.SecretString
+	} else {
+		data = base64.StdEncoding.EncodeToString(result.SecretBinary)
+	}
+
+	if key == "" {
+		return data, nil
+	}
+
+	data, err = getJSONField(path, key, data)
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
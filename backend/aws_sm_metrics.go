@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	awsSMLabelNames            = []string{"aws_region"}
+	awsSMSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "aws_sm",
+		Name:      "read_secret_errors_total",
+		Help:      "AWS Secrets Manager read operations counter",
+	}, append(awsSMLabelNames, secretLabelNames...))
+	awsSMLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "aws_sm",
+		Name:      "login_errors_total",
+		Help:      "AWS Secrets Manager login errors counter",
+	}, awsSMLabelNames)
+)
+
+type awsSecretsManagerMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(awsSMSecretReadErrorsTotal)
+	r.MustRegister(awsSMLoginErrorsTotal)
+}
+
+func newAWSSecretsManagerMetrics(region string) *awsSecretsManagerMetrics {
+	labels := make(map[string]string, len(awsSMLabelNames))
+	labels["aws_region"] = region
+
+	return &awsSecretsManagerMetrics{labels: labels}
+}
+
+func (m *awsSecretsManagerMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	awsSMSecretReadErrorsTotal.WithLabelValues(
+		m.labels["aws_region"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *awsSecretsManagerMetrics) updateLoginErrorsTotalMetric() {
+	awsSMLoginErrorsTotal.WithLabelValues(
+		m.labels["aws_region"],
+	).Inc()
+}
@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+func TestAWSSecretsManagerUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newAWSSecretsManagerMetrics(fakeAWSRegion)
+	awsSMLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := awsSMLoginErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestAWSSecretsManagerUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "path/to/secret"
+	key := "key"
+
+	metrics := newAWSSecretsManagerMetrics(fakeAWSRegion)
+	awsSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := awsSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	awsSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+	metricSecretReadErrorsTotal, _ = awsSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, path, key, errors.BackendSecretForbiddenErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+type awsParameterStoreClient struct {
+	client  ssmiface.SSMAPI
+	metrics *awsParameterStoreMetrics
+	context context.Context
+	logger  logr.Logger
+}
+
+func awsParameterStoreBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*awsParameterStoreClient, error) {
+	logger := l.WithName("aws-ssm").WithValues(
+		"aws_region", cfg.AWSSSMRegion,
+		"aws_auth_method", cfg.AWSSSMAuthMethod)
+
+	metrics := newAWSParameterStoreMetrics(cfg.AWSSSMRegion)
+
+	sess, err := newAWSSession(logger, awsConfig{
+		region:               cfg.AWSSSMRegion,
+		endpoint:             cfg.AWSSSMEndpoint,
+		authMethod:           cfg.AWSSSMAuthMethod,
+		accessKeyID:          cfg.AWSSSMAccessKeyID,
+		secretAccessKey:      cfg.AWSSSMSecretAccessKey,
+		roleARN:              cfg.AWSSSMRoleARN,
+		webIdentityTokenFile: cfg.AWSSSMWebIdentityTokenFile,
+		timeout:              cfg.BackendTimeout,
+	})
+	if err != nil {
+		logger.Error(err, "Error while creating AWS session")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	if _, err = sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		logger.Error(err, "Error while retrieving AWS credentials")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully logged into AWS SSM Parameter Store")
+
+	client := awsParameterStoreClient{
+		client:  ssm.New(sess),
+		metrics: metrics,
+		context: ctx,
+		logger:  logger,
+	}
+
+	return &client, nil
+}
+
+// ReadSecret reads the parameter named path, decrypting SecureString values.
+// If key is set, path is handled as a hierarchy prefix and the parameter
+// path/key is read instead. A path ending in / with an empty key reads all the
+// parameters under that hierarchy, as a JSON object keyed by their name relative to it.
+func (c *awsParameterStoreClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	if key == "" && strings.HasSuffix(path, "/") {
+		return c.readHierarchy(path)
+	}
+
+	name := path
+	if key != "" {
+		name = strings.TrimSuffix(path, "/") + "/" + strings.TrimPrefix(key, "/")
+	}
+
+	result, err := c.client.GetParameterWithContext(c.context, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return data, c.readError(err, path, key)
+	}
+
+	data = aws.StringValue(result.Parameter.Value)
+	return data, nil
+}
+
+// readHierarchy reads all the parameters under the path hierarchy, recursively
+func (c *awsParameterStoreClient) readHierarchy(path string) (string, error) {
+	parameters := make(map[string]string)
+	err := c.client.GetParametersByPathPagesWithContext(c.context, &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, parameter := range page.Parameters {
+			parameters[strings.TrimPrefix(aws.StringValue(parameter.Name), path)] = aws.StringValue(parameter.Value)
+		}
+		return true
+	})
+	if err != nil {
+		return "", c.readError(err, path, "")
+	}
+	if len(parameters) == 0 {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, "", errors.BackendSecretNotFoundErrorType)
+		return "", &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path}
+	}
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readError returns the error reading the parameter at path and key, updating the read errors metric
+func (c *awsParameterStoreClient) readError(err error, path string, key string) error {
+	errorType := errors.UnknownErrorType
+	var awsError awserr.Error
+	if goerrors.As(err, &awsError) {
+		switch awsError.Code() {
+		case ssm.ErrCodeParameterNotFound, ssm.ErrCodeParameterVersionNotFound:
+			errorType = errors.BackendSecretNotFoundErrorType
+			err = &errors.BackendSecretNotFoundError{ErrType: errorType, Path: path, Key: key}
+		case awsAccessDeniedErrorCode:
+			errorType = errors.BackendSecretForbiddenErrorType
+			err = &errors.BackendSecretForbiddenError{ErrType: errorType, Path: path, Key: key}
+		}
+	}
+	c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+	return err
+}
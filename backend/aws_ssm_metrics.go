@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	awsSSMLabelNames            = []string{"aws_region"}
+	awsSSMSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "aws_ssm",
+		Name:      "read_secret_errors_total",
+		Help:      "AWS SSM Parameter Store read operations counter",
+	}, append(awsSSMLabelNames, secretLabelNames...))
+	awsSSMLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "aws_ssm",
+		Name:      "login_errors_total",
+		Help:      "AWS SSM Parameter Store login errors counter",
+	}, awsSSMLabelNames)
+)
+
+type awsParameterStoreMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(awsSSMSecretReadErrorsTotal)
+	r.MustRegister(awsSSMLoginErrorsTotal)
+}
+
+func newAWSParameterStoreMetrics(region string) *awsParameterStoreMetrics {
+	labels := make(map[string]string, len(awsSSMLabelNames))
+	labels["aws_region"] = region
+
+	return &awsParameterStoreMetrics{labels: labels}
+}
+
+func (m *awsParameterStoreMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	awsSSMSecretReadErrorsTotal.WithLabelValues(
+		m.labels["aws_region"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *awsParameterStoreMetrics) updateLoginErrorsTotalMetric() {
+	awsSSMLoginErrorsTotal.WithLabelValues(
+		m.labels["aws_region"],
+	).Inc()
+}
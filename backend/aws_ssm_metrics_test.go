@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+func TestAWSParameterStoreUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newAWSParameterStoreMetrics(fakeAWSRegion)
+	awsSSMLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := awsSSMLoginErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestAWSParameterStoreUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "/path/to"
+	key := "parameter"
+
+	metrics := newAWSParameterStoreMetrics(fakeAWSRegion)
+	awsSSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := awsSSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	awsSSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+	metricSecretReadErrorsTotal, _ = awsSSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, path, key, errors.BackendSecretForbiddenErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
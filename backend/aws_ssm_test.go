@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+var awsSSMParameters = map[string]struct {
+	value      string
+	secure     bool
+	ciphertext string
+	access     bool
+}{
+	"/prod/app/url":         {value: "https://example.com", access: true},
+	"/prod/app/db/password": {value: "s3cr3t", secure: true, ciphertext: "AQICAHhZ8HNG...", access: true},
+	"/prod/app/forbidden":   {value: "yes", access: false},
+}
+
+func awsSSMGetParameter(w http.ResponseWriter, r *http.Request) {
+	// Info about the SSM JSON protocol extracted from
+	// https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_GetParameter.html
+	var input struct {
+		Name           string `json:"Name"`
+		WithDecryption bool   `json:"WithDecryption"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		awsWriteError(w, "ValidationException", err.Error())
+		return
+	}
+	v, ok := awsSSMParameters[input.Name]
+	if !ok {
+		awsWriteError(w, ssm.ErrCodeParameterNotFound, "")
+		return
+	}
+	if !v.access {
+		awsWriteError(w, awsAccessDeniedErrorCode, fmt.Sprintf("not authorized to perform: ssm:GetParameter on resource: %s", input.Name))
+		return
+	}
+	parameterType := "String"
+	value := v.value
+	if v.secure {
+		parameterType = "SecureString"
+		if !input.WithDecryption {
+			value = v.ciphertext
+		}
+	}
+	response := map[string]interface{}{
+		"Parameter": map[string]interface{}{
+			"ARN":      fmt.Sprintf("arn:aws:ssm:%s:123456789012:parameter%s", fakeAWSRegion, input.Name),
+			"Name":     input.Name,
+			"Type":     parameterType,
+			"Value":    value,
+			"Version":  1,
+			"DataType": "text",
+		},
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(response)
+}
+
+func awsSSMGetParametersByPath(w http.ResponseWriter, r *http.Request) {
+	// Info about the SSM JSON protocol extracted from
+	// https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_GetParametersByPath.html
+	var input struct {
+		Path           string `json:"Path"`
+		Recursive      bool   `json:"Recursive"`
+		WithDecryption bool   `json:"WithDecryption"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		awsWriteError(w, "ValidationException", err.Error())
+		return
+	}
+	if input.Path == "/forbidden/" {
+		awsWriteError(w, awsAccessDeniedErrorCode, fmt.Sprintf("not authorized to perform: ssm:GetParametersByPath on resource: %s", input.Path))
+		return
+	}
+	parameters := []map[string]interface{}{}
+	for name, v := range awsSSMParameters {
+		relative := strings.TrimPrefix(name, input.Path)
+		if !v.access || relative == name || (!input.Recursive && strings.Contains(relative, "/")) {
+			continue
+		}
+		value := v.value
+		if v.secure && !input.WithDecryption {
+			value = v.ciphertext
+		}
+		parameters = append(parameters, map[string]interface{}{"Name": name, "Value": value, "Version": 1})
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Parameters": parameters})
+}
+
+func TestAWSParameterStoreBackendClient(t *testing.T) {
+	cfg := Config{AWSSSMRegion: fakeAWSRegion, AWSSSMAuthMethod: "foo"}
+	client, err := awsParameterStoreBackendClient(context.TODO(), logger, cfg)
+	assert.NotNilf(t, err, "Unknown authentication method should generate an error")
+	assert.Nilf(t, client, "Unknown authentication method should not generate any client")
+
+	cfg = Config{
+		AWSSSMRegion:          fakeAWSRegion,
+		AWSSSMEndpoint:        testingCfg.VaultURL,
+		AWSSSMAuthMethod:      awsStaticAuthMethod,
+		AWSSSMAccessKeyID:     fakeAWSAccessKeyID,
+		AWSSSMSecretAccessKey: fakeAWSSecretAccessKey,
+	}
+	client, err = awsParameterStoreBackendClient(context.TODO(), logger, cfg)
+	assert.Nilf(t, err, "Static credentials should not generate error")
+	assert.NotNilf(t, client, "Static credentials should generate a client")
+}
+
+func TestAWSParameterStoreClientReadSecret(t *testing.T) {
+	client := awsParameterStoreClient{
+		client:  ssm.New(newFakeAWSSession()),
+		metrics: newAWSParameterStoreMetrics(fakeAWSRegion),
+		context: context.TODO(),
+		logger:  logger,
+	}
+
+	value, err := client.ReadSecret("/prod/app/url", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", value)
+
+	value, err = client.ReadSecret("/prod/app/db/password", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("/prod/app/", "db/password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("/prod/app/", "")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"db/password":"s3cr3t","url":"https://example.com"}`, value)
+
+	awsSSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("/dev/app/", "")
+	metricSecretReadErrorsTotal, _ := awsSSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, "/dev/app/", "", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	value, err = client.ReadSecret("/forbidden/", "")
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+
+	awsSSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("/prod/app", "not-found")
+	metricSecretReadErrorsTotal, _ = awsSSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, "/prod/app", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	awsSSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("/prod/app/forbidden", "")
+	metricSecretReadErrorsTotal, _ = awsSSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeAWSRegion, "/prod/app/forbidden", "", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -4,70 +4,113 @@ import (
 	"context"
 	goerrors "errors"
 	"fmt"
+	"io/ioutil"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azsecrets"
 	"github.com/go-logr/logr"
 	"github.com/tuenti/secrets-manager/errors"
 )
 
-var akvMetrics *azureKVMetrics
-
 const (
-	azureKVEndpoint = "vault.azure.net"
+	azureKVEndpoint                  = "vault.azure.net"
+	azureManagedIdentityAuthMethod   = "managed-identity"
+	azureClientSecretAuthMethod      = "client-secret"
+	azureClientCertificateAuthMethod = "client-certificate"
+	azureWorkloadIdentityAuthMethod  = "workload-identity"
 )
 
 type azureKVClient struct {
 	client       *azsecrets.Client
+	keys         runtime.Pipeline
+	vaultURL     string
 	keyvaultName string
+	metrics      *azureKVMetrics
 	context      context.Context
 	logger       logr.Logger
 }
 
-// getAzureCredential finds the better way to authenticate to Azure
-func getAzureCredential(ctx context.Context, logger logr.Logger, cfg Config) (azcore.TokenCredential, error) {
-	if cfg.AzureKVManagedClientID != "" || cfg.AzureKVManagedResourceID != "" {
-		opts := azidentity.ManagedIdentityCredentialOptions{}
-		if cfg.AzureKVManagedClientID != "" {
-			opts.ID = azidentity.ClientID(cfg.AzureKVManagedClientID)
-		} else if cfg.AzureKVManagedResourceID != "" {
-			opts.ID = azidentity.ResourceID(cfg.AzureKVManagedResourceID)
-		}
-
-		managed, err := azidentity.NewManagedIdentityCredential(&opts)
-		if err == nil {
-			logger.Info("Azure Managed Identity will be used as authentication method")
-			return managed, err
-		}
+// azureManagedIdentityOptions returns the options selecting the configured managed identity,
+// the system assigned one if no ID is set
+func azureManagedIdentityOptions(cfg Config) *azidentity.ManagedIdentityCredentialOptions {
+	opts := azidentity.ManagedIdentityCredentialOptions{}
+	if cfg.AzureKVManagedClientID != "" {
+		opts.ID = azidentity.ClientID(cfg.AzureKVManagedClientID)
+	} else if cfg.AzureKVManagedResourceID != "" {
+		opts.ID = azidentity.ResourceID(cfg.AzureKVManagedResourceID)
 	}
+	return &opts
+}
 
-	spSecret, err := azidentity.NewClientSecretCredential(cfg.AzureKVTenantID, cfg.AzureKVClientID, cfg.AzureKVClientSecret, nil)
-	if err == nil {
+// getAzureCredential builds the credential of the selected authentication method. An empty
+// authentication method, which is deprecated, is the client secret one.
+func getAzureCredential(ctx context.Context, logger logr.Logger, cfg Config) (azcore.TokenCredential, error) {
+	authMethod := cfg.AzureKVAuthMethod
+	if authMethod == "" {
+		logger.Info("Deprecated empty azure-kv.auth-method, client-secret will be used. Set it explicitly")
+		authMethod = azureClientSecretAuthMethod
+	}
+	switch authMethod {
+	case azureManagedIdentityAuthMethod:
+		logger.Info("Azure Managed Identity will be used as authentication method")
+		managed, err := azidentity.NewManagedIdentityCredential(azureManagedIdentityOptions(cfg))
+		if err != nil {
+			return nil, err
+		}
+		return managed, nil
+	case azureClientSecretAuthMethod:
 		logger.Info("Azure Service Principal will be used as authentication method")
-		return spSecret, err
+		opts := azidentity.ClientSecretCredentialOptions{AuthorityHost: azidentity.AuthorityHost(cfg.AzureKVAuthorityHost)}
+		spSecret, err := azidentity.NewClientSecretCredential(cfg.AzureKVTenantID, cfg.AzureKVClientID, cfg.AzureKVClientSecret, &opts)
+		if err != nil {
+			return nil, err
+		}
+		return spSecret, nil
+	case azureClientCertificateAuthMethod:
+		logger.Info("Azure Service Principal certificate will be used as authentication method", "azure_client_certificate_file", cfg.AzureKVClientCertificateFile)
+		certData, err := ioutil.ReadFile(cfg.AzureKVClientCertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		certs, key, err := azidentity.ParseCertificates(certData, []byte(cfg.AzureKVClientCertificatePassword))
+		if err != nil {
+			return nil, err
+		}
+		opts := azidentity.ClientCertificateCredentialOptions{AuthorityHost: azidentity.AuthorityHost(cfg.AzureKVAuthorityHost)}
+		spCert, err := azidentity.NewClientCertificateCredential(cfg.AzureKVTenantID, cfg.AzureKVClientID, certs, key, &opts)
+		if err != nil {
+			return nil, err
+		}
+		return spCert, nil
+	case azureWorkloadIdentityAuthMethod:
+		logger.Info("Azure Workload Identity will be used as authentication method", "azure_federated_token_file", cfg.AzureKVFederatedTokenFile)
+		return newAzureWorkloadIdentityCredential(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported Azure authentication method %s", cfg.AzureKVAuthMethod)
 	}
-
-	return nil, goerrors.New("Unable to authenticate to Azure API using any method")
 }
 
 func azureKeyVaultClient(ctx context.Context, l logr.Logger, cfg Config) (*azureKVClient, error) {
 	logger := l.WithName("azure-kv").WithValues(
 		"azure_kv_name", cfg.AzureKVName,
-		"azure_kv_tenant", cfg.AzureKVTenantID)
+		"azure_kv_tenant", cfg.AzureKVTenantID,
+		"azure_kv_auth_method", cfg.AzureKVAuthMethod)
 
 	cred, err := getAzureCredential(ctx, logger, cfg)
 	if err != nil {
 		logger.Error(err, "Error while authenticating to Azure")
 		return nil, err
 	}
-	akvMetrics = newAzureKVMetrics(cfg.AzureKVName, cfg.AzureKVTenantID)
+	metrics := newAzureKVMetrics(cfg.AzureKVName, cfg.AzureKVTenantID)
 	vaultEndpoint := fmt.Sprintf("https://%s.%s", cfg.AzureKVName, azureKVEndpoint)
 	akvClient, err := azsecrets.NewClient(vaultEndpoint, cred, nil)
 
 	if err != nil {
 		logger.Error(err, "Error while creating Azure KV client")
-		akvMetrics.updateLoginErrorsTotalMetric()
+		metrics.updateLoginErrorsTotalMetric()
 		return nil, err
 	}
 
@@ -75,7 +118,10 @@ func azureKeyVaultClient(ctx context.Context, l logr.Logger, cfg Config) (*azure
 
 	client := azureKVClient{
 		client:       akvClient,
+		keys:         newAzureKVKeysPipeline(cred),
+		vaultURL:     vaultEndpoint,
 		keyvaultName: cfg.AzureKVName,
+		metrics:      metrics,
 		context:      ctx,
 		logger:       logger,
 	}
@@ -84,26 +130,47 @@ func azureKeyVaultClient(ctx context.Context, l logr.Logger, cfg Config) (*azure
 }
 
 func (c *azureKVClient) ReadSecret(path string, key string) (string, error) {
-	data := ""
+	data, _, err := c.ReadSecretVersion(path, key, "")
+	return data, err
+}
 
-	// TODO: Add support for secret version?
-	result, err := c.client.GetSecret(c.context, path, nil)
+// ReadSecretVersion reads the given version of the secret named path, or the latest one if version is empty
+func (c *azureKVClient) ReadSecretVersion(path string, key string, version string) (string, string, error) {
+	result, readVersion, err := c.getSecret(path, version)
+	if err != nil {
+		return "", "", err
+	}
+	return *result.Value, readVersion, nil
+}
 
+// getSecret gets the given version of the secret named path, or the latest one if version is empty,
+// and returns the version read
+func (c *azureKVClient) getSecret(path string, version string) (azsecrets.GetSecretResponse, string, error) {
+	result, err := c.client.GetSecret(c.context, path, &azsecrets.GetSecretOptions{Version: version})
 	if err != nil {
-		errorType := errors.UnknownErrorType
-		var responseError *azcore.ResponseError
-		if goerrors.As(err, &responseError) {
-			if responseError.StatusCode == 404 {
-				errorType = errors.BackendSecretNotFoundErrorType
-			}
-			if responseError.StatusCode == 403 {
-				errorType = errors.BackendSecretForbiddenErrorType
-			}
-		}
-		akvMetrics.updateSecretReadErrorsTotalMetric(path, errorType)
-		return data, err
+		c.updateReadErrorsMetric(path, err)
+		return result, "", err
 	}
 
-	data = *result.Value
-	return data, err
+	// The secret ID is https://<keyvault>.vault.azure.net/secrets/<name>/<version>
+	readVersion := version
+	if result.ID != nil {
+		readVersion = (*result.ID)[strings.LastIndex(*result.ID, "/")+1:]
+	}
+	return result, readVersion, nil
+}
+
+// updateReadErrorsMetric counts the error returned by the KeyVault API when reading path, by its type
+func (c *azureKVClient) updateReadErrorsMetric(path string, err error) {
+	errorType := errors.UnknownErrorType
+	var responseError *azcore.ResponseError
+	if goerrors.As(err, &responseError) {
+		if responseError.StatusCode == 404 {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		if responseError.StatusCode == 403 {
+			errorType = errors.BackendSecretForbiddenErrorType
+		}
+	}
+	c.metrics.updateSecretReadErrorsTotalMetric(path, errorType)
 }
@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Keys selecting the format Azure KeyVault certificates and keys are read in
+const (
+	azureKVCertificateKey = "certificate"
+	azureKVPrivateKeyKey  = "privateKey"
+	azureKVPFXKey         = "pfx"
+	azureKVPublicKeyKey   = "publicKey"
+	azureKVJWKKey         = "jwk"
+)
+
+const (
+	azureKVKeysAPIVersion    = "7.2"
+	azureKVPKCS12ContentType = "application/x-pkcs12"
+)
+
+// azureJSONWebKey is the public part of a KeyVault key, as returned by the keys API
+type azureJSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newAzureKVKeysPipeline returns the pipeline used to call the KeyVault keys API, authenticated with cred
+func newAzureKVKeysPipeline(cred azcore.TokenCredential) runtime.Pipeline {
+	scope := fmt.Sprintf("https://%s/.default", azureKVEndpoint)
+	return runtime.NewPipeline("secrets-manager", "", runtime.PipelineOptions{
+		PerRetry: []policy.Policy{runtime.NewBearerTokenPolicy(cred, []string{scope}, nil)},
+	}, nil)
+}
+
+// ReadObjectVersion reads the given version of a KeyVault secret, certificate or key, or the latest one if
+// version is empty. Certificates are read as their PEM certificate chain, PEM private key or base64 PFX
+// file, and keys as their PEM public key or JWK.
+func (c *azureKVClient) ReadObjectVersion(objectType string, path string, key string, version string) (string, string, error) {
+	switch objectType {
+	case "", SecretObjectType:
+		return c.ReadSecretVersion(path, key, version)
+	case CertificateObjectType:
+		return c.readCertificate(path, key, version)
+	case KeyObjectType:
+		return c.readKey(path, key, version)
+	default:
+		return "", "", fmt.Errorf("unsupported Azure KeyVault object type %s", objectType)
+	}
+}
+
+// readCertificate reads a certificate from the secret backing it, which holds its private key too
+// if it's exportable. Certificates keep the same version as their secrets.
+func (c *azureKVClient) readCertificate(path string, key string, version string) (string, string, error) {
+	if key != "" && key != azureKVCertificateKey && key != azureKVPrivateKeyKey && key != azureKVPFXKey {
+		return "", "", fmt.Errorf("unsupported key %s of Azure KeyVault certificate %s, one of %s, %s or %s", key, path, azureKVCertificateKey, azureKVPrivateKeyKey, azureKVPFXKey)
+	}
+	result, readVersion, err := c.getSecret(path, version)
+	if err != nil {
+		return "", "", err
+	}
+	pfx := result.ContentType != nil && *result.ContentType == azureKVPKCS12ContentType
+	if key == azureKVPFXKey {
+		if !pfx {
+			return "", "", fmt.Errorf("azure KeyVault certificate %s is not kept as PKCS12, it can't be read as PFX", path)
+		}
+		return *result.Value, readVersion, nil
+	}
+
+	var blocks []*pem.Block
+	if pfx {
+		data, err := base64.StdEncoding.DecodeString(*result.Value)
+		if err != nil {
+			return "", "", err
+		}
+		if blocks, err = pkcs12.ToPEM(data, ""); err != nil {
+			return "", "", err
+		}
+	} else {
+		rest := []byte(*result.Value)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	certificates, privateKey, err := parseCertificateBlocks(blocks)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Azure KeyVault certificate %s: %v", path, err)
+	}
+
+	if key == azureKVPrivateKeyKey {
+		if privateKey == nil {
+			return "", "", fmt.Errorf("azure KeyVault certificate %s has no exportable private key", path)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return "", "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), readVersion, nil
+	}
+	var chain bytes.Buffer
+	for _, certificate := range certificates {
+		pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	}
+	return chain.String(), readVersion, nil
+}
+
+// parseCertificateBlocks returns the certificate chain and private key in blocks. The certificate of the
+// private key is moved first, as the chain isn't sorted in PKCS12 files.
+func parseCertificateBlocks(blocks []*pem.Block) ([]*x509.Certificate, crypto.Signer, error) {
+	var certificates []*x509.Certificate
+	var privateKey crypto.Signer
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certificates = append(certificates, certificate)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			key, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKey = key
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, nil, fmt.Errorf("no certificates found")
+	}
+	if privateKey == nil {
+		return certificates, nil, nil
+	}
+	for i, certificate := range certificates {
+		if publicKey, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && publicKey.Equal(privateKey.Public()) {
+			certificates[0], certificates[i] = certificates[i], certificates[0]
+			break
+		}
+	}
+	return certificates, privateKey, nil
+}
+
+// parsePrivateKey parses a PKCS8, PKCS1 or SEC1 private key, as PKCS12 files are converted to PEM
+// with the last two ones
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// readKey reads the public part of a key from the KeyVault keys API
+func (c *azureKVClient) readKey(path string, key string, version string) (string, string, error) {
+	if key != "" && key != azureKVPublicKeyKey && key != azureKVJWKKey {
+		return "", "", fmt.Errorf("unsupported key %s of Azure KeyVault key %s, one of %s or %s", key, path, azureKVPublicKeyKey, azureKVJWKKey)
+	}
+	req, err := runtime.NewRequest(c.context, http.MethodGet, runtime.JoinPaths(c.vaultURL, "keys", url.PathEscape(path), url.PathEscape(version)))
+	if err != nil {
+		return "", "", err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", azureKVKeysAPIVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+	req.Raw().Header.Set("Accept", "application/json")
+
+	resp, err := c.keys.Do(req)
+	if err == nil && !runtime.HasStatusCode(resp, http.StatusOK) {
+		err = runtime.NewResponseError(resp)
+	}
+	if err != nil {
+		c.updateReadErrorsMetric(path, err)
+		return "", "", err
+	}
+	var bundle struct {
+		Key json.RawMessage `json:"key"`
+	}
+	if err = runtime.UnmarshalAsJSON(resp, &bundle); err != nil {
+		return "", "", err
+	}
+	var jwk azureJSONWebKey
+	if err = json.Unmarshal(bundle.Key, &jwk); err != nil {
+		return "", "", err
+	}
+
+	// The key ID is https://<keyvault>.vault.azure.net/keys/<name>/<version>
+	readVersion := jwk.Kid[strings.LastIndex(jwk.Kid, "/")+1:]
+	if key == azureKVJWKKey {
+		var compact bytes.Buffer
+		if err = json.Compact(&compact, bundle.Key); err != nil {
+			return "", "", err
+		}
+		return compact.String(), readVersion, nil
+	}
+	publicKey, err := jwk.publicKey()
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Azure KeyVault key %s: %v", path, err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), readVersion, nil
+}
+
+var azureCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// publicKey returns the RSA or EC public key of the JWK, whose parameters are base64url encoded
+func (k azureJSONWebKey) publicKey() (crypto.PublicKey, error) {
+	param := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch k.Kty {
+	case "RSA", "RSA-HSM":
+		n, err := param(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := param(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC", "EC-HSM":
+		curve, ok := azureCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := param(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := param(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azsecrets"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// akvPFXCertificate is the "Windows Azure Tools" certificate of
+// https://github.com/golang/crypto/blob/e495a2d5b3d3/pkcs12/pkcs12_test.go, with an RSA private key
+const akvPFXCertificate = "MIIKDAIBAzCCCcwGCSqGSIb3DQEHAaCCCb0Eggm5MIIJtTCCBe4GCSqGSIb3DQEHAaCCBd8EggXbMIIF1zCCBdMGCyqGSIb3DQEMCgECoIIE7jCCBOowHAYKKoZIhvcNAQwBAzAOBAhStUNnlTGV+gICB9AEggTIJ81JIossF6boFWpPtkiQRPtI6DW6e9QD4/WvHAVrM2bKdpMzSMsCML5NyuddANTKHBVq00Jc9keqGNAqJPKkjhSUebzQFyhe0E1oI9T4zY5UKr/I8JclOeccH4QQnsySzYUG2SnniXnQ+JrG3juetli7EKth9h6jLc6xbubPadY5HMB3wL/eG/kJymiXwU2KQ9Mgd4X6jbcV+NNCE/8jbZHvSTCPeYTJIjxfeX61Sj5kFKUCzERbsnpyevhY3X0eYtEDezZQarvGmXtMMdzf8HJHkWRdk9VLDLgjk8uiJif/+X4FohZ37ig0CpgC2+dP4DGugaZZ51hb8tN9GeCKIsrmWogMXDIVd0OACBp/EjJVmFB6y0kUCXxUE0TZt0XA1tjAGJcjDUpBvTntZjPsnH/4ZySy+s2d9OOhJ6pzRQBRm360TzkFdSwk9DLiLdGfv4pwMMu/vNGBlqjP/1sQtj+jprJiD1sDbCl4AdQZVoMBQHadF2uSD4/o17XG/Ci0r2h6Htc2yvZMAbEY4zMjjIn2a+vqIxD6onexaek1R3zbkS9j19D6EN9EWn8xgz80YRCyW65znZk8xaIhhvlU/mg7sTxeyuqroBZNcq6uDaQTehDpyH7bY2l4zWRpoj10a6JfH2q5shYz8Y6UZC/kOTfuGqbZDNZWro/9pYquvNNW0M847E5t9bsf9VkAAMHRGBbWoVoU9VpI0UnoXSfvpOo+aXa2DSq5sHHUTVY7A9eov3z5IqT+pligx11xcs+YhDWcU8di3BTJisohKvv5Y8WSkm/rloiZd4ig269k0jTRk1olP/vCksPli4wKG2wdsd5o42nX1yL7mFfXocOANZbB+5qMkiwdyoQSk+Vq+C8nAZx2bbKhUq2MbrORGMzOe0Hh0x2a0PeObycN1Bpyv7Mp3ZI9h5hBnONKCnqMhtyQHUj/nNvbJUnDVYNfoOEqDiEqqEwB7YqWzAKz8KW0OIqdlM8uiQ4JqZZlFllnWJUfaiDrdFM3lYSnFQBkzeVlts6GpDOOBjCYd7dcCNS6kq6pZC6p6HN60Twu0JnurZD6RT7rrPkIGE8vAenFt4iGe/yF52fahCSY8Ws4K0UTwN7bAS+4xRHVCWvE8sMRZsRCHizb5laYsVrPZJhE6+hux6OBb6w8kwPYXc+ud5v6UxawUWgt6uPwl8mlAtU9Z7Miw4Nn/wtBkiLL/ke1UI1gqJtcQXgHxx6mzsjh41+nAgTvdbsSEyU6vfOmxGj3Rwc1eOrIhJUqn5YjOWfzzsz/D5DzWKmwXIwdspt1p+u+kol1N3f2wT9fKPnd/RGCb4g/1hc3Aju4DQYgGY782l89CEEdalpQ/35bQczMFk6Fje12HykakWEXd/bGm9Unh82gH84USiRpeOfQvBDYoqEyrY3zkFZzBjhDqa+jEcAj41tcGx47oSfDq3iVYCdL7HSIjtnyEktVXd7mISZLoMt20JACFcMw+mrbjlug+eU7o2GR7T+LwtOp/p4LZqyLa7oQJDwde1BNZtm3TCK2P1mW94QDL0nDUps5KLtr1DaZXEkRbjSJub2ZE9WqDHyU3KA8G84Tq/rN1IoNu/if45jacyPje1Npj9IftUZSP22nV7HMwZtwQ4P4MYHRMBMGCSqGSIb3DQEJFTEGBAQBAAAAMFsGCSqGSIb3DQEJFDFOHkwAewBCADQAQQA0AEYARQBCADAALQBBADEAOABBAC0ANAA0AEIAQgAtAEIANQBGADIALQA0ADkAMQBFAEYAMQA1ADIAQgBBADEANgB9MF0GCSsGAQQBgjcRATFQHk4ATQBpAGMAcgBvAHMAbwBmAHQAIABTAG8AZgB0AHcAYQByAGUAIABLAGUAeQAgAFMAdABvAHIAYQBnAGUAIABQAHIAbwB2AGkAZABlAHIwggO/BgkqhkiG9w0BBwagggOwMIIDrAIBADCCA6UGCSqGSIb3DQEHATAcBgoqhkiG9w0BDAEGMA4ECEBk5ZAYpu0WAgIH0ICCA3hik4mQFGpw9Ha8TQPtk+j2jwWdxfF0+sTk6S8PTsEfIhB7wPltjiCK92Uv2tCBQnodBUmatIfkpnRDEySmgmdglmOCzj204lWAMRs94PoALGn3JVBXbO1vIDCbAPOZ7Z0Hd0/1t2hmk8v3//QJGUg+qr59/4y/MuVfIg4qfkPcC2QSvYWcK3oTf6SFi5rv9B1IOWFgN5D0+C+x/9Lb/myPYX+rbOHrwtJ4W1fWKoz9g7wwmGFA9IJ2DYGuH8ifVFbDFT1Vcgsvs8arSX7oBsJVW0qrP7XkuDRe3EqCmKW7rBEwYrFznhxZcRDEpMwbFoSvgSIZ4XhFY9VKYglT+JpNH5iDceYEBOQL4vBLpxNUk3l5jKaBNxVa14AIBxq18bVHJ+STInhLhad4u10v/Xbx7wIL3f9DX1yLAkPrpBYbNHS2/ew6H/ySDJnoIDxkw2zZ4qJ+qUJZ1S0lbZVG+VT0OP5uF6tyOSpbMlcGkdl3z254n6MlCrTifcwkzscysDsgKXaYQw06rzrPW6RDub+t+hXzGny799fS9jhQMLDmOggaQ7+LA4oEZsfT89HLMWxJYDqjo3gIfjciV2mV54R684qLDS+AO09U49e6yEbwGlq8lpmO/pbXCbpGbB1b3EomcQbxdWxW2WEkkEd/VBn81K4M3obmywwXJkw+tPXDXfBmzzaqqCR+onMQ5ME1nMkY8ybnfoCc1bDIupjVWsEL2Wvq752RgI6KqzVNr1ew1IdqV5AWN2fOfek+0vi3Jd9FHF3hx8JMwjJL9dZsETV5kHtYJtE7wJ23J68BnCt2eI0GEuwXcCf5EdSKN/xXCTlIokc4Qk/gzRdIZsvcEJ6B1lGovKG54X4IohikqTjiepjbsMWj38yxDmK3mtENZ9ci8FPfbbvIEcOCZIinuY3qFUlRSbx7VUerEoV1IP3clUwexVQo4lHFee2jd7ocWsdSqSapW7OWUupBtDzRkqVhE7tGria+i1W2d6YLlJ21QTjyapWJehAMO637OdbJCCzDs1cXbodRRE7bsP492ocJy8OX66rKdhYbg8srSFNKdb3pF3UDNbN9jhI/t8iagRhNBhlQtTr1me2E/c86Q18qcRXl4bcXTt6acgCeffK6Y26LcVlrgjlD33AEYRRUeyC+rpxbT0aMjdFderlndKRIyG23mSp0HaUwNzAfMAcGBSsOAwIaBBRlviCbIyRrhIysg2dc/KbLFTc2vQQUg4rfwHMM4IKYRD/fsd1x6dda+wQ="
+
+var akvKeys = map[string]crypto.Signer{}
+
+func init() {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	akvKeys["rsa-key"] = rsaKey
+	akvKeys["ec-key"] = ecKey
+}
+
+// akvGetKey returns the JWK of the public part of akvKeys, like the KeyVault keys API does
+func akvGetKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	version := "78deebed173b48e48f55abf87ed4cf71"
+	if parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/keys/"), "/"); len(parts) > 1 && parts[1] != "" {
+		version = parts[1]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	key, ok := akvKeys[vars["keyName"]]
+	if !ok || r.URL.Query().Get("api-version") != azureKVKeysAPIVersion {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":{"code":"KeyNotFound","message":"Key not found: %s"}}`, vars["keyName"])
+		return
+	}
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	jwk := map[string]interface{}{
+		"kid":     fmt.Sprintf("https://%s.vault.azure.net/keys/%s/%s", fakeKeyVaultName, vars["keyName"], version),
+		"key_ops": []string{"sign", "verify"},
+	}
+	switch public := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"], jwk["n"], jwk["e"] = "RSA", encode(public.N), encode(big.NewInt(int64(public.E)))
+	case *ecdsa.PublicKey:
+		jwk["kty"], jwk["crv"], jwk["x"], jwk["y"] = "EC", public.Curve.Params().Name, encode(public.X), encode(public.Y)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":        jwk,
+		"attributes": map[string]interface{}{"enabled": true},
+	})
+}
+
+func newTestAzureKVClient() azureKVClient {
+	cred := NewFakeCredential("fake", "fake")
+	azClient, _ := azsecrets.NewClient(testingCfg.VaultURL, cred, nil)
+	return azureKVClient{
+		client:       azClient,
+		keys:         newAzureKVKeysPipeline(cred),
+		vaultURL:     testingCfg.VaultURL,
+		keyvaultName: "fakekvurl",
+		metrics:      newAzureKVMetrics(fakeKeyVaultName, fakeKeyVaultTenant),
+		context:      context.TODO(),
+		logger:       logger,
+	}
+}
+
+// addAKVCertificate adds the secret backing a certificate to the fake KeyVault
+func addAKVCertificate(t *testing.T, name string, value string, contentType string) {
+	akvSecrets[name] = struct {
+		value       string
+		access      bool
+		contentType string
+	}{value: strings.ReplaceAll(value, "\n", `\n`), access: true, contentType: contentType}
+	t.Cleanup(func() { delete(akvSecrets, name) })
+}
+
+func TestAzureKVClientReadPEMCertificate(t *testing.T) {
+	client := newTestAzureKVClient()
+	ca := newTestCertificate(t, "ca", nil)
+	leaf := newTestCertificate(t, "www.example.com", &ca)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(leaf.key)
+	assert.Nil(t, err)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+	addAKVCertificate(t, "pem-certificate", privateKey+string(ca.pem)+string(leaf.pem), "application/x-pem-file")
+
+	// The certificate of the private key goes first in the chain
+	chain, version, err := client.ReadObjectVersion(CertificateObjectType, "pem-certificate", "certificate", "")
+	assert.Nil(t, err)
+	assert.Equal(t, string(leaf.pem)+string(ca.pem), chain)
+	assert.Equal(t, "3f3b11064811494a8a8b27edf4f0985b", version)
+
+	key, version, err := client.ReadObjectVersion(CertificateObjectType, "pem-certificate", "privateKey", "0a1b2c3d")
+	assert.Nil(t, err)
+	assert.Equal(t, privateKey, key)
+	assert.Equal(t, "0a1b2c3d", version)
+
+	_, _, err = client.ReadObjectVersion(CertificateObjectType, "pem-certificate", "pfx", "")
+	assert.EqualError(t, err, "azure KeyVault certificate pem-certificate is not kept as PKCS12, it can't be read as PFX")
+
+	_, _, err = client.ReadObjectVersion(CertificateObjectType, "pem-certificate", "tls.crt", "")
+	assert.EqualError(t, err, "unsupported key tls.crt of Azure KeyVault certificate pem-certificate, one of certificate, privateKey or pfx")
+
+	// Certificates whose private key is not exportable are kept without it
+	addAKVCertificate(t, "non-exportable", string(leaf.pem), "application/x-pem-file")
+	chain, _, err = client.ReadObjectVersion(CertificateObjectType, "non-exportable", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, string(leaf.pem), chain)
+	_, _, err = client.ReadObjectVersion(CertificateObjectType, "non-exportable", "privateKey", "")
+	assert.EqualError(t, err, "azure KeyVault certificate non-exportable has no exportable private key")
+
+	_, _, err = client.ReadObjectVersion(CertificateObjectType, "not-found", "certificate", "")
+	assert.IsType(t, new(azcore.ResponseError), err)
+}
+
+func TestAzureKVClientReadPFXCertificate(t *testing.T) {
+	client := newTestAzureKVClient()
+	addAKVCertificate(t, "pfx-certificate", akvPFXCertificate, azureKVPKCS12ContentType)
+
+	value, _, err := client.ReadObjectVersion(CertificateObjectType, "pfx-certificate", "pfx", "")
+	assert.Nil(t, err)
+	assert.Equal(t, akvPFXCertificate, value)
+
+	value, _, err = client.ReadObjectVersion(CertificateObjectType, "pfx-certificate", "certificate", "")
+	assert.Nil(t, err)
+	block, _ := pem.Decode([]byte(value))
+	assert.Equal(t, "CERTIFICATE", block.Type)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+	assert.Equal(t, "Windows Azure Tools", certificate.Subject.CommonName)
+
+	value, _, err = client.ReadObjectVersion(CertificateObjectType, "pfx-certificate", "privateKey", "")
+	assert.Nil(t, err)
+	block, _ = pem.Decode([]byte(value))
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.Nil(t, err)
+	assert.True(t, key.(*rsa.PrivateKey).PublicKey.Equal(certificate.PublicKey))
+}
+
+func TestAzureKVClientReadKey(t *testing.T) {
+	client := newTestAzureKVClient()
+
+	for name, key := range akvKeys {
+		value, version, err := client.ReadObjectVersion(KeyObjectType, name, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, "78deebed173b48e48f55abf87ed4cf71", version)
+		block, _ := pem.Decode([]byte(value))
+		assert.Equal(t, "PUBLIC KEY", block.Type)
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		assert.Nil(t, err)
+		assert.True(t, key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(publicKey), name)
+	}
+
+	value, version, err := client.ReadObjectVersion(KeyObjectType, "ec-key", "jwk", "0a1b2c3d")
+	assert.Nil(t, err)
+	assert.Equal(t, "0a1b2c3d", version)
+	var jwk azureJSONWebKey
+	assert.Nil(t, json.Unmarshal([]byte(value), &jwk))
+	assert.Equal(t, "EC", jwk.Kty)
+	assert.Equal(t, "P-384", jwk.Crv)
+	assert.NotContains(t, value, "\n")
+
+	_, _, err = client.ReadObjectVersion(KeyObjectType, "not-found", "publicKey", "")
+	assert.IsType(t, new(azcore.ResponseError), err)
+
+	_, _, err = client.ReadObjectVersion(KeyObjectType, "rsa-key", "privateKey", "")
+	assert.EqualError(t, err, "unsupported key privateKey of Azure KeyVault key rsa-key, one of publicKey or jwk")
+
+	_, _, err = client.ReadObjectVersion("storage-account", "rsa-key", "", "")
+	assert.EqualError(t, err, "unsupported Azure KeyVault object type storage-account")
+}
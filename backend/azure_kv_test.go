@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,8 +25,9 @@ const (
 )
 
 var akvSecrets = map[string]struct {
-	value  string
-	access bool
+	value       string
+	access      bool
+	contentType string
 }{
 	fakeKeyVaultSecret: {value: "some-fake-value", access: true},
 	"exists":           {value: "yes", access: true},
@@ -38,12 +40,17 @@ func akvGetSecret(w http.ResponseWriter, r *http.Request) {
 	// https://github.com/Azure/azure-sdk-for-go/blob/c73b114ded83c0a9c2685336b8b90836c1530cb3/sdk/keyvault/azsecrets/testdata/recordings/TestSetGetSecret.json
 	vars := mux.Vars(r)
 	jsonData := "{}"
+	version := "3f3b11064811494a8a8b27edf4f0985b"
+	if parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/secrets/"), "/"); len(parts) > 1 && parts[1] != "" {
+		version = parts[1]
+	}
 	if v, ok := akvSecrets[vars["secretName"]]; ok {
 		if v.access {
 			jsonData = fmt.Sprintf(`
 			{
 				"value": "%s",
-				"id": "https://%s.vault.azure.net/secrets/%s/3f3b11064811494a8a8b27edf4f0985b",
+				"contentType": "%s",
+				"id": "https://%s.vault.azure.net/secrets/%s/%s",
         "attributes": {
           "enabled": true,
           "created": 1643130727,
@@ -51,7 +58,7 @@ func akvGetSecret(w http.ResponseWriter, r *http.Request) {
           "recoveryLevel": "CustomizedRecoverable\u002BPurgeable",
           "recoverableDays": 7
         }
-			}`, v.value, fakeKeyVaultName, vars["secretName"])
+			}`, v.value, v.contentType, fakeKeyVaultName, vars["secretName"], version)
 		} else {
 			w.WriteHeader(http.StatusForbidden)
 		}
@@ -118,13 +125,13 @@ func TestGetAzureCredential(t *testing.T) {
 			"Empty config should not be able to generate any client",
 		},
 		{
-			Config{AzureKVManagedClientID: "fake-client-id"},
+			Config{AzureKVAuthMethod: "managed-identity", AzureKVManagedClientID: "fake-client-id"},
 			false,
 			new(azidentity.ManagedIdentityCredential),
 			"Managed identity client should be generated using managed client ID",
 		},
 		{
-			Config{AzureKVManagedResourceID: "fake-resource-id"},
+			Config{AzureKVAuthMethod: "managed-identity", AzureKVManagedResourceID: "fake-resource-id"},
 			false,
 			new(azidentity.ManagedIdentityCredential),
 			"Managed identity client should be generated using managed resource ID",
@@ -181,6 +188,77 @@ func TestGetAzureCredential(t *testing.T) {
 			new(azidentity.ClientSecretCredential),
 			"ClientSecretCredential should be generated with TenantID, ClientID and ClientSecret",
 		},
+		{
+			Config{
+				AzureKVManagedClientID: "fake-client-id",
+			},
+			true,
+			nil,
+			"Empty auth method should not fall back to the managed identity",
+		},
+		{
+			Config{AzureKVAuthMethod: "managed-identity"},
+			false,
+			new(azidentity.ManagedIdentityCredential),
+			"Managed identity client should be generated for the system assigned identity",
+		},
+		{
+			Config{
+				AzureKVAuthMethod:      "client-secret",
+				AzureKVManagedClientID: "fake-client-id",
+			},
+			true,
+			nil,
+			"Client secret auth method should not fall back to the managed identity",
+		},
+		{
+			Config{
+				AzureKVAuthMethod:   "client-secret",
+				AzureKVTenantID:     "fake-tenant-id",
+				AzureKVClientID:     "fake-client-id",
+				AzureKVClientSecret: "fake-client-secret",
+			},
+			false,
+			new(azidentity.ClientSecretCredential),
+			"ClientSecretCredential should be generated with the client-secret auth method",
+		},
+		{
+			Config{
+				AzureKVAuthMethod: "client-certificate",
+				AzureKVTenantID:   "fake-tenant-id",
+				AzureKVClientID:   "fake-client-id",
+			},
+			true,
+			nil,
+			"Client certificate auth method should not generate any client without certificate",
+		},
+		{
+			Config{
+				AzureKVAuthMethod: "workload-identity",
+				AzureKVTenantID:   "fake-tenant-id",
+				AzureKVClientID:   "fake-client-id",
+			},
+			true,
+			nil,
+			"Workload identity auth method should not generate any client without federated token",
+		},
+		{
+			Config{
+				AzureKVAuthMethod:         "workload-identity",
+				AzureKVTenantID:           "fake-tenant-id",
+				AzureKVClientID:           "fake-client-id",
+				AzureKVFederatedTokenFile: "/var/run/secrets/azure/tokens/azure-identity-token",
+			},
+			false,
+			new(azureWorkloadIdentityCredential),
+			"Workload identity client should be generated with TenantID, ClientID and federated token file",
+		},
+		{
+			Config{AzureKVAuthMethod: "aad-pod-identity"},
+			true,
+			nil,
+			"Unsupported auth methods should not generate any client",
+		},
 	}
 	for _, c := range cases {
 		client, err := getAzureCredential(context.TODO(), logger, c.cfg)
@@ -223,14 +301,13 @@ func TestAzureKeyVaultClient(t *testing.T) {
 	assert.Nilf(t, err, "Service Principal Authentication should not generate error")
 	assert.NotNilf(t, client, "Service Principal Authentication should generate a client")
 
-	cfg = Config{AzureKVManagedClientID: "fake-client-id"}
+	cfg = Config{AzureKVAuthMethod: "managed-identity", AzureKVManagedClientID: "fake-client-id"}
 	client, err = azureKeyVaultClient(context.TODO(), logger, cfg)
 	assert.Nilf(t, err, "Managed Identity Authentication should not generate error")
 	assert.NotNilf(t, client, "Managed Identity Authentication should generate a client")
 }
 
 func TestAzureKVClientReadSecret(t *testing.T) {
-	akvMetrics = newAzureKVMetrics(fakeKeyVaultName, fakeKeyVaultTenant)
 	azClient, _ := azsecrets.NewClient(
 		testingCfg.VaultURL, // Is a mock server, valid for both cases
 		NewFakeCredential("fake", "fake"),
@@ -239,6 +316,7 @@ func TestAzureKVClientReadSecret(t *testing.T) {
 	client := azureKVClient{
 		client:       azClient,
 		keyvaultName: "fakekvurl",
+		metrics:      newAzureKVMetrics(fakeKeyVaultName, fakeKeyVaultTenant),
 		context:      context.TODO(),
 		logger:       logger,
 	}
@@ -265,3 +343,28 @@ func TestAzureKVClientReadSecret(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "", value)
 }
+
+func TestAzureKVClientReadSecretVersion(t *testing.T) {
+	azClient, _ := azsecrets.NewClient(
+		testingCfg.VaultURL,
+		NewFakeCredential("fake", "fake"),
+		nil,
+	)
+	client := azureKVClient{
+		client:       azClient,
+		keyvaultName: "fakekvurl",
+		metrics:      newAzureKVMetrics(fakeKeyVaultName, fakeKeyVaultTenant),
+		context:      context.TODO(),
+		logger:       logger,
+	}
+
+	value, version, err := client.ReadSecretVersion("exists", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, akvSecrets["exists"].value, value)
+	assert.Equal(t, "3f3b11064811494a8a8b27edf4f0985b", version)
+
+	value, version, err = client.ReadSecretVersion("exists", "", "0a1b2c3d")
+	assert.Nil(t, err)
+	assert.Equal(t, akvSecrets["exists"].value, value)
+	assert.Equal(t, "0a1b2c3d", version)
+}
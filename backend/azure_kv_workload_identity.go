@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const azureClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// azureWorkloadIdentityCredential exchanges the service account token projected by Azure Workload
+// Identity for an Azure AD access token of the application trusting it. The token file is read on
+// every request, as it's rotated by the kubelet.
+type azureWorkloadIdentityCredential struct {
+	tenantID      string
+	clientID      string
+	tokenFile     string
+	authorityHost string
+	httpClient    *http.Client
+}
+
+type azureTokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func newAzureWorkloadIdentityCredential(cfg Config) (*azureWorkloadIdentityCredential, error) {
+	if cfg.AzureKVTenantID == "" || cfg.AzureKVClientID == "" || cfg.AzureKVFederatedTokenFile == "" {
+		return nil, fmt.Errorf("azure workload identity requires a tenant ID, a client ID and a federated token file")
+	}
+	authorityHost := cfg.AzureKVAuthorityHost
+	if authorityHost == "" {
+		authorityHost = string(azidentity.AzurePublicCloud)
+	}
+	return &azureWorkloadIdentityCredential{
+		tenantID:      cfg.AzureKVTenantID,
+		clientID:      cfg.AzureKVClientID,
+		tokenFile:     cfg.AzureKVFederatedTokenFile,
+		authorityHost: strings.TrimSuffix(authorityHost, "/"),
+		httpClient:    &http.Client{Timeout: cfg.BackendTimeout},
+	}, nil
+}
+
+// GetToken requests an access token for the scopes with the client credentials flow, using the
+// federated token as client assertion
+func (c *azureWorkloadIdentityCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (*azcore.AccessToken, error) {
+	assertion, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"client_id":             {c.clientID},
+		"scope":                 {strings.Join(options.Scopes, " ")},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {azureClientAssertionType},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", c.authorityHost, c.tenantID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	requested := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token azureTokenResponse
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid Azure AD token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("unable to exchange Azure federated token: %s %s", token.Error, token.ErrorDescription)
+	}
+	expiresIn, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure AD token expiration %s", token.ExpiresIn)
+	}
+	return &azcore.AccessToken{
+		Token:     token.AccessToken,
+		ExpiresOn: requested.Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
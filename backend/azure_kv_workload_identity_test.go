@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeAzureAuthority returns an Azure AD authority issuing access tokens named after the client assertion
+func newFakeAzureAuthority(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/"+fakeKeyVaultTenant+"/oauth2/v2.0/token", r.URL.Path)
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "fake-client-id", r.PostForm.Get("client_id"))
+		assert.Equal(t, "https://vault.azure.net/.default", r.PostForm.Get("scope"))
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, azureClientAssertionType, r.PostForm.Get("client_assertion_type"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("client_assertion") == "expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":             "invalid_client",
+				"error_description": "AADSTS700024: Client assertion is not within its valid time range.",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token_type":   "Bearer",
+			"expires_in":   3599,
+			"access_token": "access-" + r.PostForm.Get("client_assertion"),
+		})
+	}))
+}
+
+func TestAzureWorkloadIdentityCredential(t *testing.T) {
+	authority := newFakeAzureAuthority(t)
+	defer authority.Close()
+	tokenFile, err := ioutil.TempFile("", "azure-identity-token")
+	assert.Nil(t, err)
+	defer os.Remove(tokenFile.Name())
+	tokenFile.Close()
+
+	cred, err := newAzureWorkloadIdentityCredential(Config{
+		AzureKVTenantID:           fakeKeyVaultTenant,
+		AzureKVClientID:           "fake-client-id",
+		AzureKVFederatedTokenFile: tokenFile.Name(),
+		AzureKVAuthorityHost:      authority.URL + "/",
+	})
+	assert.Nil(t, err)
+	options := policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}}
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile.Name(), []byte("federated-1\n"), 0600))
+	token, err := cred.GetToken(context.TODO(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-federated-1", token.Token)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresOn, time.Minute)
+
+	// The rotated federated token is used on the next request
+	assert.Nil(t, ioutil.WriteFile(tokenFile.Name(), []byte("federated-2"), 0600))
+	token, err = cred.GetToken(context.TODO(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-federated-2", token.Token)
+
+	assert.Nil(t, ioutil.WriteFile(tokenFile.Name(), []byte("expired"), 0600))
+	_, err = cred.GetToken(context.TODO(), options)
+	assert.EqualError(t, err, "unable to exchange Azure federated token: invalid_client AADSTS700024: Client assertion is not within its valid time range.")
+}
+
+func TestAzureClientCertificateCredential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azure-client-certificate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "secrets-manager"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	certData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certData = append(certData, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	certFile := filepath.Join(dir, "client.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, certData, 0600))
+
+	cfg := Config{
+		AzureKVAuthMethod:            "client-certificate",
+		AzureKVTenantID:              fakeKeyVaultTenant,
+		AzureKVClientID:              "fake-client-id",
+		AzureKVClientCertificateFile: certFile,
+	}
+	cred, err := getAzureCredential(context.TODO(), logger, cfg)
+	assert.Nil(t, err)
+	assert.IsType(t, new(azidentity.ClientCertificateCredential), cred)
+
+	// A certificate without its private key can't be used
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	_, err = getAzureCredential(context.TODO(), logger, cfg)
+	assert.NotNil(t, err)
+}
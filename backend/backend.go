@@ -2,46 +2,141 @@ package backend
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/tuenti/secrets-manager/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	vaultBackendName   = "vault"
-	azureKVBackendName = "azure-kv"
+	vaultBackendName       = "vault"
+	azureKVBackendName     = "azure-kv"
+	awsSMBackendName       = "aws-sm"
+	awsSSMBackendName      = "aws-ssm"
+	gcpSMBackendName       = "gcp-sm"
+	kubernetesBackendName  = "kubernetes"
+	fileBackendName        = "file"
+	consulBackendName      = "consul"
+	conjurBackendName      = "conjur"
+	onePasswordBackendName = "onepassword"
+	sopsBackendName        = "sops"
+	bitwardenBackendName   = "bitwarden"
 )
 
 var supportedBackends map[string]bool
 
 func init() {
 	supportedBackends = map[string]bool{
-		vaultBackendName:   true,
-		azureKVBackendName: true,
+		vaultBackendName:       true,
+		azureKVBackendName:     true,
+		awsSMBackendName:       true,
+		awsSSMBackendName:      true,
+		gcpSMBackendName:       true,
+		kubernetesBackendName:  true,
+		fileBackendName:        true,
+		consulBackendName:      true,
+		conjurBackendName:      true,
+		onePasswordBackendName: true,
+		sopsBackendName:        true,
+		bitwardenBackendName:   true,
 	}
 }
 
 // Config type represent backend config, and should include all backends config
 type Config struct {
-	BackendTimeout           time.Duration
-	VaultURL                 string
-	VaultAuthMethod          string
-	VaultRoleID              string
-	VaultSecretID            string
-	VaultKubernetesRole      string
-	VaultMaxTokenTTL         int64
-	VaultTokenPollingPeriod  time.Duration
-	VaultRenewTTLIncrement   int
-	VaultEngine              string
-	VaultApprolePath         string
-	VaultKubernetesPath      string
-	AzureKVName              string
-	AzureKVTenantID          string
-	AzureKVClientID          string
-	AzureKVClientSecret      string
-	AzureKVManagedClientID   string
-	AzureKVManagedResourceID string
+	BackendTimeout                   time.Duration
+	VaultURL                         string
+	VaultAuthMethod                  string
+	VaultRoleID                      string
+	VaultSecretID                    string
+	VaultKubernetesRole              string
+	VaultMaxTokenTTL                 int64
+	VaultTokenPollingPeriod          time.Duration
+	VaultRenewTTLIncrement           int
+	VaultEngine                      string
+	VaultApprolePath                 string
+	VaultKubernetesPath              string
+	VaultCertRole                    string
+	VaultCertPath                    string
+	VaultJWTRole                     string
+	VaultJWTPath                     string
+	VaultJWTTokenFile                string
+	VaultTokenFile                   string
+	VaultIdentityServiceAccount      string
+	VaultIdentityRole                string
+	VaultIdentityAudience            string
+	VaultIdentityTokenExpiration     time.Duration
+	VaultNamespace                   string
+	VaultCACert                      string
+	VaultCAPath                      string
+	VaultClientCert                  string
+	VaultClientKey                   string
+	VaultTLSServerName               string
+	VaultTLSMinVersion               string
+	AzureKVName                      string
+	AzureKVTenantID                  string
+	AzureKVClientID                  string
+	AzureKVClientSecret              string
+	AzureKVManagedClientID           string
+	AzureKVManagedResourceID         string
+	AzureKVAuthMethod                string
+	AzureKVAuthorityHost             string
+	AzureKVFederatedTokenFile        string
+	AzureKVClientCertificateFile     string
+	AzureKVClientCertificatePassword string
+	AWSSMRegion                      string
+	AWSSMEndpoint                    string
+	AWSSMAuthMethod                  string
+	AWSSMAccessKeyID                 string
+	AWSSMSecretAccessKey             string
+	AWSSMRoleARN                     string
+	AWSSMWebIdentityTokenFile        string
+	AWSSSMRegion                     string
+	AWSSSMEndpoint                   string
+	AWSSSMAuthMethod                 string
+	AWSSSMAccessKeyID                string
+	AWSSSMSecretAccessKey            string
+	AWSSSMRoleARN                    string
+	AWSSSMWebIdentityTokenFile       string
+	GCPSMProject                     string
+	GCPSMEndpoint                    string
+	GCPSMAuthMethod                  string
+	GCPSMCredentialsFile             string
+	KubernetesReader                 ctrlclient.Reader
+	KubernetesClientset              kubernetes.Interface
+	ExcludeNamespaces                map[string]bool
+	KubernetesSharedNamespaces       string
+	FileRoot                         string
+	ConsulAddress                    string
+	ConsulDatacenter                 string
+	ConsulToken                      string
+	ConsulCAFile                     string
+	ConsulClientCertFile             string
+	ConsulClientKeyFile              string
+	ConsulTLSServerName              string
+	ConsulTLSSkipVerify              bool
+	ConjurURL                        string
+	ConjurAccount                    string
+	ConjurAuthMethod                 string
+	ConjurLogin                      string
+	ConjurAPIKey                     string
+	ConjurJWTServiceID               string
+	ConjurJWTHostID                  string
+	ConjurJWTTokenFile               string
+	ConjurCAFile                     string
+	ConjurTokenRefreshPeriod         time.Duration
+	OnePasswordURL                   string
+	OnePasswordToken                 string
+	SopsRoot                         string
+	SopsAgeKeyFile                   string
+	SopsPGPKeyFile                   string
+	SopsKeysSecret                   string
+	BitwardenAPIURL                  string
+	BitwardenIdentityURL             string
+	BitwardenAccessToken             string
 }
 
 // Client interface represent a backend client interface that should be implemented
@@ -49,6 +144,94 @@ type Client interface {
 	ReadSecret(path string, key string) (string, error)
 }
 
+// VersionedClient is implemented by the backends able to read a given version of a secret
+type VersionedClient interface {
+	// ReadSecretVersion reads the given version of a secret, or the latest one if version is empty,
+	// and returns the version read
+	ReadSecretVersion(path string, key string, version string) (string, string, error)
+}
+
+// Object types read by the backends implementing ObjectClient
+const (
+	SecretObjectType      = "secret"
+	CertificateObjectType = "certificate"
+	KeyObjectType         = "key"
+)
+
+// ObjectClient is implemented by the backends keeping other objects than secrets, like certificates and keys
+type ObjectClient interface {
+	// ReadObjectVersion reads the given version of the object of objectType named path, or the latest one
+	// if version is empty, and returns the version read. The key selects the format the object is read in.
+	ReadObjectVersion(objectType string, path string, key string, version string) (string, string, error)
+}
+
+// NamespacedClient is implemented by the backends isolating secrets in namespaces, like Vault Enterprise
+type NamespacedClient interface {
+	// WithNamespace returns a client reading the secrets of namespace, with the same credentials
+	WithNamespace(namespace string) (Client, error)
+}
+
+// IdentityClient is implemented by the backends able to read secrets with the identity of the
+// Kubernetes namespace they are synced to, instead of their own one
+type IdentityClient interface {
+	// ForKubernetesNamespace returns a client authenticated as namespace, or the client itself if
+	// it's not configured to use the identity of namespaces
+	ForKubernetesNamespace(namespace string) (Client, error)
+}
+
+// Lease is the lease of a dynamic secret, which is invalidated by the backend once it expires
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+}
+
+// LeasedClient is implemented by the backends issuing dynamic secrets, whose leases must be
+// renewed while they are in use and revoked once they are not needed anymore
+type LeasedClient interface {
+	// IsLeased returns true if reading path issues a new dynamic secret
+	IsLeased(path string) bool
+	// ReadLeasedSecret issues a new dynamic secret at path, returning all its keys
+	ReadLeasedSecret(path string) (map[string]string, Lease, error)
+	// RenewLease extends the lease by its duration, the backend may grant a shorter one
+	RenewLease(lease Lease) (Lease, error)
+	// RevokeLease revokes the lease, invalidating the dynamic secret
+	RevokeLease(lease Lease) error
+}
+
+// CertificateRequest is a request to issue a TLS certificate
+type CertificateRequest struct {
+	// Mount is the path the PKI engine issuing the certificate is mounted at
+	Mount      string
+	Role       string
+	CommonName string
+	AltNames   []string
+	IPSANs     []string
+	// TTL of the certificate, the backend default one if zero
+	TTL time.Duration
+}
+
+// Certificate is a TLS certificate, with its private key and CA certificates PEM encoded
+type Certificate struct {
+	Certificate  string
+	PrivateKey   string
+	CA           string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// CertificateClient is implemented by the backends issuing TLS certificates
+type CertificateClient interface {
+	IssueCertificate(request CertificateRequest) (Certificate, error)
+}
+
+// TransitClient is implemented by the backends decrypting ciphertexts with named keys they keep
+type TransitClient interface {
+	// Decrypt returns the plaintext of ciphertext, encrypted with key by the engine mounted at mount
+	Decrypt(mount string, key string, ciphertext string) ([]byte, error)
+}
+
 // NewBackendClient returns and implementation of Client interface, given the selected backend
 func NewBackendClient(ctx context.Context, backend string, logger logr.Logger, cfg Config) (*Client, error) {
 	var err error
@@ -65,6 +248,8 @@ func NewBackendClient(ctx context.Context, backend string, logger logr.Logger, c
 			return nil, verr
 		}
 		vclient.startTokenRenewer(ctx)
+		vclient.tls.startWatcher(ctx)
+		vclient.startTokenFileWatcher(ctx)
 		client = vclient
 		err = verr
 	case azureKVBackendName:
@@ -74,6 +259,108 @@ func NewBackendClient(ctx context.Context, backend string, logger logr.Logger, c
 		}
 		client = akvclient
 		err = akverr
+	case awsSMBackendName:
+		smclient, smerr := awsSecretsManagerBackendClient(ctx, logger, cfg)
+		if smerr != nil {
+			return nil, smerr
+		}
+		client = smclient
+		err = smerr
+	case awsSSMBackendName:
+		ssmclient, ssmerr := awsParameterStoreBackendClient(ctx, logger, cfg)
+		if ssmerr != nil {
+			return nil, ssmerr
+		}
+		client = ssmclient
+		err = ssmerr
+	case gcpSMBackendName:
+		gsmclient, gsmerr := gcpSecretManagerBackendClient(ctx, logger, cfg)
+		if gsmerr != nil {
+			return nil, gsmerr
+		}
+		client = gsmclient
+		err = gsmerr
+	case kubernetesBackendName:
+		k8sclient, k8serr := kubernetesBackendClient(ctx, logger, cfg)
+		if k8serr != nil {
+			return nil, k8serr
+		}
+		client = k8sclient
+		err = k8serr
+	case fileBackendName:
+		fclient, ferr := fileBackendClient(ctx, logger, cfg)
+		if ferr != nil {
+			return nil, ferr
+		}
+		client = fclient
+		err = ferr
+	case consulBackendName:
+		cclient, cerr := consulKVBackendClient(ctx, logger, cfg)
+		if cerr != nil {
+			return nil, cerr
+		}
+		client = cclient
+		err = cerr
+	case conjurBackendName:
+		cjclient, cjerr := conjurBackendClient(ctx, logger, cfg)
+		if cjerr != nil {
+			return nil, cjerr
+		}
+		cjclient.startTokenRefresher(ctx)
+		client = cjclient
+		err = cjerr
+	case onePasswordBackendName:
+		opclient, operr := onePasswordConnectBackendClient(ctx, logger, cfg)
+		if operr != nil {
+			return nil, operr
+		}
+		client = opclient
+		err = operr
+	case sopsBackendName:
+		sclient, serr := sopsBackendClient(ctx, logger, cfg)
+		if serr != nil {
+			return nil, serr
+		}
+		client = sclient
+		err = serr
+	case bitwardenBackendName:
+		bwclient, bwerr := bitwardenBackendClient(ctx, logger, cfg)
+		if bwerr != nil {
+			return nil, bwerr
+		}
+		client = bwclient
+		err = bwerr
 	}
 	return &client, err
 }
+
+// getJSONField returns the value of the top level field key from the JSON object
+// document stored at path. Non string values are returned in their JSON representation.
+func getJSONField(path string, key string, document string) (string, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(document), &fields); err != nil {
+		return "", err
+	}
+	value, ok := fields[key]
+	if !ok || value == nil {
+		return "", &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// httpStatusError is returned when a backend answers with an unexpected HTTP status code
+type httpStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.Message
+}
@@ -36,6 +36,8 @@ func TestMain(m *testing.M) {
 	v1SysHandler := r.PathPrefix(fmt.Sprintf("/%s/sys", vaultAPIVersion)).Subrouter()
 	v1AuthHandler := r.PathPrefix(fmt.Sprintf("/%s/auth", vaultAPIVersion)).Subrouter()
 	v1SecretHandler := r.PathPrefix(fmt.Sprintf("/%s/secret", vaultAPIVersion)).Subrouter()
+	// Conjur secrets path overlaps with Azure KeyVault one, so its route must be registered first
+	r.HandleFunc("/secrets/{account}/variable/{id:.+}", conjurGetSecret).Methods("GET").HeadersRegexp("Authorization", "^Token ")
 	akvSecretsHandler := r.PathPrefix("/secrets").Subrouter()
 
 	v1SysHandler.HandleFunc("/health", v1SysHealth).Methods("GET")
@@ -43,10 +45,37 @@ func TestMain(m *testing.M) {
 	v1AuthHandler.HandleFunc("/token/renew-self", v1AuthTokenRenewSelf).Methods("PUT")
 	v1AuthHandler.HandleFunc("/approle/login", v1AuthAppRoleLogin).Methods("PUT")
 	v1AuthHandler.HandleFunc("/kubernetes/login", v1AuthKubernetesLogin).Methods("PUT")
+	v1AuthHandler.HandleFunc("/cert/login", v1AuthCertLogin).Methods("PUT")
+	v1AuthHandler.HandleFunc("/jwt/login", v1AuthJWTLogin).Methods("PUT")
+	v1AuthHandler.HandleFunc("/"+vaultIdentityKubernetesPath+"/login", v1AuthKubernetesIdentityLogin).Methods("PUT")
 	v1SecretHandler.HandleFunc("/data/test", v1SecretTestKv2).Methods("GET")
 	v1SecretHandler.HandleFunc("/test", v1SecretTestKv1).Methods("GET")
+	v1SecretHandler.HandleFunc("/data/namespaced", v1SecretNamespacedKv2).Methods("GET")
+	v1SysHandler.HandleFunc("/leases/renew", v1SysLeasesRenew).Methods("PUT")
+	v1SysHandler.HandleFunc("/internal/ui/mounts/database/{path:.+}", v1SysInternalUIMountsDatabase).Methods("GET")
+	v1SysHandler.HandleFunc("/leases/revoke", v1SysLeasesRevoke).Methods("PUT")
+	r.HandleFunc(fmt.Sprintf("/%s/database/creds/{role}", vaultAPIVersion), v1DatabaseCreds).Methods("GET")
+	r.HandleFunc(fmt.Sprintf("/%s/pki/issue/{role}", vaultAPIVersion), v1PKIIssue).Methods("PUT", "POST")
+	r.HandleFunc(fmt.Sprintf("/%s/transit/decrypt/{key}", vaultAPIVersion), v1TransitDecrypt).Methods("PUT", "POST")
 
 	akvSecretsHandler.PathPrefix("/{secretName}").HandlerFunc(akvGetSecret).Methods("GET")
+	r.PathPrefix("/keys/{keyName}").HandlerFunc(akvGetKey).Methods("GET")
+
+	r.HandleFunc("/", awsSMGetSecretValue).Methods("POST").Headers("X-Amz-Target", "secretsmanager.GetSecretValue")
+	r.HandleFunc("/v1/projects/{project}/secrets/{secret}/versions/{version}:access", gcpSMAccessSecretVersion).Methods("GET")
+	r.HandleFunc("/token", gcpOAuth2Token).Methods("POST")
+	r.HandleFunc("/", awsSSMGetParameter).Methods("POST").Headers("X-Amz-Target", "AmazonSSM.GetParameter")
+	r.HandleFunc("/", awsSSMGetParametersByPath).Methods("POST").Headers("X-Amz-Target", "AmazonSSM.GetParametersByPath")
+	r.HandleFunc("/v1/status/leader", consulStatusLeader).Methods("GET")
+	r.HandleFunc("/v1/kv/{key:.+}", consulKVGet).Methods("GET")
+	r.HandleFunc("/authn/{account}/{login:.+}/authenticate", conjurAPIKeyAuthenticate).Methods("POST")
+	r.HandleFunc("/authn-jwt/{service}/{account}/authenticate", conjurJWTAuthenticate).Methods("POST")
+	r.HandleFunc("/v1/vaults", onePasswordListVaults).Methods("GET")
+	r.HandleFunc("/v1/vaults/{vault}/items", onePasswordListItems).Methods("GET")
+	r.HandleFunc("/v1/vaults/{vault}/items/{item}", onePasswordGetItem).Methods("GET")
+	r.HandleFunc(fakeBitwardenPathPrefix+"/identity/connect/token", bitwardenConnectToken).Methods("POST")
+	r.HandleFunc(fakeBitwardenPathPrefix+"/api/projects/{project}/secrets", bitwardenListProjectSecrets).Methods("GET")
+	r.HandleFunc(fakeBitwardenPathPrefix+"/api/secrets/{id}", bitwardenGetSecret).Methods("GET")
 
 	server = httptest.NewServer(r)
 	defer server.Close()
@@ -0,0 +1,359 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	bitwardenTokenURLTemplate          = "%s/connect/token"
+	bitwardenSecretURLTemplate         = "%s/secrets/%s"
+	bitwardenProjectSecretsURLTemplate = "%s/projects/%s/secrets"
+	bitwardenAccessTokenVersion        = "0"
+	bitwardenAccessTokenKeyName        = "bitwarden-accesstoken"
+	bitwardenAccessTokenKeyInfo        = "sm-access-token"
+	bitwardenEncStringType             = "2"
+	bitwardenTokenExpiryMargin         = time.Minute
+)
+
+type bitwardenSymmetricKey struct {
+	encKey []byte
+	macKey []byte
+}
+
+type bitwardenClient struct {
+	httpClient   *http.Client
+	apiURL       string
+	identityURL  string
+	clientID     string
+	clientSecret string
+	accessKey    bitwardenSymmetricKey
+	orgKey       bitwardenSymmetricKey
+	token        string
+	tokenExpiry  time.Time
+	tokenMutex   sync.Mutex
+	metrics      *bitwardenBackendMetrics
+	context      context.Context
+	logger       logr.Logger
+}
+
+type bitwardenSecret struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func bitwardenBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*bitwardenClient, error) {
+	logger := l.WithName("bitwarden").WithValues(
+		"bitwarden_api_url", cfg.BitwardenAPIURL,
+		"bitwarden_identity_url", cfg.BitwardenIdentityURL)
+
+	metrics := newBitwardenBackendMetrics(cfg.BitwardenAPIURL)
+
+	client := bitwardenClient{
+		httpClient:  &http.Client{Timeout: cfg.BackendTimeout},
+		apiURL:      strings.TrimSuffix(cfg.BitwardenAPIURL, "/"),
+		identityURL: strings.TrimSuffix(cfg.BitwardenIdentityURL, "/"),
+		metrics:     metrics,
+		context:     ctx,
+		logger:      logger,
+	}
+
+	if err := client.parseAccessToken(cfg.BitwardenAccessToken); err != nil {
+		return nil, err
+	}
+
+	if err := client.bitwardenLogin(); err != nil {
+		logger.Error(err, "unable to login to Bitwarden with provided access token")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully logged into Bitwarden", "bitwarden_client_id", client.clientID)
+
+	return &client, nil
+}
+
+// parseAccessToken reads a machine account access token, in the 0.<client id>.<client secret>:<key> form.
+// The key is only used to decrypt the organization key returned on login, it's never sent to the server.
+func (c *bitwardenClient) parseAccessToken(accessToken string) error {
+	parts := strings.SplitN(accessToken, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid Bitwarden access token")
+	}
+	credentials := strings.SplitN(parts[0], ".", 3)
+	if len(credentials) != 3 || credentials[0] != bitwardenAccessTokenVersion {
+		return fmt.Errorf("unsupported Bitwarden access token version")
+	}
+	seed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid Bitwarden access token key: %v", err)
+	}
+
+	c.clientID = credentials[1]
+	c.clientSecret = credentials[2]
+	c.accessKey, err = deriveBitwardenKey(seed)
+	return err
+}
+
+// deriveBitwardenKey stretches the access token key into an encryption and a MAC key,
+// the same way Bitwarden SDKs do for shareable keys
+func deriveBitwardenKey(seed []byte) (bitwardenSymmetricKey, error) {
+	mac := hmac.New(sha256.New, []byte(bitwardenAccessTokenKeyName))
+	mac.Write(seed)
+	key := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, mac.Sum(nil), []byte(bitwardenAccessTokenKeyInfo)), key); err != nil {
+		return bitwardenSymmetricKey{}, err
+	}
+	return bitwardenSymmetricKey{encKey: key[:32], macKey: key[32:]}, nil
+}
+
+// decryptBitwardenEncString decrypts an AES-256-CBC with HMAC-SHA256 encrypted string, in the 2.<iv>|<data>|<mac> form
+func decryptBitwardenEncString(encString string, key bitwardenSymmetricKey) ([]byte, error) {
+	parts := strings.SplitN(encString, ".", 2)
+	if len(parts) != 2 || parts[0] != bitwardenEncStringType {
+		return nil, fmt.Errorf("unsupported Bitwarden encrypted string type")
+	}
+	pieces := strings.Split(parts[1], "|")
+	if len(pieces) != 3 {
+		return nil, fmt.Errorf("invalid Bitwarden encrypted string")
+	}
+	decoded := make([][]byte, len(pieces))
+	for i, piece := range pieces {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(piece); err != nil {
+			return nil, err
+		}
+	}
+	iv, data, tag := decoded[0], decoded[1], decoded[2]
+
+	mac := hmac.New(sha256.New, key.macKey)
+	mac.Write(iv)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, fmt.Errorf("invalid Bitwarden encrypted string MAC")
+	}
+
+	block, err := aes.NewCipher(key.encKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid Bitwarden encrypted string length")
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid Bitwarden encrypted string padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// bitwardenLogin gets a new access token for the machine account, along with the
+// organization key the secrets are encrypted with
+func (c *bitwardenClient) bitwardenLogin() error {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"scope":         {"api.secrets"},
+		"client_id":     {c.clientID},
+		"client_secret": {c.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(c.context, http.MethodPost, fmt.Sprintf(bitwardenTokenURLTemplate, c.identityURL), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected status code %d from Bitwarden", resp.StatusCode)}
+	}
+
+	token := struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		EncryptedPayload string `json:"encrypted_payload"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+
+	payload, err := decryptBitwardenEncString(token.EncryptedPayload, c.accessKey)
+	if err != nil {
+		return err
+	}
+	orgKey := struct {
+		EncryptionKey []byte `json:"encryptionKey"`
+	}{}
+	if err = json.Unmarshal(payload, &orgKey); err != nil {
+		return err
+	}
+	if len(orgKey.EncryptionKey) != 64 {
+		return fmt.Errorf("invalid Bitwarden organization key length %d", len(orgKey.EncryptionKey))
+	}
+
+	c.orgKey = bitwardenSymmetricKey{encKey: orgKey.EncryptionKey[:32], macKey: orgKey.EncryptionKey[32:]}
+	c.token = token.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return nil
+}
+
+// getToken returns the current access token, logging in again when it's about to expire
+func (c *bitwardenClient) getToken() (string, bitwardenSymmetricKey, error) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	if time.Now().Add(bitwardenTokenExpiryMargin).After(c.tokenExpiry) {
+		c.logger.V(1).Info("Bitwarden access token about to expire, login again")
+		if err := c.bitwardenLogin(); err != nil {
+			c.metrics.updateLoginErrorsTotalMetric()
+			return "", bitwardenSymmetricKey{}, err
+		}
+	}
+	return c.token, c.orgKey, nil
+}
+
+func (c *bitwardenClient) get(endpoint string, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(c.context, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected status code %d from Bitwarden", resp.StatusCode)}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// findSecretID returns the ID of the secret named name in project. Secret names are
+// encrypted, so every secret of the project has to be decrypted to find it.
+func (c *bitwardenClient) findSecretID(project string, name string, token string, orgKey bitwardenSymmetricKey) (string, error) {
+	list := struct {
+		Secrets []bitwardenSecret `json:"secrets"`
+	}{}
+	if err := c.get(fmt.Sprintf(bitwardenProjectSecretsURLTemplate, c.apiURL, url.PathEscape(project)), token, &list); err != nil {
+		return "", err
+	}
+	for _, secret := range list.Secrets {
+		key, err := decryptBitwardenEncString(secret.Key, orgKey)
+		if err != nil {
+			return "", err
+		}
+		if string(key) == name {
+			return secret.ID, nil
+		}
+	}
+	return "", &httpStatusError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("secret %s not found in Bitwarden project %s", name, project)}
+}
+
+// relogin logs in again, as the current access token was rejected before it expired
+func (c *bitwardenClient) relogin() error {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	if err := c.bitwardenLogin(); err != nil {
+		c.metrics.updateLoginErrorsTotalMetric()
+		return err
+	}
+	return nil
+}
+
+func (c *bitwardenClient) getSecretValue(path string) (string, error) {
+	value, err := c.readSecretValue(path)
+	if statusErr, ok := err.(*httpStatusError); ok && statusErr.StatusCode == http.StatusUnauthorized {
+		// The access token was revoked or rotated before it expired, login again and retry once
+		c.logger.Info("Bitwarden access token rejected, trying to login again")
+		if err = c.relogin(); err != nil {
+			return "", err
+		}
+		value, err = c.readSecretValue(path)
+	}
+	return value, err
+}
+
+func (c *bitwardenClient) readSecretValue(path string) (string, error) {
+	token, orgKey, err := c.getToken()
+	if err != nil {
+		return "", err
+	}
+
+	id := path
+	if parts := strings.SplitN(path, "/", 2); len(parts) == 2 {
+		if id, err = c.findSecretID(parts[0], parts[1], token, orgKey); err != nil {
+			return "", err
+		}
+	}
+
+	secret := bitwardenSecret{}
+	if err = c.get(fmt.Sprintf(bitwardenSecretURLTemplate, c.apiURL, url.PathEscape(id)), token, &secret); err != nil {
+		return "", err
+	}
+	value, err := decryptBitwardenEncString(secret.Value, orgKey)
+	return string(value), err
+}
+
+// ReadSecret reads the secret at path, either a secret ID or <project id>/<secret name>.
+// If key is set, the secret is expected to hold a JSON object and the value of that field is returned.
+func (c *bitwardenClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	value, err := c.getSecretValue(path)
+	if err != nil {
+		if statusErr, ok := err.(*httpStatusError); ok {
+			switch statusErr.StatusCode {
+			case http.StatusNotFound:
+				c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+				return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+			case http.StatusForbidden:
+				c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+				return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+			}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	if key == "" {
+		return value, nil
+	}
+
+	data, err = getJSONField(path, key, value)
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	bitwardenLabelNames            = []string{"bitwarden_api_url"}
+	bitwardenSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "bitwarden",
+		Name:      "read_secret_errors_total",
+		Help:      "Bitwarden read operations counter",
+	}, append(bitwardenLabelNames, secretLabelNames...))
+	bitwardenLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "bitwarden",
+		Name:      "login_errors_total",
+		Help:      "Bitwarden login errors counter",
+	}, bitwardenLabelNames)
+)
+
+type bitwardenBackendMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(bitwardenSecretReadErrorsTotal)
+	r.MustRegister(bitwardenLoginErrorsTotal)
+}
+
+func newBitwardenBackendMetrics(apiURL string) *bitwardenBackendMetrics {
+	labels := make(map[string]string, len(bitwardenLabelNames))
+	labels["bitwarden_api_url"] = apiURL
+
+	return &bitwardenBackendMetrics{labels: labels}
+}
+
+func (m *bitwardenBackendMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	bitwardenSecretReadErrorsTotal.WithLabelValues(
+		m.labels["bitwarden_api_url"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *bitwardenBackendMetrics) updateLoginErrorsTotalMetric() {
+	bitwardenLoginErrorsTotal.WithLabelValues(
+		m.labels["bitwarden_api_url"],
+	).Inc()
+}
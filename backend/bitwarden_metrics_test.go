@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeBitwardenAPIURL = "https://api.bitwarden.com"
+
+func TestBitwardenUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newBitwardenBackendMetrics(fakeBitwardenAPIURL)
+	bitwardenLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := bitwardenLoginErrorsTotal.GetMetricWithLabelValues(fakeBitwardenAPIURL)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestBitwardenUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "be8e0ad8-d545-4017-a55a-b02f014d4158"
+	key := "key"
+
+	metrics := newBitwardenBackendMetrics(fakeBitwardenAPIURL)
+	bitwardenSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := bitwardenSecretReadErrorsTotal.GetMetricWithLabelValues(fakeBitwardenAPIURL, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -0,0 +1,249 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const (
+	conjurAPIKeyAuthMethod          = "api-key"
+	conjurJWTAuthMethod             = "jwt"
+	conjurAPIKeyAuthURLTemplate     = "%s/authn/%s/%s/authenticate"
+	conjurJWTAuthURLTemplate        = "%s/authn-jwt/%s/%s/authenticate"
+	conjurJWTHostAuthURLTemplate    = "%s/authn-jwt/%s/%s/%s/authenticate"
+	conjurSecretURLTemplate         = "%s/secrets/%s/variable/%s"
+	conjurAuthorizationTemplate     = "Token token=\"%s\""
+	conjurDefaultTokenRefreshPeriod = 6 * time.Minute
+)
+
+type conjurClient struct {
+	httpClient         *http.Client
+	url                string
+	account            string
+	authMethod         string
+	login              string
+	apiKey             string
+	jwtServiceID       string
+	jwtHostID          string
+	jwtTokenFile       string
+	tokenRefreshPeriod time.Duration
+	token              string
+	tokenMutex         sync.RWMutex
+	metrics            *conjurBackendMetrics
+	context            context.Context
+	logger             logr.Logger
+}
+
+func conjurBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*conjurClient, error) {
+	logger := l.WithName("conjur").WithValues(
+		"conjur_url", cfg.ConjurURL,
+		"conjur_account", cfg.ConjurAccount,
+		"conjur_auth_method", cfg.ConjurAuthMethod)
+
+	metrics := newConjurMetrics(cfg.ConjurURL, cfg.ConjurAccount)
+
+	switch cfg.ConjurAuthMethod {
+	case conjurAPIKeyAuthMethod, conjurJWTAuthMethod:
+	default:
+		return nil, fmt.Errorf("unsupported Conjur authentication method %s", cfg.ConjurAuthMethod)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ConjurCAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.ConjurCAFile)
+		if err != nil {
+			logger.Error(err, "unable to read Conjur CA certificate")
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in Conjur CA file %s", cfg.ConjurCAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	tokenRefreshPeriod := cfg.ConjurTokenRefreshPeriod
+	if tokenRefreshPeriod <= 0 {
+		tokenRefreshPeriod = conjurDefaultTokenRefreshPeriod
+	}
+
+	client := conjurClient{
+		httpClient:         &http.Client{Transport: transport, Timeout: cfg.BackendTimeout},
+		url:                strings.TrimSuffix(cfg.ConjurURL, "/"),
+		account:            cfg.ConjurAccount,
+		authMethod:         cfg.ConjurAuthMethod,
+		login:              cfg.ConjurLogin,
+		apiKey:             cfg.ConjurAPIKey,
+		jwtServiceID:       cfg.ConjurJWTServiceID,
+		jwtHostID:          cfg.ConjurJWTHostID,
+		jwtTokenFile:       cfg.ConjurJWTTokenFile,
+		tokenRefreshPeriod: tokenRefreshPeriod,
+		metrics:            metrics,
+		context:            ctx,
+		logger:             logger,
+	}
+
+	if err := client.conjurLogin(); err != nil {
+		logger.Error(err, "unable to login to Conjur with provided credentials")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully logged into Conjur")
+
+	return &client, nil
+}
+
+// conjurLogin gets a new access token from the selected authenticator. Conjur
+// access tokens are only valid for 8 minutes, so they're never cached on disk.
+func (c *conjurClient) conjurLogin() error {
+	var authURL string
+	var body string
+	var contentType string
+
+	switch c.authMethod {
+	case conjurJWTAuthMethod:
+		// The projected service account token is read on every login, as kubelet rotates it
+		jwt, err := ioutil.ReadFile(c.jwtTokenFile)
+		if err != nil {
+			return err
+		}
+		authURL = fmt.Sprintf(conjurJWTAuthURLTemplate, c.url, url.PathEscape(c.jwtServiceID), url.PathEscape(c.account))
+		if c.jwtHostID != "" {
+			authURL = fmt.Sprintf(conjurJWTHostAuthURLTemplate, c.url, url.PathEscape(c.jwtServiceID), url.PathEscape(c.account), url.PathEscape(c.jwtHostID))
+		}
+		body = url.Values{"jwt": {strings.TrimSpace(string(jwt))}}.Encode()
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		authURL = fmt.Sprintf(conjurAPIKeyAuthURLTemplate, c.url, url.PathEscape(c.account), url.PathEscape(c.login))
+		body = c.apiKey
+		contentType = "text/plain"
+	}
+
+	req, err := http.NewRequestWithContext(c.context, http.MethodPost, authURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// Conjur returns the access token already base64 encoded, as expected in the Authorization header
+	req.Header.Set("Accept-Encoding", "base64")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d authenticating to Conjur", resp.StatusCode)
+	}
+
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	c.tokenMutex.Lock()
+	c.token = string(token)
+	c.tokenMutex.Unlock()
+	return nil
+}
+
+func (c *conjurClient) startTokenRefresher(ctx context.Context) {
+	go func(ctx context.Context) {
+		for {
+			select {
+			case <-time.After(c.tokenRefreshPeriod):
+				if err := c.conjurLogin(); err != nil {
+					c.metrics.updateLoginErrorsTotalMetric()
+					c.logger.Error(err, "login error, Conjur access token not refreshed")
+				} else {
+					c.logger.V(1).Info("Conjur access token refreshed")
+				}
+			case <-ctx.Done():
+				c.logger.Info("gracefully shutting down token refresh go routine")
+				return
+			}
+		}
+	}(ctx)
+}
+
+func (c *conjurClient) getSecret(id string) (*http.Response, error) {
+	secretURL := fmt.Sprintf(conjurSecretURLTemplate, c.url, url.PathEscape(c.account), url.PathEscape(id))
+	req, err := http.NewRequestWithContext(c.context, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.tokenMutex.RLock()
+	req.Header.Set("Authorization", fmt.Sprintf(conjurAuthorizationTemplate, c.token))
+	c.tokenMutex.RUnlock()
+	return c.httpClient.Do(req)
+}
+
+// ReadSecret reads the Conjur variable whose ID is path. If key is set, the variable
+// is expected to hold a JSON object and the value of that field is returned.
+func (c *conjurClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	resp, err := c.getSecret(path)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// The access token expired before being refreshed, login again and retry once
+		resp.Body.Close()
+		c.logger.Info("Conjur access token rejected, trying to login again")
+		if err = c.conjurLogin(); err != nil {
+			c.metrics.updateLoginErrorsTotalMetric()
+		} else {
+			resp, err = c.getSecret(path)
+		}
+	}
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+		return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+	case http.StatusForbidden:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+		return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+	default:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected status code %d reading Conjur variable %s", resp.StatusCode, path)}
+	}
+
+	value, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	if key == "" {
+		return string(value), nil
+	}
+
+	data, err = getJSONField(path, key, string(value))
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
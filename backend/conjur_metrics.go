@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	conjurLabelNames            = []string{"conjur_url", "conjur_account"}
+	conjurSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "conjur",
+		Name:      "read_secret_errors_total",
+		Help:      "Conjur read operations counter",
+	}, append(conjurLabelNames, secretLabelNames...))
+	conjurLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "conjur",
+		Name:      "login_errors_total",
+		Help:      "Conjur login errors counter",
+	}, conjurLabelNames)
+)
+
+type conjurBackendMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(conjurSecretReadErrorsTotal)
+	r.MustRegister(conjurLoginErrorsTotal)
+}
+
+func newConjurMetrics(url string, account string) *conjurBackendMetrics {
+	labels := make(map[string]string, len(conjurLabelNames))
+	labels["conjur_url"] = url
+	labels["conjur_account"] = account
+
+	return &conjurBackendMetrics{labels: labels}
+}
+
+func (m *conjurBackendMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	conjurSecretReadErrorsTotal.WithLabelValues(
+		m.labels["conjur_url"],
+		m.labels["conjur_account"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *conjurBackendMetrics) updateLoginErrorsTotalMetric() {
+	conjurLoginErrorsTotal.WithLabelValues(
+		m.labels["conjur_url"],
+		m.labels["conjur_account"],
+	).Inc()
+}
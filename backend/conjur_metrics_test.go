@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeConjurURL = "https://conjur.example.com"
+
+func TestConjurUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newConjurMetrics(fakeConjurURL, fakeConjurAccount)
+	conjurLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := conjurLoginErrorsTotal.GetMetricWithLabelValues(fakeConjurURL, fakeConjurAccount)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestConjurUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "pci/db/config"
+	key := "key"
+
+	metrics := newConjurMetrics(fakeConjurURL, fakeConjurAccount)
+	conjurSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := conjurSecretReadErrorsTotal.GetMetricWithLabelValues(fakeConjurURL, fakeConjurAccount, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+type consulKVClient struct {
+	kv      *consul.KV
+	metrics *consulKVMetrics
+	context context.Context
+	logger  logr.Logger
+}
+
+func consulKVBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*consulKVClient, error) {
+	logger := l.WithName("consul").WithValues(
+		"consul_address", cfg.ConsulAddress,
+		"consul_datacenter", cfg.ConsulDatacenter)
+
+	metrics := newConsulKVMetrics(cfg.ConsulAddress, cfg.ConsulDatacenter)
+
+	tlsConfig := consul.TLSConfig{
+		Address:            cfg.ConsulTLSServerName,
+		CAFile:             cfg.ConsulCAFile,
+		CertFile:           cfg.ConsulClientCertFile,
+		KeyFile:            cfg.ConsulClientKeyFile,
+		InsecureSkipVerify: cfg.ConsulTLSSkipVerify,
+	}
+
+	httpClient, err := consul.NewHttpClient(consul.DefaultConfig().Transport, tlsConfig)
+	if err != nil {
+		logger.Error(err, "unable to setup consul TLS configuration")
+		return nil, err
+	}
+	httpClient.Timeout = cfg.BackendTimeout
+
+	cclient, err := consul.NewClient(&consul.Config{
+		Address:    cfg.ConsulAddress,
+		Datacenter: cfg.ConsulDatacenter,
+		Token:      cfg.ConsulToken,
+		HttpClient: httpClient,
+	})
+	if err != nil {
+		logger.Error(err, "unable to create consul api client")
+		return nil, err
+	}
+
+	// Check connectivity on startup, the status endpoint doesn't require any ACL
+	leader, err := cclient.Status().Leader()
+	if err != nil {
+		logger.Error(err, "could not get leader information about consul cluster")
+		metrics.updateConnectionErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to Consul", "consul_leader", leader)
+
+	client := consulKVClient{
+		kv:      cclient.KV(),
+		metrics: metrics,
+		context: ctx,
+		logger:  logger,
+	}
+
+	return &client, nil
+}
+
+// ReadSecret reads the Consul KV key at path. If key is set, the value is expected
+// to be a JSON document and the value of that field is returned.
+func (c *consulKVClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	q := &consul.QueryOptions{}
+	pair, _, err := c.kv.Get(path, q.WithContext(c.context))
+	if err != nil {
+		if statusErr, ok := err.(consul.StatusError); ok && statusErr.Code == http.StatusForbidden {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+			return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	if pair == nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+		return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+	}
+
+	if key == "" {
+		return string(pair.Value), nil
+	}
+
+	data, err = getJSONField(path, key, string(pair.Value))
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
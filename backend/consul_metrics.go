@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	consulLabelNames            = []string{"consul_address", "consul_datacenter"}
+	consulSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "consul",
+		Name:      "read_secret_errors_total",
+		Help:      "Consul KV read operations counter",
+	}, append(consulLabelNames, secretLabelNames...))
+	consulConnectionErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "consul",
+		Name:      "connection_errors_total",
+		Help:      "Consul connection errors counter",
+	}, consulLabelNames)
+)
+
+type consulKVMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(consulSecretReadErrorsTotal)
+	r.MustRegister(consulConnectionErrorsTotal)
+}
+
+func newConsulKVMetrics(address string, datacenter string) *consulKVMetrics {
+	labels := make(map[string]string, len(consulLabelNames))
+	labels["consul_address"] = address
+	labels["consul_datacenter"] = datacenter
+
+	return &consulKVMetrics{labels: labels}
+}
+
+func (m *consulKVMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	consulSecretReadErrorsTotal.WithLabelValues(
+		m.labels["consul_address"],
+		m.labels["consul_datacenter"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *consulKVMetrics) updateConnectionErrorsTotalMetric() {
+	consulConnectionErrorsTotal.WithLabelValues(
+		m.labels["consul_address"],
+		m.labels["consul_datacenter"],
+	).Inc()
+}
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeConsulAddress = "https://127.0.0.1:8501"
+
+func TestConsulKVUpdateConnectionErrorsTotal(t *testing.T) {
+	metrics := newConsulKVMetrics(fakeConsulAddress, fakeConsulDatacenter)
+	consulConnectionErrorsTotal.Reset()
+	metrics.updateConnectionErrorsTotalMetric()
+	metricConnectionErrors, _ := consulConnectionErrorsTotal.GetMetricWithLabelValues(fakeConsulAddress, fakeConsulDatacenter)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricConnectionErrors))
+}
+
+func TestConsulKVUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "legacy/app/database"
+	key := "key"
+
+	metrics := newConsulKVMetrics(fakeConsulAddress, fakeConsulDatacenter)
+	consulSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := consulSecretReadErrorsTotal.GetMetricWithLabelValues(fakeConsulAddress, fakeConsulDatacenter, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
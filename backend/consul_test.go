@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const (
+	fakeConsulDatacenter = "dc1"
+	fakeConsulToken      = "b1gs33cr3t"
+)
+
+var consulKVPairs = map[string]string{
+	"legacy/app/password": "s3cr3t",
+	"legacy/app/database": `{"user":"admin","password":"s3cr3t","port":5432}`,
+}
+
+func consulStatusLeader(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode("127.0.0.1:8300")
+}
+
+func consulKVGet(w http.ResponseWriter, r *http.Request) {
+	// Info about the Consul KV API extracted from
+	// https://www.consul.io/api-docs/kv#read-key
+	if r.Header.Get("X-Consul-Token") != fakeConsulToken {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("ACL not found"))
+		return
+	}
+	key := mux.Vars(r)["key"]
+	value, ok := consulKVPairs[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Consul-Index", "42")
+	json.NewEncoder(w).Encode([]map[string]interface{}{
+		{
+			"Key":         key,
+			"Value":       []byte(value),
+			"Flags":       0,
+			"CreateIndex": 42,
+			"ModifyIndex": 42,
+			"LockIndex":   0,
+		},
+	})
+}
+
+func newFakeConsulConfig() Config {
+	return Config{
+		ConsulAddress:    testingCfg.VaultURL,
+		ConsulDatacenter: fakeConsulDatacenter,
+		ConsulToken:      fakeConsulToken,
+	}
+}
+
+func TestConsulKVBackendClient(t *testing.T) {
+	cfg := newFakeConsulConfig()
+	cfg.ConsulCAFile = "/not/found/ca.pem"
+	client, err := consulKVBackendClient(context.TODO(), logger, cfg)
+	assert.NotNilf(t, err, "Missing CA file should generate an error")
+	assert.Nil(t, client)
+
+	client, err = consulKVBackendClient(context.TODO(), logger, newFakeConsulConfig())
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestConsulKVClientReadSecret(t *testing.T) {
+	cfg := newFakeConsulConfig()
+	client, err := consulKVBackendClient(context.TODO(), logger, cfg)
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("legacy/app/password", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("legacy/app/database", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+
+	value, err = client.ReadSecret("legacy/app/database", "port")
+	assert.Nil(t, err)
+	assert.Equal(t, "5432", value)
+
+	consulSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("legacy/app/not-found", "")
+	metricSecretReadErrorsTotal, _ := consulSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.ConsulAddress, fakeConsulDatacenter, "legacy/app/not-found", "", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	consulSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("legacy/app/database", "not-found")
+	metricSecretReadErrorsTotal, _ = consulSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.ConsulAddress, fakeConsulDatacenter, "legacy/app/database", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	cfg.ConsulToken = "wrong-token"
+	client, err = consulKVBackendClient(context.TODO(), logger, cfg)
+	assert.Nil(t, err)
+
+	consulSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("legacy/app/password", "")
+	metricSecretReadErrorsTotal, _ = consulSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.ConsulAddress, fakeConsulDatacenter, "legacy/app/password", "", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
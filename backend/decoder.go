@@ -32,6 +32,15 @@ type TextDecoder struct {
 	Encoding string
 }
 
+// TransitDecoder represents a Decoder decrypting its input with a TransitClient, and then
+// decoding the plaintext with the Decoder of its encoding
+type TransitDecoder struct {
+	Client  TransitClient
+	Mount   string
+	Key     string
+	Decoder Decoder
+}
+
 // DecodeString for Base64Decoder will get the text version (in bytes) of the input base64 text
 func (d Base64Decoder) DecodeString(input string) ([]byte, error) {
 	data, err := base64.StdEncoding.DecodeString(input)
@@ -46,6 +55,15 @@ func (d TextDecoder) DecodeString(input string) ([]byte, error) {
 	return []byte(input), nil
 }
 
+// DecodeString for TransitDecoder will decrypt the input ciphertext and decode the plaintext
+func (d TransitDecoder) DecodeString(input string) ([]byte, error) {
+	plaintext, err := d.Client.Decrypt(d.Mount, d.Key, input)
+	if err != nil {
+		return nil, err
+	}
+	return d.Decoder.DecodeString(string(plaintext))
+}
+
 // NewDecoder returns a new Decoder implementation or an error if the provided encoding is not implemented
 func NewDecoder(encoding string) (Decoder, error) {
 	if encoding == "" {
@@ -0,0 +1,226 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+	"sigs.k8s.io/yaml"
+)
+
+type fileClient struct {
+	root    string
+	watcher *fsnotify.Watcher
+	cache   map[string][]byte
+	mutex   sync.RWMutex
+	metrics *fileBackendMetrics
+	context context.Context
+	logger  logr.Logger
+}
+
+func fileBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*fileClient, error) {
+	logger := l.WithName("file").WithValues("file_root", cfg.FileRoot)
+
+	metrics := newFileBackendMetrics(cfg.FileRoot)
+
+	if cfg.FileRoot == "" {
+		return nil, fmt.Errorf("a root directory is required by the %s backend", fileBackendName)
+	}
+
+	root, err := filepath.Abs(cfg.FileRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Mounted volumes are usually made of symlinks, so the root is resolved
+	// once and every secret path is checked against it
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("file backend root %s is not a directory", cfg.FileRoot)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	client := fileClient{
+		root:    root,
+		watcher: watcher,
+		cache:   make(map[string][]byte),
+		metrics: metrics,
+		context: ctx,
+		logger:  logger,
+	}
+
+	if err = client.watchDir(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	client.startWatcher(ctx)
+
+	logger.Info("Local files will be used as backend")
+
+	return &client, nil
+}
+
+// watchDir adds an inotify watch for dir and all its subdirectories
+func (c *fileClient) watchDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return c.watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// startWatcher drops the cached files whenever something changes under the root directory.
+// The whole cache is invalidated, as a single change like the atomic update of a mounted
+// volume can affect many files at once.
+func (c *fileClient) startWatcher(ctx context.Context) {
+	go func() {
+		defer c.watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-c.watcher.Events:
+				if !ok {
+					return
+				}
+				c.logger.V(1).Info("file change detected, invalidating cache", "file", event.Name, "operation", event.Op.String())
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err = c.watchDir(event.Name); err != nil {
+							c.logger.Error(err, "unable to watch directory", "directory", event.Name)
+						}
+					}
+				}
+				c.invalidateCache()
+			case err, ok := <-c.watcher.Errors:
+				if !ok {
+					return
+				}
+				c.logger.Error(err, "file watcher error, invalidating cache")
+				c.metrics.updateWatchErrorsTotalMetric()
+				c.invalidateCache()
+			}
+		}
+	}()
+}
+
+func (c *fileClient) invalidateCache() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache = make(map[string][]byte)
+}
+
+// resolvePath returns the absolute path of name, refusing any path that
+// ends up outside the root directory, symlinks included.
+func (c *fileClient) resolvePath(name string) (string, error) {
+	path := filepath.Join(c.root, filepath.FromSlash(name))
+	if !c.inRoot(path) {
+		return "", os.ErrPermission
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !c.inRoot(resolved) {
+		return "", os.ErrPermission
+	}
+	return resolved, nil
+}
+
+func (c *fileClient) inRoot(path string) bool {
+	return path == c.root || strings.HasPrefix(path, c.root+string(filepath.Separator))
+}
+
+func (c *fileClient) readFile(path string) ([]byte, error) {
+	c.mutex.RLock()
+	content, ok := c.cache[path]
+	c.mutex.RUnlock()
+	if ok {
+		return content, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.cache[path] = content
+	c.mutex.Unlock()
+	return content, nil
+}
+
+// ReadSecret reads the file at path, relative to the root directory. If path is a directory,
+// key is the name of the file to read inside it. If path is a file, key selects a top level
+// field of its JSON or YAML content, and an empty key returns the whole file.
+func (c *fileClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	field := key
+	file, err := c.resolvePath(path)
+	if err == nil {
+		var info os.FileInfo
+		info, err = os.Stat(file)
+		if err == nil && info.IsDir() {
+			file, err = c.resolvePath(filepath.Join(path, key))
+			field = ""
+		}
+	}
+
+	var content []byte
+	if err == nil {
+		content, err = c.readFile(file)
+	}
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+			return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+		}
+		if os.IsPermission(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+			return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	if field == "" {
+		return string(content), nil
+	}
+
+	document, err := yaml.YAMLToJSON(content)
+	if err == nil {
+		data, err = getJSONField(path, field, string(document))
+	}
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	fileLabelNames            = []string{"file_root"}
+	fileSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "file",
+		Name:      "read_secret_errors_total",
+		Help:      "File backend read operations counter",
+	}, append(fileLabelNames, secretLabelNames...))
+	fileWatchErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "file",
+		Name:      "watch_errors_total",
+		Help:      "File backend watcher errors counter",
+	}, fileLabelNames)
+)
+
+type fileBackendMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(fileSecretReadErrorsTotal)
+	r.MustRegister(fileWatchErrorsTotal)
+}
+
+func newFileBackendMetrics(root string) *fileBackendMetrics {
+	labels := make(map[string]string, len(fileLabelNames))
+	labels["file_root"] = root
+
+	return &fileBackendMetrics{labels: labels}
+}
+
+func (m *fileBackendMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	fileSecretReadErrorsTotal.WithLabelValues(
+		m.labels["file_root"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *fileBackendMetrics) updateWatchErrorsTotalMetric() {
+	fileWatchErrorsTotal.WithLabelValues(
+		m.labels["file_root"],
+	).Inc()
+}
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeFileRoot = "/etc/secrets"
+
+func TestFileUpdateWatchErrorsTotal(t *testing.T) {
+	metrics := newFileBackendMetrics(fakeFileRoot)
+	fileWatchErrorsTotal.Reset()
+	metrics.updateWatchErrorsTotalMetric()
+	metricWatchErrors, _ := fileWatchErrorsTotal.GetMetricWithLabelValues(fakeFileRoot)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricWatchErrors))
+}
+
+func TestFileUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "app/config.yaml"
+	key := "key"
+
+	metrics := newFileBackendMetrics(fakeFileRoot)
+	fileSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := fileSecretReadErrorsTotal.GetMetricWithLabelValues(fakeFileRoot, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
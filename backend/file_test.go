@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func newFakeFileRoot(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "secrets")
+	writeTestFile(t, filepath.Join(root, "app", "password"), "s3cr3t")
+	writeTestFile(t, filepath.Join(root, "app", "config.json"), `{"user":"admin","port":5432}`)
+	writeTestFile(t, filepath.Join(root, "app", "config.yaml"), "user: admin\nport: 5432\n")
+	writeTestFile(t, filepath.Join(dir, "outside"), "not for you")
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "outside"), filepath.Join(root, "app", "escape")))
+	return dir, root
+}
+
+func TestFileBackendClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir, root := newFakeFileRoot(t)
+
+	client, err := fileBackendClient(ctx, logger, Config{})
+	assert.NotNilf(t, err, "Missing root should generate an error")
+	assert.Nil(t, client)
+
+	client, err = fileBackendClient(ctx, logger, Config{FileRoot: filepath.Join(dir, "not-found")})
+	assert.NotNilf(t, err, "Non existing root should generate an error")
+	assert.Nil(t, client)
+
+	client, err = fileBackendClient(ctx, logger, Config{FileRoot: filepath.Join(dir, "outside")})
+	assert.NotNilf(t, err, "A root that is not a directory should generate an error")
+	assert.Nil(t, client)
+
+	client, err = fileBackendClient(ctx, logger, Config{FileRoot: root})
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestFileClientReadSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, root := newFakeFileRoot(t)
+
+	client, err := fileBackendClient(ctx, logger, Config{FileRoot: root})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("app/password", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("app", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("app/config.json", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+
+	value, err = client.ReadSecret("app/config.yaml", "port")
+	assert.Nil(t, err)
+	assert.Equal(t, "5432", value)
+
+	fileSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("app/config.yaml", "not-found")
+	metricSecretReadErrorsTotal, _ := fileSecretReadErrorsTotal.GetMetricWithLabelValues(root, "app/config.yaml", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	fileSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("app", "not-found")
+	metricSecretReadErrorsTotal, _ = fileSecretReadErrorsTotal.GetMetricWithLabelValues(root, "app", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	for _, secret := range []struct{ path, key string }{
+		{"../outside", ""},
+		{"app/../../outside", ""},
+		{"app", "../../outside"},
+		{"app/escape", ""},
+		{"app", "escape"},
+	} {
+		fileSecretReadErrorsTotal.Reset()
+		value, err = client.ReadSecret(secret.path, secret.key)
+		metricSecretReadErrorsTotal, _ = fileSecretReadErrorsTotal.GetMetricWithLabelValues(root, secret.path, secret.key, errors.BackendSecretForbiddenErrorType)
+		assert.Equal(t, "", value)
+		assert.Truef(t, errors.IsBackendSecretForbidden(err), "reading %s %s outside the root should be forbidden", secret.path, secret.key)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+	}
+}
+
+func TestFileClientWatchChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, root := newFakeFileRoot(t)
+
+	client, err := fileBackendClient(ctx, logger, Config{FileRoot: root})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("app/password", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	writeTestFile(t, filepath.Join(root, "app", "password"), "n3w-s3cr3t")
+	writeTestFile(t, filepath.Join(root, "other", "token"), "t0k3n")
+
+	assert.Eventually(t, func() bool {
+		value, err := client.ReadSecret("app/password", "")
+		return err == nil && value == "n3w-s3cr3t"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		value, err := client.ReadSecret("other", "token")
+		return err == nil && value == "t0k3n"
+	}, 5*time.Second, 50*time.Millisecond)
+}
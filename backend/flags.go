@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// BindFlags binds the flags configuring a backend to cfg, so that every
+// named backend and store can be configured with the same flags as the default one
+func BindFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.DurationVar(&cfg.BackendTimeout, "config.backend-timeout", 5*time.Second, "Backend connection timeout")
+	fs.StringVar(&cfg.VaultURL, "vault.url", "https://127.0.0.1:8200", "Vault address. VAULT_ADDR environment would take precedence.")
+	fs.StringVar(&cfg.VaultAuthMethod, "vault.auth-method", "approle", "Vault authentication method. Supported: approle, kubernetes, cert, jwt, token-file.")
+	fs.StringVar(&cfg.VaultRoleID, "vault.role-id", "", "Vault approle role id. VAULT_ROLE_ID environment would take precedence.")
+	fs.StringVar(&cfg.VaultSecretID, "vault.secret-id", "", "Vault approle secret id. VAULT_SECRET_ID environment would take precedence.")
+	fs.StringVar(&cfg.VaultKubernetesRole, "vault.kubernetes-role", "", "Vault kubernetes role name.")
+	fs.Int64Var(&cfg.VaultMaxTokenTTL, "vault.max-token-ttl", 300, "Max seconds to consider a token expired.")
+	fs.DurationVar(&cfg.VaultTokenPollingPeriod, "vault.token-polling-period", 15*time.Second, "Polling interval to check token expiration time.")
+	fs.IntVar(&cfg.VaultRenewTTLIncrement, "vault.renew-ttl-increment", 600, "TTL time for renewed token.")
+	fs.StringVar(&cfg.VaultEngine, "vault.engine", "kv2", "Vault secret engine used when the mount of a path can't be looked up. One of kv1, kv2, or the dynamic secrets engines database, aws and rabbitmq")
+	fs.StringVar(&cfg.VaultApprolePath, "vault.approle-path", "approle", "Vault approle login path")
+	fs.StringVar(&cfg.VaultKubernetesPath, "vault.kubernetes-path", "kubernetes", "Vault kubernetes login path")
+	fs.StringVar(&cfg.VaultCertRole, "vault.cert-role", "", "Vault cert auth role name. By default Vault tries all the roles matching the client certificate")
+	fs.StringVar(&cfg.VaultCertPath, "vault.cert-path", "cert", "Vault cert login path")
+	fs.StringVar(&cfg.VaultJWTRole, "vault.jwt-role", "", "Vault jwt auth role name")
+	fs.StringVar(&cfg.VaultJWTPath, "vault.jwt-path", "jwt", "Vault jwt login path")
+	fs.StringVar(&cfg.VaultJWTTokenFile, "vault.jwt-token-file", "", "Path to the JWT used by the jwt authentication method, like a projected service account token. It's read again on every login")
+	fs.StringVar(&cfg.VaultTokenFile, "vault.token-file", "", "Path to the Vault token used by the token-file authentication method, like a Vault Agent sink file. It's read again whenever it changes")
+	fs.StringVar(&cfg.VaultIdentityServiceAccount, "vault.identity-service-account", "", "Service account whose identity is used to read the secrets of each namespace, logging in with the kubernetes auth method. Disabled if empty")
+	fs.StringVar(&cfg.VaultIdentityRole, "vault.identity-role", "", "Vault kubernetes role used to login as the namespace service account, {namespace} is replaced by its namespace. vault.kubernetes-role by default")
+	fs.StringVar(&cfg.VaultIdentityAudience, "vault.identity-audience", "", "Audience of the namespace service account tokens. The Kubernetes API server one by default")
+	fs.DurationVar(&cfg.VaultIdentityTokenExpiration, "vault.identity-token-expiration", 10*time.Minute, "Expiration of the namespace service account tokens, at least 10m")
+	fs.StringVar(&cfg.VaultNamespace, "vault.namespace", "", "Vault Enterprise namespace to login and read secrets from. VAULT_NAMESPACE environment would take precedence")
+	fs.StringVar(&cfg.VaultCACert, "vault.ca-cert", "", "Path to the PEM CA certificate used to verify the Vault server certificate. VAULT_CACERT environment would take precedence")
+	fs.StringVar(&cfg.VaultCAPath, "vault.ca-path", "", "Path to a directory of PEM CA certificates used to verify the Vault server certificate. VAULT_CAPATH environment would take precedence")
+	fs.StringVar(&cfg.VaultClientCert, "vault.client-cert", "", "Path to the PEM client certificate used for Vault TLS authentication. VAULT_CLIENT_CERT environment would take precedence")
+	fs.StringVar(&cfg.VaultClientKey, "vault.client-key", "", "Path to the PEM client key used for Vault TLS authentication. VAULT_CLIENT_KEY environment would take precedence")
+	fs.StringVar(&cfg.VaultTLSServerName, "vault.tls-server-name", "", "Server name used as SNI and to verify the Vault server certificate. VAULT_TLS_SERVER_NAME environment would take precedence")
+	fs.StringVar(&cfg.VaultTLSMinVersion, "vault.tls-min-version", "1.2", "Minimum TLS version used to connect to Vault. One of 1.0, 1.1, 1.2 or 1.3")
+	fs.StringVar(&cfg.AzureKVName, "azure-kv.name", "", "Azure KeyVault name. AZURE_KV_NAME environment would take precedence")
+	fs.StringVar(&cfg.AzureKVTenantID, "azure-kv.tenant-id", "", "Azure KeyVault Tenant ID. AZURE_TENANT_ID environment would take precedence")
+	fs.StringVar(&cfg.AzureKVClientID, "azure-kv.client-id", "", "Azure KeyVault ClientID used to authenticate. AZURE_CLIENT_ID environment would take precedence")
+	fs.StringVar(&cfg.AzureKVClientSecret, "azure-kv.client-secret", "", "Azure KeyVault Client Secret used to authenticate. AZURE_CLIENT_SECRET environment would take precedence")
+	fs.StringVar(&cfg.AzureKVManagedClientID, "azure-kv.managed-client-id", "", "Azure Managed Identity Client ID used to authenticate. AZURE_MANAGED_CLIENT_ID environment would take precedence")
+	fs.StringVar(&cfg.AzureKVManagedResourceID, "azure-kv.managed-resource-id", "", "Azure Managed Identity Resource ID used to authenticate. AZURE_MANAGED_RESOURCE_ID environment would take precedence")
+	fs.StringVar(&cfg.AzureKVAuthMethod, "azure-kv.auth-method", "", "Azure authentication method. Supported: managed-identity, client-secret, client-certificate, workload-identity. By default, which is deprecated, client-secret")
+	fs.StringVar(&cfg.AzureKVAuthorityHost, "azure-kv.authority-host", "https://login.microsoftonline.com/", "Azure Active Directory authority used by the client-secret, client-certificate and workload-identity authentication methods. AZURE_AUTHORITY_HOST environment would take precedence")
+	fs.StringVar(&cfg.AzureKVFederatedTokenFile, "azure-kv.federated-token-file", "", "Path to the service account token used by the workload-identity authentication method. AZURE_FEDERATED_TOKEN_FILE environment would take precedence")
+	fs.StringVar(&cfg.AzureKVClientCertificateFile, "azure-kv.client-certificate-file", "", "Path to the PEM or PKCS12 certificate, with its private key, used by the client-certificate authentication method. AZURE_CLIENT_CERTIFICATE_PATH environment would take precedence")
+	fs.StringVar(&cfg.AzureKVClientCertificatePassword, "azure-kv.client-certificate-password", "", "Password of the PKCS12 client certificate. AZURE_CLIENT_CERTIFICATE_PASSWORD environment would take precedence")
+	fs.StringVar(&cfg.AWSSMRegion, "aws-sm.region", "", "AWS Secrets Manager region. AWS_REGION environment would take precedence")
+	fs.StringVar(&cfg.AWSSMEndpoint, "aws-sm.endpoint", "", "AWS Secrets Manager endpoint. By default the regional endpoint is used")
+	fs.StringVar(&cfg.AWSSMAuthMethod, "aws-sm.auth-method", "", "AWS authentication method. Supported: static, web-identity, instance-profile. By default the AWS SDK credentials chain is used")
+	fs.StringVar(&cfg.AWSSMAccessKeyID, "aws-sm.access-key-id", "", "AWS access key ID used by the static authentication method. AWS_ACCESS_KEY_ID environment would take precedence")
+	fs.StringVar(&cfg.AWSSMSecretAccessKey, "aws-sm.secret-access-key", "", "AWS secret access key used by the static authentication method. AWS_SECRET_ACCESS_KEY environment would take precedence")
+	fs.StringVar(&cfg.AWSSMRoleARN, "aws-sm.role-arn", "", "AWS IAM role ARN assumed by the web-identity authentication method. AWS_ROLE_ARN environment would take precedence")
+	fs.StringVar(&cfg.AWSSMWebIdentityTokenFile, "aws-sm.web-identity-token-file", "", "Path to the web identity token used by the web-identity authentication method. AWS_WEB_IDENTITY_TOKEN_FILE environment would take precedence")
+	fs.StringVar(&cfg.AWSSSMRegion, "aws-ssm.region", "", "AWS SSM Parameter Store region. AWS_REGION environment would take precedence")
+	fs.StringVar(&cfg.AWSSSMEndpoint, "aws-ssm.endpoint", "", "AWS SSM Parameter Store endpoint. By default the regional endpoint is used")
+	fs.StringVar(&cfg.AWSSSMAuthMethod, "aws-ssm.auth-method", "", "AWS authentication method. Supported: static, web-identity, instance-profile. By default the AWS SDK credentials chain is used")
+	fs.StringVar(&cfg.AWSSSMAccessKeyID, "aws-ssm.access-key-id", "", "AWS access key ID used by the static authentication method. AWS_ACCESS_KEY_ID environment would take precedence")
+	fs.StringVar(&cfg.AWSSSMSecretAccessKey, "aws-ssm.secret-access-key", "", "AWS secret access key used by the static authentication method. AWS_SECRET_ACCESS_KEY environment would take precedence")
+	fs.StringVar(&cfg.AWSSSMRoleARN, "aws-ssm.role-arn", "", "AWS IAM role ARN assumed by the web-identity authentication method. AWS_ROLE_ARN environment would take precedence")
+	fs.StringVar(&cfg.AWSSSMWebIdentityTokenFile, "aws-ssm.web-identity-token-file", "", "Path to the web identity token used by the web-identity authentication method. AWS_WEB_IDENTITY_TOKEN_FILE environment would take precedence")
+	fs.StringVar(&cfg.GCPSMProject, "gcp-sm.project", "", "Google Cloud project used when the secret path is a bare secret name. GOOGLE_CLOUD_PROJECT environment would take precedence")
+	fs.StringVar(&cfg.GCPSMEndpoint, "gcp-sm.endpoint", "https://secretmanager.googleapis.com", "Google Secret Manager API endpoint")
+	fs.StringVar(&cfg.GCPSMAuthMethod, "gcp-sm.auth-method", "", "Google Cloud authentication method. Supported: workload-identity, service-account-key. By default Application Default Credentials are used")
+	fs.StringVar(&cfg.GCPSMCredentialsFile, "gcp-sm.credentials-file", "", "Path to the service account key file used by the service-account-key authentication method. GOOGLE_APPLICATION_CREDENTIALS environment would take precedence")
+	fs.StringVar(&cfg.KubernetesSharedNamespaces, "kubernetes.shared-namespaces", "", "Comma separated list of namespaces whose Secrets can be read by SecretDefinitions of any namespace. Other Secrets can only be read from their own namespace")
+	fs.StringVar(&cfg.FileRoot, "file.root", "", "Root directory the file backend reads secrets from. Secret paths can't point outside of it")
+	fs.StringVar(&cfg.ConsulAddress, "consul.address", "http://127.0.0.1:8500", "Consul address. CONSUL_HTTP_ADDR environment would take precedence")
+	fs.StringVar(&cfg.ConsulDatacenter, "consul.datacenter", "", "Consul datacenter. By default the datacenter of the queried agent is used")
+	fs.StringVar(&cfg.ConsulToken, "consul.token", "", "Consul ACL token. CONSUL_HTTP_TOKEN environment would take precedence")
+	fs.StringVar(&cfg.ConsulCAFile, "consul.ca-file", "", "Path to the CA certificate used to verify the Consul server certificate. CONSUL_CACERT environment would take precedence")
+	fs.StringVar(&cfg.ConsulClientCertFile, "consul.client-cert-file", "", "Path to the client certificate used for Consul TLS authentication. CONSUL_CLIENT_CERT environment would take precedence")
+	fs.StringVar(&cfg.ConsulClientKeyFile, "consul.client-key-file", "", "Path to the client key used for Consul TLS authentication. CONSUL_CLIENT_KEY environment would take precedence")
+	fs.StringVar(&cfg.ConsulTLSServerName, "consul.tls-server-name", "", "Server name used to verify the Consul server certificate. CONSUL_TLS_SERVER_NAME environment would take precedence")
+	fs.BoolVar(&cfg.ConsulTLSSkipVerify, "consul.tls-skip-verify", false, "Disable verification of the Consul server certificate")
+	fs.StringVar(&cfg.ConjurURL, "conjur.url", "", "Conjur appliance URL. CONJUR_APPLIANCE_URL environment would take precedence")
+	fs.StringVar(&cfg.ConjurAccount, "conjur.account", "", "Conjur organization account. CONJUR_ACCOUNT environment would take precedence")
+	fs.StringVar(&cfg.ConjurAuthMethod, "conjur.auth-method", "api-key", "Conjur authentication method. Supported: api-key, jwt")
+	fs.StringVar(&cfg.ConjurLogin, "conjur.login", "", "Conjur host or user login used by the api-key authentication method. CONJUR_AUTHN_LOGIN environment would take precedence")
+	fs.StringVar(&cfg.ConjurAPIKey, "conjur.api-key", "", "Conjur API key used by the api-key authentication method. CONJUR_AUTHN_API_KEY environment would take precedence")
+	fs.StringVar(&cfg.ConjurJWTServiceID, "conjur.jwt-service-id", "", "Service ID of the Conjur authn-jwt authenticator used by the jwt authentication method. CONJUR_AUTHN_JWT_SERVICE_ID environment would take precedence")
+	fs.StringVar(&cfg.ConjurJWTHostID, "conjur.jwt-host-id", "", "Conjur host ID used by the jwt authentication method, if the authenticator doesn't infer it from the token")
+	fs.StringVar(&cfg.ConjurJWTTokenFile, "conjur.jwt-token-file", "/var/run/secrets/kubernetes.io/serviceaccount/token", "Path to the JWT used by the jwt authentication method. JWT_TOKEN_PATH environment would take precedence")
+	fs.StringVar(&cfg.ConjurCAFile, "conjur.ca-file", "", "Path to the CA certificate used to verify the Conjur server certificate. CONJUR_CERT_FILE environment would take precedence")
+	fs.DurationVar(&cfg.ConjurTokenRefreshPeriod, "conjur.token-refresh-period", 6*time.Minute, "How often the Conjur access token is refreshed. Conjur access tokens expire after 8 minutes")
+	fs.StringVar(&cfg.OnePasswordURL, "onepassword.url", "http://127.0.0.1:8080", "1Password Connect server URL. OP_CONNECT_HOST environment would take precedence")
+	fs.StringVar(&cfg.OnePasswordToken, "onepassword.token", "", "1Password Connect access token. OP_CONNECT_TOKEN environment would take precedence")
+	fs.StringVar(&cfg.SopsRoot, "sops.root", "", "Root directory of the SOPS encrypted files")
+	fs.StringVar(&cfg.SopsAgeKeyFile, "sops.age-key-file", "", "File with the age identities used to decrypt SOPS files. SOPS_AGE_KEY_FILE environment would take precedence")
+	fs.StringVar(&cfg.SopsPGPKeyFile, "sops.pgp-key-file", "", "File with the armored PGP private keys used to decrypt SOPS files")
+	fs.StringVar(&cfg.SopsKeysSecret, "sops.keys-secret", "", "Secret, in namespace/name form, with the age identities or PGP private keys (.asc entries) used to decrypt SOPS files")
+	fs.StringVar(&cfg.BitwardenAPIURL, "bitwarden.api-url", "https://api.bitwarden.com", "Bitwarden API URL, https://<host>/api for self-hosted servers")
+	fs.StringVar(&cfg.BitwardenIdentityURL, "bitwarden.identity-url", "https://identity.bitwarden.com", "Bitwarden identity URL, https://<host>/identity for self-hosted servers")
+	fs.StringVar(&cfg.BitwardenAccessToken, "bitwarden.access-token", "", "Bitwarden Secrets Manager machine account access token. BWS_ACCESS_TOKEN environment would take precedence")
+}
+
+// ConfigFromFlags returns a copy of base with the backend flags set to their
+// defaults, overridden by flags, which is keyed by flag name like vault.url
+func ConfigFromFlags(base Config, flags map[string]string) (Config, error) {
+	cfg := base
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	BindFlags(fs, &cfg)
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return cfg, fmt.Errorf("invalid flag %s: %v", name, err)
+		}
+	}
+	return cfg, nil
+}
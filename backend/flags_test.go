@@ -0,0 +1,39 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromFlags(t *testing.T) {
+	base := Config{
+		VaultURL:          "https://vault.example.com",
+		ExcludeNamespaces: map[string]bool{"kube-system": true},
+	}
+	cfg, err := ConfigFromFlags(base, map[string]string{
+		"vault.auth-method":      "kubernetes",
+		"vault.max-token-ttl":    "60",
+		"config.backend-timeout": "10s",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "kubernetes", cfg.VaultAuthMethod)
+	assert.Equal(t, int64(60), cfg.VaultMaxTokenTTL)
+	assert.Equal(t, 10*time.Second, cfg.BackendTimeout)
+	// Flags not set take their default value, not the base one
+	assert.Equal(t, "https://127.0.0.1:8200", cfg.VaultURL)
+	assert.Equal(t, "kv2", cfg.VaultEngine)
+	// Fields without flag are kept
+	assert.True(t, cfg.ExcludeNamespaces["kube-system"])
+	// The base config is not modified
+	assert.Equal(t, "https://vault.example.com", base.VaultURL)
+}
+
+func TestConfigFromFlagsInvalid(t *testing.T) {
+	_, err := ConfigFromFlags(Config{}, map[string]string{"vault.not-a-flag": "foo"})
+	assert.NotNil(t, err)
+
+	_, err = ConfigFromFlags(Config{}, map[string]string{"vault.max-token-ttl": "foo"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcpSMDefaultEndpoint                = "https://secretmanager.googleapis.com"
+	gcpSMDefaultVersion                 = "latest"
+	gcpWorkloadIdentityAuthMethod       = "workload-identity"
+	gcpServiceAccountKeyAuthMethod      = "service-account-key"
+	gcpCloudPlatformScope               = "https://www.googleapis.com/auth/cloud-platform"
+	gcpSMProjectsPrefix                 = "projects/"
+	gcpSMVersionsSeparator              = "/versions/"
+	gcpSMAccessSecretVersionURLTemplate = "%s/v1/%s:access"
+)
+
+type gcpSecretManagerClient struct {
+	httpClient *http.Client
+	endpoint   string
+	project    string
+	metrics    *gcpSecretManagerMetrics
+	context    context.Context
+	logger     logr.Logger
+}
+
+type gcpSMAccessSecretVersionResponse struct {
+	Name    string `json:"name"`
+	Payload struct {
+		Data string `json:"data"`
+	} `json:"payload"`
+}
+
+// getGCPTokenSource builds the OAuth2 token source for the selected authentication method.
+// An empty authentication method uses Google Application Default Credentials.
+func getGCPTokenSource(ctx context.Context, logger logr.Logger, cfg Config) (oauth2.TokenSource, error) {
+	switch cfg.GCPSMAuthMethod {
+	case gcpWorkloadIdentityAuthMethod:
+		logger.Info("Google Cloud workload identity will be used as authentication method")
+		return google.ComputeTokenSource("", gcpCloudPlatformScope), nil
+	case gcpServiceAccountKeyAuthMethod:
+		logger.Info("Google Cloud service account key will be used as authentication method", "gcp_credentials_file", cfg.GCPSMCredentialsFile)
+		key, err := ioutil.ReadFile(cfg.GCPSMCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		creds, err := google.CredentialsFromJSON(ctx, key, gcpCloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+		return creds.TokenSource, nil
+	case "":
+		logger.Info("Google Cloud application default credentials will be used as authentication method")
+		creds, err := google.FindDefaultCredentials(ctx, gcpCloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+		return creds.TokenSource, nil
+	default:
+		return nil, fmt.Errorf("unsupported Google Cloud authentication method %s", cfg.GCPSMAuthMethod)
+	}
+}
+
+func gcpSecretManagerBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*gcpSecretManagerClient, error) {
+	logger := l.WithName("gcp-sm").WithValues(
+		"gcp_project", cfg.GCPSMProject,
+		"gcp_auth_method", cfg.GCPSMAuthMethod)
+
+	metrics := newGCPSecretManagerMetrics(cfg.GCPSMProject)
+
+	tokenSource, err := getGCPTokenSource(ctx, logger, cfg)
+	if err != nil {
+		logger.Error(err, "Error while authenticating to Google Cloud")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	// Retrieve a first token so that a wrong setup fails on startup
+	if _, err = tokenSource.Token(); err != nil {
+		logger.Error(err, "Error while retrieving Google Cloud access token")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	endpoint := cfg.GCPSMEndpoint
+	if endpoint == "" {
+		endpoint = gcpSMDefaultEndpoint
+	}
+
+	httpClient := oauth2.NewClient(ctx, tokenSource)
+	httpClient.Timeout = cfg.BackendTimeout
+
+	logger.Info("Successfully logged into Google Secret Manager")
+
+	client := gcpSecretManagerClient{
+		httpClient: httpClient,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		project:    cfg.GCPSMProject,
+		metrics:    metrics,
+		context:    ctx,
+		logger:     logger,
+	}
+
+	return &client, nil
+}
+
+// secretVersionName returns the full resource name of the secret version referenced by path.
+// Bare secret names are resolved in the default project, and the latest version is used
+// if none is given.
+func (c *gcpSecretManagerClient) secretVersionName(path string) string {
+	name := strings.Trim(path, "/")
+	if !strings.HasPrefix(name, gcpSMProjectsPrefix) {
+		name = fmt.Sprintf("%s%s/secrets/%s", gcpSMProjectsPrefix, c.project, name)
+	}
+	if !strings.Contains(name, gcpSMVersionsSeparator) {
+		name = name + gcpSMVersionsSeparator + gcpSMDefaultVersion
+	}
+	return name
+}
+
+// ReadSecret reads the secret version referenced by path. If key is set, the payload
+// is expected to be a JSON object and the value of that field is returned.
+func (c *gcpSecretManagerClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	url := fmt.Sprintf(gcpSMAccessSecretVersionURLTemplate, c.endpoint, c.secretVersionName(path))
+	req, err := http.NewRequestWithContext(c.context, http.MethodGet, url, nil)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+		return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+	case http.StatusForbidden:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+		return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+	default:
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected status code %d accessing secret %s", resp.StatusCode, path)}
+	}
+
+	result := gcpSMAccessSecretVersionResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	if key == "" {
+		return string(payload), nil
+	}
+
+	data, err = getJSONField(path, key, string(payload))
+	if err != nil {
+		errorType := errors.UnknownErrorType
+		if errors.IsBackendSecretNotFound(err) {
+			errorType = errors.BackendSecretNotFoundErrorType
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errorType)
+		return "", err
+	}
+	return data, nil
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	gcpSMLabelNames            = []string{"gcp_project"}
+	gcpSMSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "gcp_sm",
+		Name:      "read_secret_errors_total",
+		Help:      "Google Secret Manager read operations counter",
+	}, append(gcpSMLabelNames, secretLabelNames...))
+	gcpSMLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "gcp_sm",
+		Name:      "login_errors_total",
+		Help:      "Google Secret Manager login errors counter",
+	}, gcpSMLabelNames)
+)
+
+type gcpSecretManagerMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(gcpSMSecretReadErrorsTotal)
+	r.MustRegister(gcpSMLoginErrorsTotal)
+}
+
+func newGCPSecretManagerMetrics(project string) *gcpSecretManagerMetrics {
+	labels := make(map[string]string, len(gcpSMLabelNames))
+	labels["gcp_project"] = project
+
+	return &gcpSecretManagerMetrics{labels: labels}
+}
+
+func (m *gcpSecretManagerMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	gcpSMSecretReadErrorsTotal.WithLabelValues(
+		m.labels["gcp_project"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *gcpSecretManagerMetrics) updateLoginErrorsTotalMetric() {
+	gcpSMLoginErrorsTotal.WithLabelValues(
+		m.labels["gcp_project"],
+	).Inc()
+}
@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+func TestGCPSecretManagerUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newGCPSecretManagerMetrics(fakeGCPProject)
+	gcpSMLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := gcpSMLoginErrorsTotal.GetMetricWithLabelValues(fakeGCPProject)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestGCPSecretManagerUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "projects/fake-project/secrets/foo"
+	key := "key"
+
+	metrics := newGCPSecretManagerMetrics(fakeGCPProject)
+	gcpSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	gcpSMSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+	metricSecretReadErrorsTotal, _ = gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, path, key, errors.BackendSecretForbiddenErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
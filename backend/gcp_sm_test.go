@@ -0,0 +1,202 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	fakeGCPProject     = "fake-project"
+	fakeGCPAccessToken = "fake-gcp-access-token"
+)
+
+var gcpSMSecrets = map[string]struct {
+	versions map[string]string
+	access   bool
+}{
+	"plain":     {versions: map[string]string{"1": "old-value", "2": "some-fake-value"}, access: true},
+	"json":      {versions: map[string]string{"1": `{"username":"admin","password":"s3cr3t"}`}, access: true},
+	"forbidden": {versions: map[string]string{"1": "yes"}, access: false},
+}
+
+func gcpWriteError(w http.ResponseWriter, code int, status string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message, "status": status},
+	})
+}
+
+func gcpSMAccessSecretVersion(w http.ResponseWriter, r *http.Request) {
+	// Info about Secret Manager REST API extracted from
+	// https://cloud.google.com/secret-manager/docs/reference/rest/v1/projects.secrets.versions/access
+	if r.Header.Get("Authorization") != "Bearer "+fakeGCPAccessToken {
+		gcpWriteError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request had invalid authentication credentials.")
+		return
+	}
+	vars := mux.Vars(r)
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", vars["project"], vars["secret"], vars["version"])
+	v, ok := gcpSMSecrets[vars["secret"]]
+	if !ok || vars["project"] != fakeGCPProject {
+		gcpWriteError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("Secret [%s] not found or has no versions.", name))
+		return
+	}
+	if !v.access {
+		gcpWriteError(w, http.StatusForbidden, "PERMISSION_DENIED", fmt.Sprintf("Permission 'secretmanager.versions.access' denied for resource '%s'", name))
+		return
+	}
+	version := vars["version"]
+	if version == gcpSMDefaultVersion {
+		version = fmt.Sprint(len(v.versions))
+	}
+	data, ok := v.versions[version]
+	if !ok {
+		gcpWriteError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("Secret Version [%s] not found.", name))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    fmt.Sprintf("projects/%s/secrets/%s/versions/%s", vars["project"], vars["secret"], version),
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte(data))},
+	})
+}
+
+func gcpOAuth2Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": fakeGCPAccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func writeFakeGCPServiceAccountKey(t *testing.T) string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	key, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     fakeGCPProject,
+		"private_key_id": "fake-key-id",
+		"private_key":    string(keyPEM),
+		"client_email":   fmt.Sprintf("secrets-manager@%s.iam.gserviceaccount.com", fakeGCPProject),
+		"client_id":      "123456789",
+		"token_uri":      testingCfg.VaultURL + "/token", // Is a mock server, valid for every backend
+	})
+	dir, err := ioutil.TempDir("", "gcp-sm")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "key.json")
+	assert.Nil(t, ioutil.WriteFile(path, key, 0600))
+	return path
+}
+
+func TestGCPSecretManagerBackendClient(t *testing.T) {
+	cfg := Config{GCPSMProject: fakeGCPProject, GCPSMAuthMethod: "foo"}
+	client, err := gcpSecretManagerBackendClient(context.TODO(), logger, cfg)
+	assert.NotNilf(t, err, "Unknown authentication method should generate an error")
+	assert.Nilf(t, client, "Unknown authentication method should not generate any client")
+
+	cfg = Config{GCPSMProject: fakeGCPProject, GCPSMAuthMethod: gcpServiceAccountKeyAuthMethod, GCPSMCredentialsFile: "/not/found.json"}
+	client, err = gcpSecretManagerBackendClient(context.TODO(), logger, cfg)
+	assert.NotNilf(t, err, "Missing service account key should generate an error")
+	assert.Nilf(t, client, "Missing service account key should not generate any client")
+
+	keyFile := writeFakeGCPServiceAccountKey(t)
+	defer os.RemoveAll(filepath.Dir(keyFile))
+	cfg = Config{
+		GCPSMProject:         fakeGCPProject,
+		GCPSMEndpoint:        testingCfg.VaultURL,
+		GCPSMAuthMethod:      gcpServiceAccountKeyAuthMethod,
+		GCPSMCredentialsFile: keyFile,
+	}
+	client, err = gcpSecretManagerBackendClient(context.TODO(), logger, cfg)
+	assert.Nilf(t, err, "Service account key should not generate error")
+	assert.NotNilf(t, client, "Service account key should generate a client")
+
+	value, err := client.ReadSecret("plain", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "some-fake-value", value)
+}
+
+func TestGCPSecretManagerSecretVersionName(t *testing.T) {
+	client := gcpSecretManagerClient{project: fakeGCPProject}
+	cases := map[string]string{
+		"foo":                                         "projects/fake-project/secrets/foo/versions/latest",
+		"foo/versions/3":                              "projects/fake-project/secrets/foo/versions/3",
+		"projects/other/secrets/foo":                  "projects/other/secrets/foo/versions/latest",
+		"projects/other/secrets/foo/versions/2":       "projects/other/secrets/foo/versions/2",
+		"/projects/other/secrets/foo/versions/latest": "projects/other/secrets/foo/versions/latest",
+	}
+	for path, expected := range cases {
+		assert.Equal(t, expected, client.secretVersionName(path))
+	}
+}
+
+func TestGCPSecretManagerClientReadSecret(t *testing.T) {
+	client := gcpSecretManagerClient{
+		httpClient: oauth2.NewClient(context.TODO(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: fakeGCPAccessToken})),
+		endpoint:   testingCfg.VaultURL,
+		project:    fakeGCPProject,
+		metrics:    newGCPSecretManagerMetrics(fakeGCPProject),
+		context:    context.TODO(),
+		logger:     logger,
+	}
+
+	value, err := client.ReadSecret("projects/fake-project/secrets/plain", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "some-fake-value", value)
+
+	value, err = client.ReadSecret("projects/fake-project/secrets/plain/versions/1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "old-value", value)
+
+	value, err = client.ReadSecret("json", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	gcpSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("json", "foo")
+	metricSecretReadErrorsTotal, _ := gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, "json", "foo", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	gcpSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("projects/fake-project/secrets/not-found", "")
+	metricSecretReadErrorsTotal, _ = gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, "projects/fake-project/secrets/not-found", "", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	gcpSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("forbidden", "")
+	metricSecretReadErrorsTotal, _ = gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, "forbidden", "", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	client.httpClient = http.DefaultClient
+	gcpSMSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("plain", "")
+	metricSecretReadErrorsTotal, _ = gcpSMSecretReadErrorsTotal.GetMetricWithLabelValues(fakeGCPProject, "plain", "", errors.UnknownErrorType)
+	assert.Equal(t, "", value)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
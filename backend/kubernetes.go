@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KubernetesSourceClient is implemented by backends that read from Kubernetes Secrets,
+// so that changes on the source Secrets can trigger a reconciliation.
+type KubernetesSourceClient interface {
+	SourceSecret(path string) (types.NamespacedName, error)
+}
+
+type kubernetesClient struct {
+	reader            ctrlclient.Reader
+	excludeNamespaces map[string]bool
+	sharedNamespaces  map[string]bool
+	// namespace the Secrets are read for, which can only read its own Secrets and the shared ones.
+	// Empty for the client of the backend itself.
+	namespace string
+	metrics   *kubernetesBackendMetrics
+	context   context.Context
+	logger    logr.Logger
+}
+
+func kubernetesBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*kubernetesClient, error) {
+	logger := l.WithName("kubernetes")
+
+	metrics := newKubernetesBackendMetrics()
+
+	if cfg.KubernetesReader == nil {
+		return nil, fmt.Errorf("a Kubernetes client is required by the %s backend", kubernetesBackendName)
+	}
+
+	sharedNamespaces := make(map[string]bool)
+	for _, namespace := range strings.Split(cfg.KubernetesSharedNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			sharedNamespaces[namespace] = true
+		}
+	}
+
+	logger.Info("Kubernetes Secrets will be used as backend", "shared_namespaces", cfg.KubernetesSharedNamespaces)
+
+	kclient := kubernetesClient{
+		reader:            cfg.KubernetesReader,
+		excludeNamespaces: cfg.ExcludeNamespaces,
+		sharedNamespaces:  sharedNamespaces,
+		metrics:           metrics,
+		context:           ctx,
+		logger:            logger,
+	}
+
+	return &kclient, nil
+}
+
+// SourceSecret returns the namespace and name of the Secret referenced by path,
+// which must be in the namespace/name form.
+func (c *kubernetesClient) SourceSecret(path string) (types.NamespacedName, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid secret path %s, expected namespace/name", path)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// ForKubernetesNamespace returns a client reading Secrets for namespace, which can only read
+// the Secrets of namespace itself and of the shared namespaces
+func (c *kubernetesClient) ForKubernetesNamespace(namespace string) (Client, error) {
+	nclient := *c
+	nclient.namespace = namespace
+	return &nclient, nil
+}
+
+// ReadSecret reads the data key from the Secret referenced by path. Secrets in
+// excluded namespaces can't be used as a source, nor Secrets of other namespaces
+// than the one they are read for, unless they are shared.
+func (c *kubernetesClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	name, err := c.SourceSecret(path)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	crossNamespace := c.namespace != "" && name.Namespace != c.namespace && !c.sharedNamespaces[name.Namespace]
+	if c.excludeNamespaces[name.Namespace] || crossNamespace {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+		return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+	}
+
+	secret := &corev1.Secret{}
+	err = c.reader.Get(c.context, name, secret)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+			return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+		}
+		if k8serrors.IsForbidden(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+			return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+		return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+	}
+	return string(value), nil
+}
@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	kubernetesSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "kubernetes",
+		Name:      "read_secret_errors_total",
+		Help:      "Kubernetes Secrets backend read operations counter",
+	}, secretLabelNames)
+)
+
+type kubernetesBackendMetrics struct{}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(kubernetesSecretReadErrorsTotal)
+}
+
+func newKubernetesBackendMetrics() *kubernetesBackendMetrics {
+	return &kubernetesBackendMetrics{}
+}
+
+func (m *kubernetesBackendMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	kubernetesSecretReadErrorsTotal.WithLabelValues(
+		path,
+		key,
+		errorType,
+	).Inc()
+}
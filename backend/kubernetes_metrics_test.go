@@ -0,0 +1,21 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+func TestKubernetesUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "shared/registry"
+	key := "key"
+
+	metrics := newKubernetesBackendMetrics()
+	kubernetesSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues(path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newFakeKubernetesClient() *kubernetesClient {
+	secrets := []*corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "registry"},
+			Data: map[string][]byte{
+				".dockerconfigjson": []byte(`{"auths":{}}`),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "internal"},
+			Data: map[string][]byte{
+				"token": []byte("s3cr3t"),
+			},
+		},
+	}
+	reader := fake.NewClientBuilder().WithObjects(secrets[0], secrets[1]).Build()
+	return &kubernetesClient{
+		reader:            reader,
+		excludeNamespaces: map[string]bool{"kube-system": true},
+		sharedNamespaces:  map[string]bool{},
+		metrics:           newKubernetesBackendMetrics(),
+		context:           context.TODO(),
+		logger:            logger,
+	}
+}
+
+func TestKubernetesBackendClient(t *testing.T) {
+	client, err := kubernetesBackendClient(context.TODO(), logger, Config{})
+	assert.NotNilf(t, err, "Missing Kubernetes client should generate an error")
+	assert.Nilf(t, client, "Missing Kubernetes client should not generate any client")
+
+	cfg := Config{KubernetesReader: fake.NewClientBuilder().Build()}
+	client, err = kubernetesBackendClient(context.TODO(), logger, cfg)
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestKubernetesClientSourceSecret(t *testing.T) {
+	client := newFakeKubernetesClient()
+
+	name, err := client.SourceSecret("shared/registry")
+	assert.Nil(t, err)
+	assert.Equal(t, types.NamespacedName{Namespace: "shared", Name: "registry"}, name)
+
+	for _, path := range []string{"registry", "shared/", "/registry", "shared/registry/foo"} {
+		_, err = client.SourceSecret(path)
+		assert.NotNilf(t, err, "path %s should generate an error", path)
+	}
+}
+
+func TestKubernetesClientReadSecret(t *testing.T) {
+	client := newFakeKubernetesClient()
+
+	value, err := client.ReadSecret("shared/registry", ".dockerconfigjson")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"auths":{}}`, value)
+
+	kubernetesSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("shared/registry", "not-found")
+	metricSecretReadErrorsTotal, _ := kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues("shared/registry", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	kubernetesSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("shared/not-found", "token")
+	metricSecretReadErrorsTotal, _ = kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues("shared/not-found", "token", errors.BackendSecretNotFoundErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	kubernetesSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("kube-system/internal", "token")
+	metricSecretReadErrorsTotal, _ = kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues("kube-system/internal", "token", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	kubernetesSecretReadErrorsTotal.Reset()
+	_, err = client.ReadSecret("registry", "token")
+	metricSecretReadErrorsTotal, _ = kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues("registry", "token", errors.UnknownErrorType)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
+
+func TestKubernetesClientForKubernetesNamespace(t *testing.T) {
+	client := newFakeKubernetesClient()
+
+	namespaced, err := client.ForKubernetesNamespace("shared")
+	assert.Nil(t, err)
+	value, err := namespaced.ReadSecret("shared/registry", ".dockerconfigjson")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"auths":{}}`, value)
+
+	namespaced, err = client.ForKubernetesNamespace("my-app")
+	assert.Nil(t, err)
+	kubernetesSecretReadErrorsTotal.Reset()
+	value, err = namespaced.ReadSecret("shared/registry", ".dockerconfigjson")
+	metricSecretReadErrorsTotal, _ := kubernetesSecretReadErrorsTotal.GetMetricWithLabelValues("shared/registry", ".dockerconfigjson", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.Truef(t, errors.IsBackendSecretForbidden(err), "Secrets of other namespaces should be forbidden unless shared")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	client.sharedNamespaces = map[string]bool{"shared": true, "kube-system": true}
+	namespaced, err = client.ForKubernetesNamespace("my-app")
+	assert.Nil(t, err)
+	value, err = namespaced.ReadSecret("shared/registry", ".dockerconfigjson")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"auths":{}}`, value)
+
+	value, err = namespaced.ReadSecret("kube-system/internal", "token")
+	assert.Equal(t, "", value)
+	assert.Truef(t, errors.IsBackendSecretForbidden(err), "Secrets of excluded namespaces should be forbidden even if shared")
+}
@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const (
+	onePasswordVaultsURLTemplate = "%s/v1/vaults"
+	onePasswordItemsURLTemplate  = "%s/v1/vaults/%s/items"
+	onePasswordItemURLTemplate   = "%s/v1/vaults/%s/items/%s"
+	onePasswordPasswordPurpose   = "PASSWORD"
+)
+
+var (
+	// 1Password IDs are 26 lowercase alphanumeric characters
+	onePasswordIDRegexp = regexp.MustCompile(`^[a-z0-9]{26}$`)
+	// Quotes and backslashes must be escaped in the filter values
+	onePasswordFilterReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+type onePasswordConnectClient struct {
+	httpClient *http.Client
+	url        string
+	token      string
+	metrics    *onePasswordConnectMetrics
+	context    context.Context
+	logger     logr.Logger
+}
+
+type onePasswordObject struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Title string `json:"title"`
+}
+
+type onePasswordItem struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Fields []struct {
+		ID      string `json:"id"`
+		Label   string `json:"label"`
+		Purpose string `json:"purpose"`
+		Value   string `json:"value"`
+	} `json:"fields"`
+}
+
+func onePasswordConnectBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*onePasswordConnectClient, error) {
+	logger := l.WithName("onepassword").WithValues("onepassword_url", cfg.OnePasswordURL)
+
+	metrics := newOnePasswordConnectMetrics(cfg.OnePasswordURL)
+
+	httpClient := new(http.Client)
+	httpClient.Timeout = cfg.BackendTimeout
+
+	client := onePasswordConnectClient{
+		httpClient: httpClient,
+		url:        strings.TrimSuffix(cfg.OnePasswordURL, "/"),
+		token:      cfg.OnePasswordToken,
+		metrics:    metrics,
+		context:    ctx,
+		logger:     logger,
+	}
+
+	// Listing the vaults checks both connectivity and the Connect token on startup
+	vaults := []onePasswordObject{}
+	if err := client.get(fmt.Sprintf(onePasswordVaultsURLTemplate, client.url), &vaults); err != nil {
+		logger.Error(err, "unable to list 1Password vaults with provided token")
+		metrics.updateLoginErrorsTotalMetric()
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to 1Password Connect", "onepassword_vaults", len(vaults))
+
+	return &client, nil
+}
+
+func (c *onePasswordConnectClient) get(endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(c.context, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("unexpected status code %d from 1Password Connect", resp.StatusCode)}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// findID returns the ID of the object named name in the list at listURL. Names that
+// don't match any object are considered IDs already, if they look like one.
+func (c *onePasswordConnectClient) findID(listURL string, attribute string, name string) (string, error) {
+	objects := []onePasswordObject{}
+	filter := url.Values{"filter": {fmt.Sprintf("%s eq \"%s\"", attribute, onePasswordFilterReplacer.Replace(name))}}
+	if err := c.get(listURL+"?"+filter.Encode(), &objects); err != nil {
+		return "", err
+	}
+	if len(objects) > 0 {
+		return objects[0].ID, nil
+	}
+	if !onePasswordIDRegexp.MatchString(name) {
+		return "", &httpStatusError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("no 1Password object with %s %s", attribute, name)}
+	}
+	return name, nil
+}
+
+func (c *onePasswordConnectClient) getItem(path string) (*onePasswordItem, error) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid secret path %s, expected vault/item", path)
+	}
+
+	vaultID, err := c.findID(fmt.Sprintf(onePasswordVaultsURLTemplate, c.url), "name", parts[0])
+	if err != nil {
+		return nil, err
+	}
+	itemID, err := c.findID(fmt.Sprintf(onePasswordItemsURLTemplate, c.url, url.PathEscape(vaultID)), "title", parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	item := &onePasswordItem{}
+	err = c.get(fmt.Sprintf(onePasswordItemURLTemplate, c.url, url.PathEscape(vaultID), url.PathEscape(itemID)), item)
+	return item, err
+}
+
+// ReadSecret reads the field labeled key from the item at path, in the vault/item form.
+// Vaults and items can be referenced by name or ID. An empty key returns the item password.
+func (c *onePasswordConnectClient) ReadSecret(path string, key string) (string, error) {
+	data := ""
+
+	item, err := c.getItem(path)
+	if err != nil {
+		if statusErr, ok := err.(*httpStatusError); ok {
+			switch statusErr.StatusCode {
+			case http.StatusNotFound:
+				c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+				return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+			case http.StatusForbidden:
+				c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+				return data, &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+			}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, err
+	}
+
+	for _, field := range item.Fields {
+		if (key == "" && field.Purpose == onePasswordPasswordPurpose) || (key != "" && (field.Label == key || field.ID == key)) {
+			return field.Value, nil
+		}
+	}
+
+	c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+	return data, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+}
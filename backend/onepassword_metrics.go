@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	onePasswordLabelNames            = []string{"onepassword_url"}
+	onePasswordSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "onepassword",
+		Name:      "read_secret_errors_total",
+		Help:      "1Password Connect read operations counter",
+	}, append(onePasswordLabelNames, secretLabelNames...))
+	onePasswordLoginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "onepassword",
+		Name:      "login_errors_total",
+		Help:      "1Password Connect login errors counter",
+	}, onePasswordLabelNames)
+)
+
+type onePasswordConnectMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(onePasswordSecretReadErrorsTotal)
+	r.MustRegister(onePasswordLoginErrorsTotal)
+}
+
+func newOnePasswordConnectMetrics(url string) *onePasswordConnectMetrics {
+	labels := make(map[string]string, len(onePasswordLabelNames))
+	labels["onepassword_url"] = url
+
+	return &onePasswordConnectMetrics{labels: labels}
+}
+
+func (m *onePasswordConnectMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	onePasswordSecretReadErrorsTotal.WithLabelValues(
+		m.labels["onepassword_url"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
+
+func (m *onePasswordConnectMetrics) updateLoginErrorsTotalMetric() {
+	onePasswordLoginErrorsTotal.WithLabelValues(
+		m.labels["onepassword_url"],
+	).Inc()
+}
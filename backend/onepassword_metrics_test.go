@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeOnePasswordURL = "http://onepassword-connect:8080"
+
+func TestOnePasswordConnectUpdateLoginErrorsTotal(t *testing.T) {
+	metrics := newOnePasswordConnectMetrics(fakeOnePasswordURL)
+	onePasswordLoginErrorsTotal.Reset()
+	metrics.updateLoginErrorsTotalMetric()
+	metricLoginErrors, _ := onePasswordLoginErrorsTotal.GetMetricWithLabelValues(fakeOnePasswordURL)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricLoginErrors))
+}
+
+func TestOnePasswordConnectUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "Developers/Staging Database"
+	key := "password"
+
+	metrics := newOnePasswordConnectMetrics(fakeOnePasswordURL)
+	onePasswordSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := onePasswordSecretReadErrorsTotal.GetMetricWithLabelValues(fakeOnePasswordURL, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeOnePasswordToken = "eyJhbGciOiJFUzI1NiIsImtpZCI6ImZha2UifQ.fake.token"
+
+type onePasswordFakeField struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Purpose string `json:"purpose,omitempty"`
+	Value   string `json:"value"`
+}
+
+var (
+	onePasswordFilterRegexp = regexp.MustCompile(`^(name|title) eq "(.*)"$`)
+	onePasswordFakeVaults   = map[string]string{
+		"ytrfte14kw1uex5txaore1emkz": "Developers",
+		"forbiddenvault00000000000a": "Finance",
+	}
+	onePasswordFakeItems = map[string]map[string]struct {
+		title  string
+		fields []onePasswordFakeField
+	}{
+		"ytrfte14kw1uex5txaore1emkz": {
+			"2fcbqwe9ndg175zg2dzwftvkpa": {
+				title: "Staging Database",
+				fields: []onePasswordFakeField{
+					{ID: "username", Label: "username", Purpose: "USERNAME", Value: "admin"},
+					{ID: "password", Label: "password", Purpose: "PASSWORD", Value: "s3cr3t"},
+					{ID: "a6cvmeqakbxoflkgmor4haji7y", Label: "connection string", Value: "postgres://db:5432"},
+				},
+			},
+			"q7ghnwi3bxcd5lmfzyeyo2rk4u": {
+				title: `Staging "Cache"`,
+				fields: []onePasswordFakeField{
+					{ID: "password", Label: "password", Purpose: "PASSWORD", Value: "c4ch3"},
+				},
+			},
+		},
+	}
+)
+
+func onePasswordAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	// Info about the 1Password Connect API extracted from
+	// https://developer.1password.com/docs/connect/connect-api-reference
+	if r.Header.Get("Authorization") != "Bearer "+fakeOnePasswordToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func onePasswordFilter(r *http.Request) string {
+	match := onePasswordFilterRegexp.FindStringSubmatch(r.URL.Query().Get("filter"))
+	if match == nil {
+		return ""
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(match[2])
+}
+
+func onePasswordListVaults(w http.ResponseWriter, r *http.Request) {
+	if !onePasswordAuthorized(w, r) {
+		return
+	}
+	name := onePasswordFilter(r)
+	vaults := []map[string]string{}
+	for id, vaultName := range onePasswordFakeVaults {
+		if name == "" || name == vaultName {
+			vaults = append(vaults, map[string]string{"id": id, "name": vaultName})
+		}
+	}
+	json.NewEncoder(w).Encode(vaults)
+}
+
+func onePasswordListItems(w http.ResponseWriter, r *http.Request) {
+	if !onePasswordAuthorized(w, r) {
+		return
+	}
+	vault := mux.Vars(r)["vault"]
+	if _, ok := onePasswordFakeVaults[vault]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, ok := onePasswordFakeItems[vault]; !ok {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	title := onePasswordFilter(r)
+	items := []map[string]string{}
+	for id, item := range onePasswordFakeItems[vault] {
+		if title == "" || title == item.title {
+			items = append(items, map[string]string{"id": id, "title": item.title})
+		}
+	}
+	json.NewEncoder(w).Encode(items)
+}
+
+func onePasswordGetItem(w http.ResponseWriter, r *http.Request) {
+	if !onePasswordAuthorized(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	item, ok := onePasswordFakeItems[vars["vault"]][vars["item"]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     vars["item"],
+		"title":  item.title,
+		"vault":  map[string]string{"id": vars["vault"]},
+		"fields": item.fields,
+	})
+}
+
+func newFakeOnePasswordConfig() Config {
+	return Config{
+		OnePasswordURL:   testingCfg.VaultURL,
+		OnePasswordToken: fakeOnePasswordToken,
+	}
+}
+
+func TestOnePasswordConnectBackendClient(t *testing.T) {
+	cfg := newFakeOnePasswordConfig()
+	cfg.OnePasswordToken = "wrong-token"
+	client, err := onePasswordConnectBackendClient(context.TODO(), logger, cfg)
+	assert.NotNilf(t, err, "Wrong token should generate an error")
+	assert.Nil(t, client)
+
+	client, err = onePasswordConnectBackendClient(context.TODO(), logger, newFakeOnePasswordConfig())
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestOnePasswordConnectClientReadSecret(t *testing.T) {
+	cfg := newFakeOnePasswordConfig()
+	client, err := onePasswordConnectBackendClient(context.TODO(), logger, cfg)
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("Developers/Staging Database", "username")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+
+	value, err = client.ReadSecret("Developers/Staging Database", "connection string")
+	assert.Nil(t, err)
+	assert.Equal(t, "postgres://db:5432", value)
+
+	value, err = client.ReadSecret("Developers/Staging Database", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("ytrfte14kw1uex5txaore1emkz/2fcbqwe9ndg175zg2dzwftvkpa", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret(`Developers/Staging "Cache"`, "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "c4ch3", value)
+
+	for _, secret := range []struct{ path, key string }{
+		{"Developers/Staging Database", "not-found"},
+		{"Developers/Not Found", "password"},
+		{"Not Found/Staging Database", "password"},
+		{"Developers/Staging Database\\", "password"},
+		{"Developers/notfoundnotfoundnotfound00", "password"},
+	} {
+		onePasswordSecretReadErrorsTotal.Reset()
+		value, err = client.ReadSecret(secret.path, secret.key)
+		metricSecretReadErrorsTotal, _ := onePasswordSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.OnePasswordURL, secret.path, secret.key, errors.BackendSecretNotFoundErrorType)
+		assert.Equal(t, "", value)
+		assert.Truef(t, errors.IsBackendSecretNotFound(err), "%s %s should not be found", secret.path, secret.key)
+		assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+	}
+
+	onePasswordSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("Finance/Payroll", "password")
+	metricSecretReadErrorsTotal, _ := onePasswordSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.OnePasswordURL, "Finance/Payroll", "password", errors.BackendSecretForbiddenErrorType)
+	assert.Equal(t, "", value)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	onePasswordSecretReadErrorsTotal.Reset()
+	_, err = client.ReadSecret("Developers", "password")
+	metricSecretReadErrorsTotal, _ = onePasswordSecretReadErrorsTotal.GetMetricWithLabelValues(cfg.OnePasswordURL, "Developers", "password", errors.UnknownErrorType)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
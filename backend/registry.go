@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"context"
+	goerrors "errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/vault/api"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+// Source is a secret in one of the registered backends
+type Source struct {
+	Backend string
+	Path    string
+	Key     string
+	Version string
+	// ObjectType of the backend the secret is read from, a secret if empty
+	ObjectType string
+	// Namespace of the backend the secret is read from, the backend one if empty
+	Namespace string
+	// KubernetesNamespace the secret is read for, whose identity is used by the backends supporting it
+	KubernetesNamespace string
+}
+
+// Registry keeps the backend clients SecretDefinitions can read from by name.
+// Data sources that don't select any backend read from the default one.
+type Registry struct {
+	defaultClient Client
+	clients       map[string]Client
+	mutex         sync.RWMutex
+}
+
+// NewRegistry returns a Registry whose default backend is defaultClient, which can be nil
+func NewRegistry(defaultClient Client) *Registry {
+	return &Registry{
+		defaultClient: defaultClient,
+		clients:       make(map[string]Client),
+	}
+}
+
+// Add registers client under name, replacing any client previously registered with the same name
+func (r *Registry) Add(name string, client Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clients[name] = client
+}
+
+// Remove unregisters the client registered under name
+func (r *Registry) Remove(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.clients, name)
+}
+
+// Get returns the client registered under name, or the default client if name is empty
+func (r *Registry) Get(name string) (Client, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	client := r.defaultClient
+	if name != "" {
+		client = r.clients[name]
+	}
+	if client == nil {
+		return nil, &errors.BackendNotFoundError{ErrType: errors.BackendNotFoundErrorType, Backend: name}
+	}
+	return client, nil
+}
+
+// Clients returns all the registered clients, the default one included
+func (r *Registry) Clients() []Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	clients := make([]Client, 0, len(r.clients)+1)
+	if r.defaultClient != nil {
+		clients = append(clients, r.defaultClient)
+	}
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// SourceClient returns the client of the backend of source, authenticated with the identity of its
+// Kubernetes namespace if the backend supports it, and reading from its namespace if it has one
+func (r *Registry) SourceClient(source Source) (Client, error) {
+	client, err := r.Get(source.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if identity, ok := client.(IdentityClient); ok && source.KubernetesNamespace != "" {
+		client, err = identity.ForKubernetesNamespace(source.KubernetesNamespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if source.Namespace != "" {
+		namespaced, ok := client.(NamespacedClient)
+		if !ok {
+			return nil, &errors.NamespaceNotSupportedError{ErrType: errors.NamespaceNotSupportedErrorType, Backend: source.Backend}
+		}
+		return namespaced.WithNamespace(source.Namespace)
+	}
+	return client, nil
+}
+
+// ReadSecret reads the secret from the first of sources serving it, and returns the source it was read from,
+// with the version read if the backend supports versions.
+// The next source is only tried when the secret is not found or the backend can't be reached, any other error,
+// like a denied access or a wrong configuration, is returned.
+func (r *Registry) ReadSecret(sources []Source) (string, Source, error) {
+	var err error
+	for _, source := range sources {
+		var data, version string
+		data, version, err = r.readSource(source)
+		if err == nil {
+			source.Version = version
+			return data, source, nil
+		}
+		if !isSecretUnavailable(err) {
+			break
+		}
+	}
+	return "", Source{}, err
+}
+
+// isSecretUnavailable returns whether err means that the secret was not found, or that the backend couldn't be
+// reached or failed serving it, so that it can be read from another source
+func isSecretUnavailable(err error) bool {
+	if errors.IsBackendSecretNotFound(err) || goerrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netError net.Error
+	if goerrors.As(err, &netError) {
+		return true
+	}
+	statusCode := responseStatusCode(err)
+	return statusCode == http.StatusNotFound || statusCode >= http.StatusInternalServerError
+}
+
+// responseStatusCode returns the HTTP status code of the backend response err was built from, 0 if none
+func responseStatusCode(err error) int {
+	var vaultError *api.ResponseError
+	var azureError *azcore.ResponseError
+	var awsError awserr.RequestFailure
+	var consulError consul.StatusError
+	var statusError *httpStatusError
+	switch {
+	case goerrors.As(err, &vaultError):
+		return vaultError.StatusCode
+	case goerrors.As(err, &azureError):
+		return azureError.StatusCode
+	case goerrors.As(err, &awsError):
+		return awsError.StatusCode()
+	case goerrors.As(err, &consulError):
+		return consulError.Code
+	case goerrors.As(err, &statusError):
+		return statusError.StatusCode
+	}
+	return 0
+}
+
+// readSource reads the secret from the source client, which must support versions if the source has a version,
+// and other objects than secrets if the source has an object type
+func (r *Registry) readSource(source Source) (string, string, error) {
+	client, err := r.SourceClient(source)
+	if err != nil {
+		return "", "", err
+	}
+	if source.ObjectType != "" && source.ObjectType != SecretObjectType {
+		objects, ok := client.(ObjectClient)
+		if !ok {
+			return "", "", &errors.ObjectTypeNotSupportedError{ErrType: errors.ObjectTypeNotSupportedErrorType, Backend: source.Backend, ObjectType: source.ObjectType}
+		}
+		return objects.ReadObjectVersion(source.ObjectType, source.Path, source.Key, source.Version)
+	}
+	if versioned, ok := client.(VersionedClient); ok {
+		return versioned.ReadSecretVersion(source.Path, source.Key, source.Version)
+	}
+	if source.Version != "" {
+		return "", "", &errors.SecretVersionNotSupportedError{ErrType: errors.SecretVersionNotSupportedErrorType, Backend: source.Backend}
+	}
+	data, err := client.ReadSecret(source.Path, source.Key)
+	return data, "", err
+}
@@ -0,0 +1,221 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+type fakeRegistryClient struct {
+	value string
+	err   error
+}
+
+func (c fakeRegistryClient) ReadSecret(path string, key string) (string, error) {
+	return c.value, c.err
+}
+
+func TestRegistryGet(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{value: "default"})
+	registry.Add("vault-eu", fakeRegistryClient{value: "eu"})
+	registry.Add("vault-us", fakeRegistryClient{value: "us"})
+
+	client, err := registry.Get("")
+	assert.Nil(t, err)
+	value, _ := client.ReadSecret("path", "key")
+	assert.Equal(t, "default", value)
+
+	client, err = registry.Get("vault-eu")
+	assert.Nil(t, err)
+	value, _ = client.ReadSecret("path", "key")
+	assert.Equal(t, "eu", value)
+
+	client, err = registry.Get("not-found")
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsBackendNotFound(err))
+	assert.Nil(t, client)
+
+	registry.Remove("vault-us")
+	_, err = registry.Get("vault-us")
+	assert.True(t, errors.IsBackendNotFound(err))
+
+	assert.Len(t, registry.Clients(), 2)
+}
+
+func TestRegistryWithoutDefault(t *testing.T) {
+	registry := NewRegistry(nil)
+	registry.Add("azure", fakeRegistryClient{value: "azure"})
+
+	client, err := registry.Get("")
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsBackendNotFound(err))
+	assert.Nil(t, client)
+
+	assert.Len(t, registry.Clients(), 1)
+}
+
+func TestRegistryReadSecret(t *testing.T) {
+	notFound := &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: "path", Key: "key"}
+	forbidden := &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: "path", Key: "key"}
+	registry := NewRegistry(fakeRegistryClient{err: notFound})
+	refused := &url.Error{Op: "Get", URL: "https://vault-eu:8200", Err: &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}}
+	registry.Add("vault-down", fakeRegistryClient{err: refused})
+	registry.Add("vault-failing", fakeRegistryClient{err: &api.ResponseError{StatusCode: 503}})
+	registry.Add("consul-failing", fakeRegistryClient{err: consul.StatusError{Code: 500, Body: "rpc error"}})
+	registry.Add("vault-forbidden", fakeRegistryClient{err: forbidden})
+	registry.Add("azure", fakeRegistryClient{value: "azure"})
+
+	sources := []Source{
+		{Backend: "", Path: "secret/data/app", Key: "password"},
+		{Backend: "vault-down", Path: "secret/data/app", Key: "password"},
+		{Backend: "vault-failing", Path: "secret/data/app", Key: "password"},
+		{Backend: "consul-failing", Path: "app/password"},
+		{Backend: "azure", Path: "app-password"},
+	}
+	value, source, err := registry.ReadSecret(sources)
+	assert.Nil(t, err)
+	assert.Equal(t, "azure", value)
+	assert.Equal(t, sources[4], source)
+
+	_, _, err = registry.ReadSecret(sources[:2])
+	assert.NotNil(t, err)
+	assert.Equal(t, refused, err)
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "vault-forbidden"}, {Backend: "azure"}})
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+}
+
+func TestRegistryReadSecretConfigError(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{err: fmt.Errorf("unsupported vault engine kv3")})
+	registry.Add("vault-bad-request", fakeRegistryClient{err: &api.ResponseError{StatusCode: 400}})
+	registry.Add("azure", fakeRegistryClient{value: "azure"})
+
+	_, _, err := registry.ReadSecret([]Source{{Backend: ""}, {Backend: "azure"}})
+	assert.EqualError(t, err, "unsupported vault engine kv3")
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "not-configured"}, {Backend: "azure"}})
+	assert.True(t, errors.IsBackendNotFound(err))
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "vault-bad-request"}, {Backend: "azure"}})
+	assert.IsType(t, new(api.ResponseError), err)
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "", Version: "1"}, {Backend: "azure"}})
+	assert.True(t, errors.IsSecretVersionNotSupported(err))
+}
+
+type fakeVersionedRegistryClient struct {
+	fakeRegistryClient
+}
+
+func (c fakeVersionedRegistryClient) ReadSecretVersion(path string, key string, version string) (string, string, error) {
+	if version == "" {
+		version = "2"
+	}
+	return c.value + version, version, c.err
+}
+
+func TestRegistryReadSecretVersion(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{value: "default"})
+	registry.Add("vault", fakeVersionedRegistryClient{fakeRegistryClient{value: "vault"}})
+
+	value, source, err := registry.ReadSecret([]Source{{Backend: "vault", Version: "1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault1", value)
+	assert.Equal(t, "1", source.Version)
+
+	value, source, err = registry.ReadSecret([]Source{{Backend: "vault"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault2", value)
+	assert.Equal(t, "2", source.Version)
+
+	value, source, err = registry.ReadSecret([]Source{{Backend: ""}})
+	assert.Nil(t, err)
+	assert.Equal(t, "default", value)
+	assert.Equal(t, "", source.Version)
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "", Version: "1"}})
+	assert.True(t, errors.IsSecretVersionNotSupported(err))
+}
+
+type fakeNamespacedRegistryClient struct {
+	fakeRegistryClient
+}
+
+func (c fakeNamespacedRegistryClient) WithNamespace(namespace string) (Client, error) {
+	return fakeRegistryClient{value: c.value + "@" + namespace}, nil
+}
+
+func TestRegistryReadSecretNamespace(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{value: "default"})
+	registry.Add("vault", fakeNamespacedRegistryClient{fakeRegistryClient{value: "vault"}})
+
+	value, _, err := registry.ReadSecret([]Source{{Backend: "vault", Namespace: "bu1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault@bu1", value)
+
+	value, _, err = registry.ReadSecret([]Source{{Backend: "vault"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault", value)
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "", Namespace: "bu1"}})
+	assert.True(t, errors.IsNamespaceNotSupported(err))
+}
+
+type fakeIdentityRegistryClient struct {
+	fakeRegistryClient
+}
+
+func (c fakeIdentityRegistryClient) ForKubernetesNamespace(namespace string) (Client, error) {
+	return fakeNamespacedRegistryClient{fakeRegistryClient{value: c.value + " as " + namespace}}, nil
+}
+
+func TestRegistryReadSecretIdentity(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{value: "default"})
+	registry.Add("vault", fakeIdentityRegistryClient{fakeRegistryClient{value: "vault"}})
+
+	value, _, err := registry.ReadSecret([]Source{{Backend: "vault", KubernetesNamespace: "team-a"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault as team-a", value)
+
+	// The namespace is applied to the client of the namespace identity
+	value, _, err = registry.ReadSecret([]Source{{Backend: "vault", KubernetesNamespace: "team-a", Namespace: "bu1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "vault as team-a@bu1", value)
+
+	// Backends without identities ignore the Kubernetes namespace
+	value, _, err = registry.ReadSecret([]Source{{KubernetesNamespace: "team-a"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "default", value)
+}
+
+type fakeObjectRegistryClient struct {
+	fakeRegistryClient
+}
+
+func (c fakeObjectRegistryClient) ReadObjectVersion(objectType string, path string, key string, version string) (string, string, error) {
+	return fmt.Sprintf("%s %s %s/%s", c.value, objectType, path, key), "3", nil
+}
+
+func TestRegistryReadSecretObjectType(t *testing.T) {
+	registry := NewRegistry(fakeRegistryClient{value: "default"})
+	registry.Add("azure-kv", fakeObjectRegistryClient{fakeRegistryClient{value: "azure-kv"}})
+
+	value, source, err := registry.ReadSecret([]Source{{Backend: "azure-kv", ObjectType: CertificateObjectType, Path: "tls", Key: "privateKey"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "azure-kv certificate tls/privateKey", value)
+	assert.Equal(t, "3", source.Version)
+
+	// Secrets are read as usual
+	value, _, err = registry.ReadSecret([]Source{{Backend: "azure-kv", ObjectType: SecretObjectType}})
+	assert.Nil(t, err)
+	assert.Equal(t, "azure-kv", value)
+
+	_, _, err = registry.ReadSecret([]Source{{Backend: "", ObjectType: KeyObjectType}})
+	assert.True(t, errors.IsObjectTypeNotSupported(err))
+}
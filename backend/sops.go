@@ -0,0 +1,637 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-logr/logr"
+	"github.com/tuenti/secrets-manager/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	sopsMetadataKey      = "sops"
+	sopsDotenvExtension  = ".env"
+	sopsDotenvPrefix     = "sops_"
+	sopsPGPKeyExtension  = ".asc"
+	sopsTypeInt          = "int"
+	sopsTypeFloat        = "float"
+	sopsTypeBool         = "bool"
+	sopsAADPathSeparator = ":"
+)
+
+var (
+	sopsEncryptedValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+	sopsDotenvMetadataRegexp = regexp.MustCompile(`^sops_(age|pgp)__list_(\d+)__map_(\w+)$`)
+)
+
+// sopsLeaf is a value of a SOPS file, with the keys leading to it
+type sopsLeaf struct {
+	path  []string
+	value interface{}
+}
+
+type sopsMasterKey struct {
+	Recipient   string `json:"recipient,omitempty"`
+	Fingerprint string `json:"fp,omitempty"`
+	Enc         string `json:"enc"`
+}
+
+type sopsMetadata struct {
+	Age              []sopsMasterKey `json:"age"`
+	PGP              []sopsMasterKey `json:"pgp"`
+	LastModified     string          `json:"lastmodified"`
+	MAC              string          `json:"mac"`
+	MACOnlyEncrypted bool            `json:"mac_only_encrypted"`
+}
+
+// sopsDataKey is the decrypted data key of a file, with the master key it was decrypted from
+type sopsDataKey struct {
+	enc string
+	key []byte
+}
+
+type sopsKeys struct {
+	identities []age.Identity
+	keyring    openpgp.EntityList
+}
+
+type sopsClient struct {
+	files             *fileClient
+	fileKeys          sopsKeys
+	reader            ctrlclient.Reader
+	keysSecret        *types.NamespacedName
+	secretKeys        sopsKeys
+	secretKeysVersion string
+	dataKeys          map[string]sopsDataKey
+	mutex             sync.Mutex
+	metrics           *sopsBackendMetrics
+	context           context.Context
+	logger            logr.Logger
+}
+
+func sopsBackendClient(ctx context.Context, l logr.Logger, cfg Config) (*sopsClient, error) {
+	logger := l.WithName("sops").WithValues("sops_root", cfg.SopsRoot)
+
+	metrics := newSopsBackendMetrics(cfg.SopsRoot)
+
+	if cfg.SopsAgeKeyFile == "" && cfg.SopsPGPKeyFile == "" && cfg.SopsKeysSecret == "" {
+		return nil, fmt.Errorf("an age or PGP key is required by the %s backend", sopsBackendName)
+	}
+
+	// Encrypted files are read the same way as the file backend does, so
+	// they're protected from path traversal and cached until they change
+	files, err := fileBackendClient(ctx, logger, Config{FileRoot: cfg.SopsRoot})
+	if err != nil {
+		return nil, err
+	}
+
+	client := sopsClient{
+		files:    files,
+		dataKeys: make(map[string]sopsDataKey),
+		metrics:  metrics,
+		context:  ctx,
+		logger:   logger,
+	}
+
+	if cfg.SopsAgeKeyFile != "" {
+		content, err := ioutil.ReadFile(cfg.SopsAgeKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if client.fileKeys.identities, err = age.ParseIdentities(bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SopsPGPKeyFile != "" {
+		content, err := ioutil.ReadFile(cfg.SopsPGPKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if client.fileKeys.keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SopsKeysSecret != "" {
+		parts := strings.Split(cfg.SopsKeysSecret, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid keys secret %s, expected namespace/name", cfg.SopsKeysSecret)
+		}
+		if cfg.KubernetesReader == nil {
+			return nil, fmt.Errorf("a Kubernetes client is required to read the %s backend keys secret", sopsBackendName)
+		}
+		client.reader = cfg.KubernetesReader
+		client.keysSecret = &types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+
+	logger.Info("SOPS encrypted files will be used as backend",
+		"sops_age_identities", len(client.fileKeys.identities),
+		"sops_pgp_keys", len(client.fileKeys.keyring),
+		"sops_keys_secret", cfg.SopsKeysSecret)
+
+	return &client, nil
+}
+
+// getKeys returns the keys read from files plus the ones stored in the keys Secret.
+// Secret data keys ending in .asc hold armored PGP private keys, any other one holds age identities.
+// The Secret keys are only parsed again when the Secret changes.
+func (c *sopsClient) getKeys() (sopsKeys, error) {
+	keys := sopsKeys{
+		identities: append([]age.Identity{}, c.fileKeys.identities...),
+		keyring:    append(openpgp.EntityList{}, c.fileKeys.keyring...),
+	}
+	if c.keysSecret == nil {
+		return keys, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.reader.Get(c.context, *c.keysSecret, secret); err != nil {
+		return keys, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if secret.ResourceVersion != c.secretKeysVersion {
+		secretKeys := sopsKeys{}
+		for name, content := range secret.Data {
+			if strings.HasSuffix(name, sopsPGPKeyExtension) {
+				keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+				if err != nil {
+					return keys, fmt.Errorf("unable to read PGP keys from %s in secret %s: %v", name, c.keysSecret, err)
+				}
+				secretKeys.keyring = append(secretKeys.keyring, keyring...)
+				continue
+			}
+			identities, err := age.ParseIdentities(bytes.NewReader(content))
+			if err != nil {
+				return keys, fmt.Errorf("unable to read age identities from %s in secret %s: %v", name, c.keysSecret, err)
+			}
+			secretKeys.identities = append(secretKeys.identities, identities...)
+		}
+		c.secretKeys = secretKeys
+		c.secretKeysVersion = secret.ResourceVersion
+		// Data keys decrypted with removed keys can't be used anymore
+		c.dataKeys = make(map[string]sopsDataKey)
+	}
+
+	keys.identities = append(keys.identities, c.secretKeys.identities...)
+	keys.keyring = append(keys.keyring, c.secretKeys.keyring...)
+	return keys, nil
+}
+
+// decryptDataKey returns the key the file values are encrypted with, decrypting it
+// with the first age or PGP master key that matches the available keys. The data key
+// of each file is cached until the file is encrypted again or the keys Secret changes.
+func (c *sopsClient) decryptDataKey(file string, metadata sopsMetadata) ([]byte, error) {
+	keys, err := c.getKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	cached, ok := c.dataKeys[file]
+	c.mutex.Unlock()
+	if ok {
+		for _, masterKey := range append(metadata.Age, metadata.PGP...) {
+			if masterKey.Enc == cached.enc {
+				return cached.key, nil
+			}
+		}
+	}
+
+	for _, masterKey := range metadata.Age {
+		if len(keys.identities) == 0 {
+			break
+		}
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(masterKey.Enc)), keys.identities...)
+		if err != nil {
+			c.logger.V(1).Info("unable to decrypt data key with age", "recipient", masterKey.Recipient, "error", err.Error())
+			continue
+		}
+		return c.cacheDataKey(file, masterKey.Enc, r)
+	}
+
+	for _, masterKey := range metadata.PGP {
+		if len(keys.keyring) == 0 {
+			break
+		}
+		block, err := pgparmor.Decode(strings.NewReader(masterKey.Enc))
+		if err != nil {
+			c.logger.V(1).Info("unable to decode PGP data key", "fingerprint", masterKey.Fingerprint, "error", err.Error())
+			continue
+		}
+		md, err := openpgp.ReadMessage(block.Body, keys.keyring, nil, nil)
+		if err != nil {
+			c.logger.V(1).Info("unable to decrypt data key with PGP", "fingerprint", masterKey.Fingerprint, "error", err.Error())
+			continue
+		}
+		return c.cacheDataKey(file, masterKey.Enc, md.UnverifiedBody)
+	}
+
+	return nil, fmt.Errorf("none of the available keys can decrypt the data key")
+}
+
+func (c *sopsClient) cacheDataKey(file string, enc string, r io.Reader) ([]byte, error) {
+	dataKey, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.dataKeys[file] = sopsDataKey{enc: enc, key: dataKey}
+	c.mutex.Unlock()
+	return dataKey, nil
+}
+
+// openSopsValue decrypts a SOPS encrypted value with the additional authenticated data, returning
+// its plaintext and type. encrypted is false, and nothing is returned, if the value isn't encrypted.
+func openSopsValue(value string, dataKey []byte, aad string) (plaintext []byte, valueType string, encrypted bool, err error) {
+	match := sopsEncryptedValueRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return nil, "", false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(match[1])
+	if err != nil {
+		return nil, "", true, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(match[2])
+	if err != nil {
+		return nil, "", true, err
+	}
+	tag, err := base64.StdEncoding.DecodeString(match[3])
+	if err != nil {
+		return nil, "", true, err
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, "", true, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, "", true, err
+	}
+	plaintext, err = gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	return plaintext, match[4], true, err
+}
+
+// sopsAdditionalData returns the additional authenticated data of the value the path of keys leads to
+func sopsAdditionalData(path []string) string {
+	return strings.Join(path, sopsAADPathSeparator) + sopsAADPathSeparator
+}
+
+// decryptSopsValue decrypts a single SOPS value. The additional authenticated data is the
+// path of keys leading to the value, so values can't be moved around the document.
+func decryptSopsValue(value string, dataKey []byte, path []string) (interface{}, error) {
+	plaintext, valueType, encrypted, err := openSopsValue(value, dataKey, sopsAdditionalData(path))
+	if !encrypted {
+		return value, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt value at %s: %v", strings.Join(path, "/"), err)
+	}
+
+	switch valueType {
+	case sopsTypeInt:
+		return strconv.ParseInt(string(plaintext), 10, 64)
+	case sopsTypeFloat:
+		return strconv.ParseFloat(string(plaintext), 64)
+	case sopsTypeBool:
+		return strconv.ParseBool(string(plaintext))
+	default:
+		return string(plaintext), nil
+	}
+}
+
+// verifySopsMAC checks the MAC of a file, the SHA512 of all its values in order, encrypted with its
+// last modification time as authenticated data, so values can't be added, removed or replaced by
+// values of other files. Unencrypted values are only left out if the file says so.
+func verifySopsMAC(leaves []sopsLeaf, metadata sopsMetadata, dataKey []byte) error {
+	lastModified, err := time.Parse(time.RFC3339, metadata.LastModified)
+	if err != nil {
+		return fmt.Errorf("invalid last modification time: %v", err)
+	}
+	mac, _, encrypted, err := openSopsValue(metadata.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if !encrypted || err != nil {
+		return fmt.Errorf("unable to decrypt the MAC: %v", err)
+	}
+
+	hash := sha512.New()
+	for _, leaf := range leaves {
+		if value, ok := leaf.value.(string); ok {
+			plaintext, _, encrypted, err := openSopsValue(value, dataKey, sopsAdditionalData(leaf.path))
+			if encrypted {
+				if err != nil {
+					return fmt.Errorf("unable to decrypt value at %s: %v", strings.Join(leaf.path, "/"), err)
+				}
+				hash.Write(plaintext)
+				continue
+			}
+		}
+		if !metadata.MACOnlyEncrypted {
+			hash.Write(sopsValueBytes(leaf.value))
+		}
+	}
+	if fmt.Sprintf("%X", hash.Sum(nil)) != string(mac) {
+		return fmt.Errorf("MAC mismatch")
+	}
+	return nil
+}
+
+// sopsValueBytes returns an unencrypted value the way SOPS adds it to the MAC
+func sopsValueBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(v)
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		if v {
+			return []byte("True")
+		}
+		return []byte("False")
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// sopsDocumentLeaves returns the values of a YAML or JSON document in order, as the MAC depends on it.
+// List items share the path of the list itself.
+func sopsDocumentLeaves(node interface{}, path []string) []sopsLeaf {
+	switch n := node.(type) {
+	case yamlv2.MapSlice:
+		var leaves []sopsLeaf
+		for _, item := range n {
+			key := fmt.Sprint(item.Key)
+			if len(path) == 0 && key == sopsMetadataKey {
+				continue
+			}
+			leaves = append(leaves, sopsDocumentLeaves(item.Value, append(append([]string{}, path...), key))...)
+		}
+		return leaves
+	case []interface{}:
+		var leaves []sopsLeaf
+		for _, v := range n {
+			leaves = append(leaves, sopsDocumentLeaves(v, path)...)
+		}
+		return leaves
+	default:
+		return []sopsLeaf{{path: path, value: n}}
+	}
+}
+
+func decryptSopsTree(node interface{}, dataKey []byte, path []string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		tree := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			childPath := append(append([]string{}, path...), k)
+			value, err := decryptSopsTree(v, dataKey, childPath)
+			if err != nil {
+				return nil, err
+			}
+			tree[k] = value
+		}
+		return tree, nil
+	case []interface{}:
+		// List items share the path of the list itself
+		list := make([]interface{}, len(n))
+		for i, v := range n {
+			value, err := decryptSopsTree(v, dataKey, path)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case string:
+		return decryptSopsValue(n, dataKey, path)
+	default:
+		return n, nil
+	}
+}
+
+// parseSopsDotenv reads a dotenv file, where SOPS flattens its metadata into sops_ prefixed keys
+func parseSopsDotenv(content []byte) (map[string]interface{}, []sopsLeaf, sopsMetadata, error) {
+	document := make(map[string]interface{})
+	var leaves []sopsLeaf
+	masterKeys := map[string]map[int]*sopsMasterKey{"age": {}, "pgp": {}}
+	metadata := sopsMetadata{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, metadata, fmt.Errorf("invalid dotenv line %q", line)
+		}
+		value := strings.ReplaceAll(parts[1], "\\n", "\n")
+		if !strings.HasPrefix(parts[0], sopsDotenvPrefix) {
+			document[parts[0]] = value
+			leaves = append(leaves, sopsLeaf{path: []string{parts[0]}, value: value})
+			continue
+		}
+		switch parts[0] {
+		case sopsDotenvPrefix + "lastmodified":
+			metadata.LastModified = value
+		case sopsDotenvPrefix + "mac":
+			metadata.MAC = value
+		case sopsDotenvPrefix + "mac_only_encrypted":
+			metadata.MACOnlyEncrypted, _ = strconv.ParseBool(value)
+		}
+		match := sopsDotenvMetadataRegexp.FindStringSubmatch(parts[0])
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[2])
+		masterKey, ok := masterKeys[match[1]][index]
+		if !ok {
+			masterKey = &sopsMasterKey{}
+			masterKeys[match[1]][index] = masterKey
+		}
+		switch match[3] {
+		case "enc":
+			masterKey.Enc = value
+		case "recipient":
+			masterKey.Recipient = value
+		case "fp":
+			masterKey.Fingerprint = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, metadata, err
+	}
+
+	for i := 0; i < len(masterKeys["age"]); i++ {
+		if masterKey, ok := masterKeys["age"][i]; ok {
+			metadata.Age = append(metadata.Age, *masterKey)
+		}
+	}
+	for i := 0; i < len(masterKeys["pgp"]); i++ {
+		if masterKey, ok := masterKeys["pgp"][i]; ok {
+			metadata.PGP = append(metadata.PGP, *masterKey)
+		}
+	}
+	return document, leaves, metadata, nil
+}
+
+// parseSopsDocument reads a YAML or JSON file, with the SOPS metadata under the sops key
+func parseSopsDocument(content []byte) (map[string]interface{}, []sopsLeaf, sopsMetadata, error) {
+	document := make(map[string]interface{})
+	metadata := sopsMetadata{}
+
+	jsonContent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, nil, metadata, err
+	}
+	if err = json.Unmarshal(jsonContent, &document); err != nil {
+		return nil, nil, metadata, err
+	}
+
+	rawMetadata, err := json.Marshal(document[sopsMetadataKey])
+	if err != nil {
+		return nil, nil, metadata, err
+	}
+	if err = json.Unmarshal(rawMetadata, &metadata); err != nil {
+		return nil, nil, metadata, err
+	}
+	delete(document, sopsMetadataKey)
+
+	// The document is read again keeping the order of its keys, which the MAC depends on
+	ordered := yamlv2.MapSlice{}
+	if err = yamlv2.Unmarshal(content, &ordered); err != nil {
+		return nil, nil, metadata, err
+	}
+	return document, sopsDocumentLeaves(ordered, nil), metadata, nil
+}
+
+// splitPath returns the encrypted file referenced by path and the keys leading to
+// a nested value inside of it
+func (c *sopsClient) splitPath(path string) (string, []string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i <= len(parts); i++ {
+		file, err := c.files.resolvePath(strings.Join(parts[:i], "/"))
+		if err != nil {
+			return "", nil, err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", nil, err
+		}
+		if !info.IsDir() {
+			return file, parts[i:], nil
+		}
+	}
+	return "", nil, os.ErrNotExist
+}
+
+func (c *sopsClient) readSecret(path string, key string) (interface{}, error) {
+	file, nested, err := c.splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := c.files.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	var leaves []sopsLeaf
+	var metadata sopsMetadata
+	if filepath.Ext(file) == sopsDotenvExtension {
+		document, leaves, metadata, err = parseSopsDotenv(content)
+	} else {
+		document, leaves, metadata, err = parseSopsDocument(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Age) == 0 && len(metadata.PGP) == 0 {
+		return nil, fmt.Errorf("file %s is not encrypted with age or PGP keys", path)
+	}
+
+	if key != "" {
+		nested = append(nested, key)
+	}
+
+	// Only the requested value is decrypted, with the keys leading to it as authenticated data
+	var node interface{} = document
+	for _, k := range nested {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		if node, ok = m[k]; !ok {
+			return nil, os.ErrNotExist
+		}
+	}
+
+	dataKey, err := c.decryptDataKey(file, metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySopsMAC(leaves, metadata, dataKey); err != nil {
+		return nil, fmt.Errorf("file %s can't be trusted: %v", path, err)
+	}
+	return decryptSopsTree(node, dataKey, nested)
+}
+
+// ReadSecret decrypts the SOPS encrypted YAML, JSON or dotenv file at path, relative to
+// the root directory. The path can go on with the keys leading to a nested value inside
+// the file, and key selects a field of it. Non string values are returned as JSON.
+func (c *sopsClient) ReadSecret(path string, key string) (string, error) {
+	value, err := c.readSecret(path, key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+			return "", &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
+		}
+		if os.IsPermission(err) {
+			c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.BackendSecretForbiddenErrorType)
+			return "", &errors.BackendSecretForbiddenError{ErrType: errors.BackendSecretForbiddenErrorType, Path: path, Key: key}
+		}
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return "", err
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		c.metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	sopsLabelNames            = []string{"sops_root"}
+	sopsSecretReadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "sops",
+		Name:      "read_secret_errors_total",
+		Help:      "SOPS backend read operations counter",
+	}, append(sopsLabelNames, secretLabelNames...))
+)
+
+type sopsBackendMetrics struct {
+	labels map[string]string
+}
+
+func init() {
+	r := metrics.Registry
+	r.MustRegister(sopsSecretReadErrorsTotal)
+}
+
+func newSopsBackendMetrics(root string) *sopsBackendMetrics {
+	labels := make(map[string]string, len(sopsLabelNames))
+	labels["sops_root"] = root
+
+	return &sopsBackendMetrics{labels: labels}
+}
+
+func (m *sopsBackendMetrics) updateSecretReadErrorsTotalMetric(path string, key string, errorType string) {
+	sopsSecretReadErrorsTotal.WithLabelValues(
+		m.labels["sops_root"],
+		path,
+		key,
+		errorType,
+	).Inc()
+}
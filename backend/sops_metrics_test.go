@@ -0,0 +1,23 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const fakeSopsRoot = "/etc/sops"
+
+func TestSopsUpdateReadSecretErrorsTotal(t *testing.T) {
+	path := "app/db.yaml"
+	key := "password"
+
+	metrics := newSopsBackendMetrics(fakeSopsRoot)
+	sopsSecretReadErrorsTotal.Reset()
+	metrics.updateSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+	metricSecretReadErrorsTotal, _ := sopsSecretReadErrorsTotal.GetMetricWithLabelValues(fakeSopsRoot, path, key, errors.UnknownErrorType)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
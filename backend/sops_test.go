@@ -0,0 +1,220 @@
+package backend
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tuenti/secrets-manager/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	sopsTestRoot       = "testdata/sops"
+	sopsTestAgeKeyFile = "testdata/sops-keys/age.key"
+	sopsTestPGPKeyFile = "testdata/sops-keys/pgp.asc"
+)
+
+func TestSopsBackendClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot})
+	assert.NotNilf(t, err, "Missing keys should generate an error")
+	assert.Nil(t, client)
+
+	client, err = sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsAgeKeyFile: "testdata/sops-keys/not-found"})
+	assert.NotNilf(t, err, "Non existing key file should generate an error")
+	assert.Nil(t, client)
+
+	client, err = sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsKeysSecret: "sops-keys"})
+	assert.NotNilf(t, err, "Keys secret without namespace should generate an error")
+	assert.Nil(t, client)
+
+	client, err = sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsKeysSecret: "default/sops-keys"})
+	assert.NotNilf(t, err, "Keys secret without a Kubernetes client should generate an error")
+	assert.Nil(t, client)
+
+	client, err = sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsAgeKeyFile: sopsTestAgeKeyFile})
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestSopsClientReadSecretAge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsAgeKeyFile: sopsTestAgeKeyFile})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("app/db.yaml/database", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("app/db.yaml/database", "port")
+	assert.Nil(t, err)
+	assert.Equal(t, "5432", value)
+
+	value, err = client.ReadSecret("app/db.yaml/database", "tls")
+	assert.Nil(t, err)
+	assert.Equal(t, "true", value)
+
+	value, err = client.ReadSecret("app/db.yaml/database", "replicas")
+	assert.Nil(t, err)
+	assert.Equal(t, `["db-0","db-1"]`, value)
+
+	value, err = client.ReadSecret("app/db.yaml", "token_unencrypted")
+	assert.Nil(t, err)
+	assert.Equal(t, "visible", value)
+
+	value, err = client.ReadSecret("app/app.json/api", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "ap1k3y", value)
+
+	value, err = client.ReadSecret("app/app.json", "ratio")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.5", value)
+
+	value, err = client.ReadSecret("app/app.env", "DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = client.ReadSecret("app/app.env", "GREETING_unencrypted")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\nworld", value)
+
+	sopsSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("app/db.yaml/database", "not-found")
+	metricSecretReadErrorsTotal, _ := sopsSecretReadErrorsTotal.GetMetricWithLabelValues(sopsTestRoot, "app/db.yaml/database", "not-found", errors.BackendSecretNotFoundErrorType)
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, "", value)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	value, err = client.ReadSecret("app/not-found.yaml", "password")
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsBackendSecretNotFound(err))
+	assert.Equal(t, "", value)
+
+	sopsSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("../sops-keys/age.key", "")
+	metricSecretReadErrorsTotal, _ = sopsSecretReadErrorsTotal.GetMetricWithLabelValues(sopsTestRoot, "../sops-keys/age.key", "", errors.BackendSecretForbiddenErrorType)
+	assert.NotNil(t, err)
+	assert.True(t, errors.IsBackendSecretForbidden(err))
+	assert.Equal(t, "", value)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+
+	sopsSecretReadErrorsTotal.Reset()
+	value, err = client.ReadSecret("app/db.pgp.yaml/database", "password")
+	metricSecretReadErrorsTotal, _ = sopsSecretReadErrorsTotal.GetMetricWithLabelValues(sopsTestRoot, "app/db.pgp.yaml/database", "password", errors.UnknownErrorType)
+	assert.NotNilf(t, err, "Files encrypted for other keys should generate an error")
+	assert.Equal(t, "", value)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricSecretReadErrorsTotal))
+}
+
+func TestSopsClientReadSecretPGP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := sopsBackendClient(ctx, logger, Config{SopsRoot: sopsTestRoot, SopsPGPKeyFile: sopsTestPGPKeyFile})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("app/db.pgp.yaml/database", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+
+	value, err = client.ReadSecret("app/db.pgp.yaml/database/replicas", "")
+	assert.Nil(t, err)
+	assert.Equal(t, `["db-0","db-1"]`, value)
+
+	content, err := ioutil.ReadFile(filepath.Join(sopsTestRoot, "app", "db.pgp.yaml"))
+	assert.Nil(t, err)
+	root := t.TempDir()
+	invalidFirst := strings.Replace(string(content), "    pgp:\n", "    pgp:\n        - enc: not an armored message\n          fp: DEADBEEF\n", 1)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "db.yaml"), []byte(invalidFirst), 0600))
+
+	client, err = sopsBackendClient(ctx, logger, Config{SopsRoot: root, SopsPGPKeyFile: sopsTestPGPKeyFile})
+	assert.Nil(t, err)
+	value, err = client.ReadSecret("db.yaml/database", "user")
+	assert.Nilf(t, err, "Invalid master keys should be skipped")
+	assert.Equal(t, "admin", value)
+}
+
+func TestSopsClientReadSecretKeysSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ageKey, err := ioutil.ReadFile(sopsTestAgeKeyFile)
+	assert.Nil(t, err)
+	pgpKey, err := ioutil.ReadFile(sopsTestPGPKeyFile)
+	assert.Nil(t, err)
+
+	reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "secrets-manager", Name: "sops-keys"},
+		Data: map[string][]byte{
+			"keys.txt": ageKey,
+			"key.asc":  pgpKey,
+		},
+	}).Build()
+
+	client, err := sopsBackendClient(ctx, logger, Config{
+		SopsRoot:         sopsTestRoot,
+		SopsKeysSecret:   "secrets-manager/sops-keys",
+		KubernetesReader: reader,
+	})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret(filepath.Join("app", "db.yaml", "database"), "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+
+	value, err = client.ReadSecret("app/db.pgp.yaml/database", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	secret := &corev1.Secret{}
+	assert.Nil(t, reader.Get(ctx, types.NamespacedName{Namespace: "secrets-manager", Name: "sops-keys"}, secret))
+	delete(secret.Data, "keys.txt")
+	assert.Nil(t, reader.Update(ctx, secret))
+
+	value, err = client.ReadSecret("app/db.yaml/database", "user")
+	assert.NotNilf(t, err, "Files should not be decrypted with removed keys")
+	assert.Equal(t, "", value)
+
+	value, err = client.ReadSecret("app/db.pgp.yaml/database", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", value)
+}
+
+func TestSopsClientReadSecretTampered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	content, err := ioutil.ReadFile(filepath.Join(sopsTestRoot, "app", "db.yaml"))
+	assert.Nil(t, err)
+	lines := strings.Split(string(content), "\n")
+	root := t.TempDir()
+
+	tampered := strings.Replace(string(content), "token_unencrypted: visible", "token_unencrypted: changed", 1)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "replaced.yaml"), []byte(tampered), 0600))
+	lines[4], lines[5] = lines[5], lines[4]
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "reordered.yaml"), []byte(strings.Join(lines, "\n")), 0600))
+
+	client, err := sopsBackendClient(ctx, logger, Config{SopsRoot: root, SopsAgeKeyFile: sopsTestAgeKeyFile})
+	assert.Nil(t, err)
+
+	value, err := client.ReadSecret("replaced.yaml", "token_unencrypted")
+	assert.NotNilf(t, err, "Files with replaced values should generate an error")
+	assert.Equal(t, "", value)
+
+	value, err = client.ReadSecret("reordered.yaml/database", "password")
+	assert.NotNilf(t, err, "Files with reordered values should generate an error")
+	assert.Equal(t, "", value)
+}
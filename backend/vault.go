@@ -8,37 +8,54 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/vault/api"
 	"github.com/tuenti/secrets-manager/errors"
+	"k8s.io/client-go/kubernetes"
 )
 
-var vMetrics *vaultMetrics
-
 const (
 	defaultSecretKey       = "data"
 	kubernetesJwtTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 	kubernetesAuthMethod   = "kubernetes"
 	appRoleAuthMethod      = "approle"
+	certAuthMethod         = "cert"
+	jwtAuthMethod          = "jwt"
+	tokenFileAuthMethod    = "token-file"
 )
 
 type client struct {
-	vclient            *api.Client
-	logical            *api.Logical
-	roleID             string
-	authMethod         string
-	secretID           string
-	kubernetesRole     string
-	maxTokenTTL        int64
-	tokenPollingPeriod time.Duration
-	renewTTLIncrement  int
-	engine             engine
-	approlePath        string
-	kubernetesPath     string
-	logger             logr.Logger
+	vclient             *api.Client
+	logical             *api.Logical
+	roleID              string
+	authMethod          string
+	secretID            string
+	kubernetesRole      string
+	maxTokenTTL         int64
+	tokenPollingPeriod  time.Duration
+	renewTTLIncrement   int
+	engine              engine
+	pathEngines         *pathEngines
+	approlePath         string
+	kubernetesPath      string
+	certRole            string
+	certPath            string
+	jwtRole             string
+	jwtPath             string
+	jwtTokenFile        string
+	tokenFile           string
+	tokenFileWatcher    *fsnotify.Watcher
+	identities          *namespaceIdentities
+	kubernetesClientset kubernetes.Interface
+	tls                 *vaultTLS
+	metrics             *vaultMetrics
+	logger              logr.Logger
 }
 
 func (c *client) vaultLogin() error {
@@ -50,6 +67,18 @@ func (c *client) vaultLogin() error {
 			return err
 		}
 		return c.vaultKubernetesLogin(fd)
+	case certAuthMethod:
+		return c.vaultCertLogin()
+	case jwtAuthMethod:
+		// The token is read on every login, as projected tokens are rotated by the kubelet
+		fd, err := os.Open(c.jwtTokenFile)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		return c.vaultJWTLogin(fd)
+	case tokenFileAuthMethod:
+		return c.vaultTokenFileLogin()
 	case appRoleAuthMethod:
 		fallthrough
 	default:
@@ -87,47 +116,160 @@ func (c *client) vaultKubernetesLogin(podSATokenReader io.Reader) error {
 	return nil
 }
 
+func (c *client) vaultJWTLogin(tokenReader io.Reader) error {
+	jwt, err := ioutil.ReadAll(tokenReader)
+	if err != nil {
+		return err
+	}
+	login := map[string]interface{}{
+		"jwt":  strings.TrimSpace(string(jwt)),
+		"role": c.jwtRole,
+	}
+	resp, err := c.logical.Write(fmt.Sprintf("auth/%s/login", c.jwtPath), login)
+	if err != nil {
+		return err
+	}
+	c.vclient.SetToken(resp.Auth.ClientToken)
+	return nil
+}
+
+// vaultTokenFileLogin uses the token written to a file by another process, like a Vault Agent sink
+func (c *client) vaultTokenFileLogin() error {
+	token, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return err
+	}
+	// The file can be briefly empty while it's rewritten, the current token is kept meanwhile
+	if strings.TrimSpace(string(token)) == "" {
+		return fmt.Errorf("vault token file %s is empty", c.tokenFile)
+	}
+	c.vclient.SetToken(strings.TrimSpace(string(token)))
+	return nil
+}
+
+// vaultCertLogin logs in with the client certificate of the TLS configuration, which is presented
+// during the handshake. If no role is set, Vault tries all the roles matching the certificate.
+func (c *client) vaultCertLogin() error {
+	cert := map[string]interface{}{}
+	if c.certRole != "" {
+		cert["name"] = c.certRole
+	}
+	resp, err := c.logical.Write(fmt.Sprintf("auth/%s/login", c.certPath), cert)
+	if err != nil {
+		return err
+	}
+	c.vclient.SetToken(resp.Auth.ClientToken)
+	return nil
+}
+
 func vaultClient(l logr.Logger, cfg Config) (*client, error) {
 	logger := l.WithName("vault").WithValues(
 		"vault_url", cfg.VaultURL,
 		"vault_engine", cfg.VaultEngine)
 
+	if cfg.VaultAuthMethod == certAuthMethod && cfg.VaultClientCert == "" {
+		err := fmt.Errorf("vault cert auth method requires a client certificate")
+		logger.Error(err, "unable to setup vault cert authentication")
+		return nil, err
+	}
+
+	if cfg.VaultAuthMethod == jwtAuthMethod && cfg.VaultJWTTokenFile == "" {
+		err := fmt.Errorf("vault jwt auth method requires a token file")
+		logger.Error(err, "unable to setup vault jwt authentication")
+		return nil, err
+	}
+
+	vaultTLS, err := newVaultTLS(logger, cfg)
+	if err != nil {
+		logger.Error(err, "unable to setup vault TLS configuration")
+		return nil, err
+	}
+
 	httpClient := new(http.Client)
 	httpClient.Timeout = cfg.BackendTimeout
+	httpClient.Transport = vaultTLS.transport
 
 	vclient, err := api.NewClient(&api.Config{Address: cfg.VaultURL, HttpClient: httpClient})
 
 	if err != nil {
 		logger.Error(err, "unable to create vault api client")
+		vaultTLS.close()
 		return nil, err
 	}
+	// The token only comes from the authentication method, never from VAULT_TOKEN
+	vclient.ClearToken()
 
+	if cfg.VaultNamespace != "" {
+		vclient.SetNamespace(cfg.VaultNamespace)
+	}
 	logical := vclient.Logical()
 
 	engine, err := newEngine(cfg.VaultEngine)
 	if err != nil {
 		logger.Error(err, "unable to setup vault engine")
+		vaultTLS.close()
 		return nil, err
 	}
 
 	client := client{
-		vclient:            vclient,
-		logical:            logical,
-		authMethod:         cfg.VaultAuthMethod,
-		roleID:             cfg.VaultRoleID,
-		secretID:           cfg.VaultSecretID,
-		kubernetesRole:     cfg.VaultKubernetesRole,
-		maxTokenTTL:        cfg.VaultMaxTokenTTL,
-		tokenPollingPeriod: cfg.VaultTokenPollingPeriod,
-		renewTTLIncrement:  cfg.VaultRenewTTLIncrement,
-		engine:             engine,
-		approlePath:        cfg.VaultApprolePath,
-		kubernetesPath:     cfg.VaultKubernetesPath,
+		vclient:             vclient,
+		logical:             logical,
+		authMethod:          cfg.VaultAuthMethod,
+		roleID:              cfg.VaultRoleID,
+		secretID:            cfg.VaultSecretID,
+		kubernetesRole:      cfg.VaultKubernetesRole,
+		maxTokenTTL:         cfg.VaultMaxTokenTTL,
+		tokenPollingPeriod:  cfg.VaultTokenPollingPeriod,
+		renewTTLIncrement:   cfg.VaultRenewTTLIncrement,
+		engine:              engine,
+		pathEngines:         newPathEngines(),
+		approlePath:         cfg.VaultApprolePath,
+		kubernetesPath:      cfg.VaultKubernetesPath,
+		certRole:            cfg.VaultCertRole,
+		certPath:            cfg.VaultCertPath,
+		jwtRole:             cfg.VaultJWTRole,
+		jwtPath:             cfg.VaultJWTPath,
+		jwtTokenFile:        cfg.VaultJWTTokenFile,
+		tokenFile:           cfg.VaultTokenFile,
+		tls:                 vaultTLS,
+		kubernetesClientset: cfg.KubernetesClientset,
+	}
+
+	client.identities, err = newNamespaceIdentities(cfg)
+	if err != nil {
+		logger.Error(err, "unable to setup vault namespace identities")
+		vaultTLS.close()
+		return nil, err
+	}
+
+	if client.authMethod == tokenFileAuthMethod {
+		if client.tokenFile == "" {
+			err = fmt.Errorf("vault token-file auth method requires a token file")
+			logger.Error(err, "unable to setup vault token-file authentication")
+			vaultTLS.close()
+			return nil, err
+		}
+		// The directory is watched, as the token file is usually replaced instead of written in place
+		client.tokenFileWatcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			vaultTLS.close()
+			return nil, err
+		}
+		if err = client.tokenFileWatcher.Add(filepath.Dir(client.tokenFile)); err != nil {
+			client.tokenFileWatcher.Close()
+			logger.Error(err, "unable to watch vault token file", "token_file", client.tokenFile)
+			vaultTLS.close()
+			return nil, err
+		}
 	}
 
 	err = client.vaultLogin()
 	if err != nil {
 		logger.Error(err, "unable to login to vault with provided credentials")
+		if client.tokenFileWatcher != nil {
+			client.tokenFileWatcher.Close()
+		}
+		vaultTLS.close()
 		return nil, err
 	}
 
@@ -136,6 +278,10 @@ func vaultClient(l logr.Logger, cfg Config) (*client, error) {
 
 	if err != nil {
 		logger.Error(err, "could not get health information about vault cluster")
+		if client.tokenFileWatcher != nil {
+			client.tokenFileWatcher.Close()
+		}
+		vaultTLS.close()
 		return nil, err
 	}
 
@@ -151,9 +297,9 @@ func vaultClient(l logr.Logger, cfg Config) (*client, error) {
 
 	client.logger = logger
 
-	vMetrics = newVaultMetrics(cfg.VaultURL, health.Version, cfg.VaultEngine, health.ClusterID, health.ClusterName)
+	client.metrics = newVaultMetrics(cfg.VaultURL, health.Version, cfg.VaultEngine, health.ClusterID, health.ClusterName)
 
-	vMetrics.updateVaultMaxTokenTTLMetric(cfg.VaultMaxTokenTTL)
+	client.metrics.updateVaultMaxTokenTTLMetric(cfg.VaultMaxTokenTTL)
 
 	return &client, err
 }
@@ -162,7 +308,7 @@ func (c *client) getToken() (*api.Secret, error) {
 	auth := c.vclient.Auth()
 	lookup, err := auth.Token().LookupSelf()
 	if err != nil {
-		vMetrics.updateVaultTokenRenewalErrorsTotalMetric(vaultLookupSelfOperationName, errors.UnknownErrorType)
+		c.metrics.updateVaultTokenRenewalErrorsTotalMetric(vaultLookupSelfOperationName, errors.UnknownErrorType)
 		return nil, err
 	}
 	return lookup, nil
@@ -174,24 +320,24 @@ func (c *client) getTokenTTL(token *api.Secret) (int64, error) {
 	if err != nil {
 		return -1, err
 	}
-	vMetrics.updateVaultTokenTTLMetric(ttl)
+	c.metrics.updateVaultTokenTTLMetric(ttl)
 	return ttl, nil
 }
 
 func (c *client) renewToken(token *api.Secret) error {
 	isRenewable, err := token.TokenIsRenewable()
 	if err != nil {
-		vMetrics.updateVaultTokenRenewalErrorsTotalMetric(vaultIsRenewableOperationName, errors.UnknownErrorType)
+		c.metrics.updateVaultTokenRenewalErrorsTotalMetric(vaultIsRenewableOperationName, errors.UnknownErrorType)
 		return err
 	}
 	if !isRenewable {
-		vMetrics.updateVaultTokenRenewalErrorsTotalMetric(vaultIsRenewableOperationName, errors.VaultTokenNotRenewableErrorType)
+		c.metrics.updateVaultTokenRenewalErrorsTotalMetric(vaultIsRenewableOperationName, errors.VaultTokenNotRenewableErrorType)
 		err = &errors.VaultTokenNotRenewableError{ErrType: errors.VaultTokenNotRenewableErrorType}
 		return err
 	}
 	auth := c.vclient.Auth()
 	if _, err = auth.Token().RenewSelf(c.renewTTLIncrement); err != nil {
-		vMetrics.updateVaultTokenRenewalErrorsTotalMetric(vaultRenewSelfOperationName, errors.UnknownErrorType)
+		c.metrics.updateVaultTokenRenewalErrorsTotalMetric(vaultRenewSelfOperationName, errors.UnknownErrorType)
 		return err
 	}
 	return nil
@@ -203,7 +349,7 @@ func (c *client) renewalLoop() {
 		c.logger.Error(err, "unable to get vault token")
 		c.logger.Info("trying to login to vault again")
 		if err = c.vaultLogin(); err != nil {
-			vMetrics.updateVaultLoginErrorsTotalMetric()
+			c.metrics.updateVaultLoginErrorsTotalMetric()
 			c.logger.Error(err, "login error, vault token not obtained")
 		} else {
 			c.logger.Info("login successful, got a new vault token")
@@ -241,39 +387,195 @@ func (c *client) startTokenRenewer(ctx context.Context) {
 	}(ctx)
 }
 
+// startTokenFileWatcher swaps the client token whenever the token file changes
+func (c *client) startTokenFileWatcher(ctx context.Context) {
+	if c.tokenFileWatcher == nil {
+		return
+	}
+	go func() {
+		defer c.tokenFileWatcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-c.tokenFileWatcher.Events:
+				if !ok {
+					return
+				}
+				c.logger.V(1).Info("vault token file change detected", "file", event.Name, "operation", event.Op.String())
+				previous := c.vclient.Token()
+				if err := c.vaultTokenFileLogin(); err != nil {
+					c.metrics.updateVaultLoginErrorsTotalMetric()
+					c.logger.Error(err, "unable to read vault token file, keeping the current token", "token_file", c.tokenFile)
+					continue
+				}
+				if c.vclient.Token() != previous {
+					c.logger.Info("vault token file changed, using the new token", "token_file", c.tokenFile)
+				}
+			case err, ok := <-c.tokenFileWatcher.Errors:
+				if !ok {
+					return
+				}
+				c.logger.Error(err, "vault token file watcher error", "token_file", c.tokenFile)
+			}
+		}
+	}()
+}
+
 func (c *client) ReadSecret(path string, key string) (string, error) {
+	data, _, err := c.ReadSecretVersion(path, key, "")
+	return data, err
+}
+
+// ReadSecretVersion reads the given version of the secret at path, or the latest one if
+// version is empty. Only the kv2 engine keeps secret versions.
+func (c *client) ReadSecretVersion(path string, key string, version string) (string, string, error) {
 	data := ""
+	readVersion := ""
 	if key == "" {
 		key = defaultSecretKey
 	}
 
+	engine := c.pathEngine(path)
+	if engine.leased() {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, readVersion, fmt.Errorf("dynamic secret at %s must be read with a lease", path)
+	}
+
+	params, err := engine.readParams(version)
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.SecretVersionNotSupportedErrorType)
+		return data, readVersion, err
+	}
+
 	logical := c.logical
-	secret, err := logical.Read(path)
+	secret, err := logical.ReadWithData(path, params)
 	if err != nil {
-		vMetrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
-		return data, err
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.UnknownErrorType)
+		return data, readVersion, err
 	}
 
 	if secret != nil {
-		secretData := c.engine.getData(secret)
+		secretData := engine.getData(secret)
 		warnings := secret.Warnings
 		if secretData != nil {
 			if secretData[key] != nil {
 				data = secretData[key].(string)
+				readVersion = engine.getVersion(secret)
 			} else {
-				vMetrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+				c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
 				err = &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
 			}
 		} else {
 			for _, w := range warnings {
 				c.logger.Info("secret contains warnings", "vault_secret_warning", w)
 			}
-			vMetrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+			c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
 			err = &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
 		}
 	} else {
-		vMetrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, key, errors.BackendSecretNotFoundErrorType)
 		err = &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path, Key: key}
 	}
-	return data, err
+	return data, readVersion, err
+}
+
+// WithNamespace returns a client reading from the given Vault Enterprise namespace with the same token,
+// which must be allowed to access it. The namespace replaces the one of the client.
+func (c *client) WithNamespace(namespace string) (Client, error) {
+	vclient, err := c.vclient.Clone()
+	if err != nil {
+		return nil, err
+	}
+	vclient.SetToken(c.vclient.Token())
+	vclient.SetNamespace(namespace)
+
+	namespaced := *c
+	namespaced.vclient = vclient
+	namespaced.logical = vclient.Logical()
+	namespaced.pathEngines = newPathEngines()
+	return &namespaced, nil
+}
+
+// pathEngine returns the engine of the mount path is in, as reported by Vault, so that kv and dynamic
+// secrets can be read from the same backend. The configured engine is used if Vault doesn't report
+// a supported one, like when the token isn't allowed to read the path.
+func (c *client) pathEngine(path string) engine {
+	path = strings.TrimPrefix(path, "/")
+	if e, ok := c.pathEngines.get(path); ok {
+		return e
+	}
+
+	e := c.engine
+	mount, err := c.logical.Read("sys/internal/ui/mounts/" + path)
+	if err != nil {
+		// Only definitive answers are cached, so that the mount is looked up again after a transient error
+		if code := responseStatusCode(err); code == 0 || code >= http.StatusInternalServerError {
+			c.logger.Error(err, "unable to look up the mount of the path, using the configured engine", "path", path)
+			return e
+		}
+	} else if mount != nil {
+		mountType, _ := mount.Data["type"].(string)
+		options, _ := mount.Data["options"].(map[string]interface{})
+		if mountEngine := mountEngine(mountType, options); mountEngine != nil {
+			e = mountEngine
+		}
+	}
+	c.pathEngines.set(path, e)
+	return e
+}
+
+// IsLeased returns true if the engine of the mount of path issues dynamic secrets
+func (c *client) IsLeased(path string) bool {
+	return c.pathEngine(path).leased()
+}
+
+// ReadLeasedSecret issues new credentials at path, like database/creds/<role>
+func (c *client) ReadLeasedSecret(path string) (map[string]string, Lease, error) {
+	secret, err := c.logical.Read(path)
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return nil, Lease{}, err
+	}
+	if secret == nil || secret.Data == nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.BackendSecretNotFoundErrorType)
+		return nil, Lease{}, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path}
+	}
+
+	data := make(map[string]string)
+	for k, v := range secret.Data {
+		if s, ok := v.(string); ok {
+			data[k] = s
+		} else if v != nil {
+			data[k] = fmt.Sprint(v)
+		}
+	}
+	return data, vaultLease(secret), nil
+}
+
+// RenewLease renews the lease by its duration, which is capped by the lease max TTL
+func (c *client) RenewLease(lease Lease) (Lease, error) {
+	secret, err := c.vclient.Sys().Renew(lease.ID, int(lease.Duration.Seconds()))
+	if err != nil {
+		c.metrics.updateVaultLeaseErrorsTotalMetric(vaultRenewLeaseOperationName, errors.UnknownErrorType)
+		return lease, err
+	}
+	return vaultLease(secret), nil
+}
+
+// RevokeLease revokes the lease, so that the credentials can't be used anymore
+func (c *client) RevokeLease(lease Lease) error {
+	err := c.vclient.Sys().Revoke(lease.ID)
+	if err != nil {
+		c.metrics.updateVaultLeaseErrorsTotalMetric(vaultRevokeLeaseOperationName, errors.UnknownErrorType)
+	}
+	return err
+}
+
+func vaultLease(secret *api.Secret) Lease {
+	return Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}
 }
@@ -1,17 +1,27 @@
 package backend
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/hashicorp/vault/api"
 	"github.com/tuenti/secrets-manager/errors"
 )
 
 const (
-	kvEngineV1Name = "kv1"
-	kvEngineV2Name = "kv2"
+	kvEngineV1Name     = "kv1"
+	kvEngineV2Name     = "kv2"
+	databaseEngineName = "database"
+	awsEngineName      = "aws"
+	rabbitMQEngineName = "rabbitmq"
+	kvMountType        = "kv"
 )
 
 type engine interface {
 	getData(s *api.Secret) map[string]interface{}
+	getVersion(s *api.Secret) string
+	readParams(version string) (map[string][]string, error)
+	leased() bool
 }
 
 type kvEngineV1 struct {
@@ -22,6 +32,11 @@ type kvEngineV2 struct {
 	name string
 }
 
+// dynamicEngine issues new credentials with their own lease on every read
+type dynamicEngine struct {
+	name string
+}
+
 func (e kvEngineV1) getData(s *api.Secret) map[string]interface{} {
 	return s.Data
 }
@@ -33,6 +48,59 @@ func (e kvEngineV2) getData(s *api.Secret) map[string]interface{} {
 	return s.Data["data"].(map[string]interface{})
 }
 
+func (e kvEngineV1) getVersion(s *api.Secret) string {
+	return ""
+}
+
+func (e kvEngineV2) getVersion(s *api.Secret) string {
+	metadata, ok := s.Data["metadata"].(map[string]interface{})
+	if !ok || metadata["version"] == nil {
+		return ""
+	}
+	return fmt.Sprint(metadata["version"])
+}
+
+func (e kvEngineV1) readParams(version string) (map[string][]string, error) {
+	if version != "" {
+		return nil, &errors.SecretVersionNotSupportedError{ErrType: errors.SecretVersionNotSupportedErrorType, Backend: "vault " + e.name}
+	}
+	return nil, nil
+}
+
+func (e kvEngineV2) readParams(version string) (map[string][]string, error) {
+	if version == "" {
+		return nil, nil
+	}
+	return map[string][]string{"version": {version}}, nil
+}
+
+func (e kvEngineV1) leased() bool {
+	return false
+}
+
+func (e kvEngineV2) leased() bool {
+	return false
+}
+
+func (e dynamicEngine) getData(s *api.Secret) map[string]interface{} {
+	return s.Data
+}
+
+func (e dynamicEngine) getVersion(s *api.Secret) string {
+	return ""
+}
+
+func (e dynamicEngine) readParams(version string) (map[string][]string, error) {
+	if version != "" {
+		return nil, &errors.SecretVersionNotSupportedError{ErrType: errors.SecretVersionNotSupportedErrorType, Backend: "vault " + e.name}
+	}
+	return nil, nil
+}
+
+func (e dynamicEngine) leased() bool {
+	return true
+}
+
 func newEngine(eng string) (engine, error) {
 	if eng == "" {
 		eng = kvEngineV2Name
@@ -42,7 +110,48 @@ func newEngine(eng string) (engine, error) {
 		return kvEngineV1{name: kvEngineV1Name}, nil
 	case kvEngineV2Name:
 		return kvEngineV2{name: kvEngineV2Name}, nil
+	case databaseEngineName, awsEngineName, rabbitMQEngineName:
+		return dynamicEngine{name: eng}, nil
 	default:
 		return nil, &errors.VaultEngineNotImplementedError{ErrType: errors.VaultEngineNotImplementedErrorType, Engine: eng}
 	}
 }
+
+// mountEngine returns the engine of a mount of the given type and options, or nil if it isn't supported
+func mountEngine(mountType string, options map[string]interface{}) engine {
+	switch mountType {
+	case kvMountType:
+		if fmt.Sprint(options["version"]) == "2" {
+			return kvEngineV2{name: kvEngineV2Name}
+		}
+		return kvEngineV1{name: kvEngineV1Name}
+	case databaseEngineName, awsEngineName, rabbitMQEngineName:
+		return dynamicEngine{name: mountType}
+	default:
+		return nil
+	}
+}
+
+// pathEngines caches the engine of the mounts of the paths read, so that a single backend can
+// read both kv secrets and dynamic secrets
+type pathEngines struct {
+	mutex   sync.Mutex
+	engines map[string]engine
+}
+
+func newPathEngines() *pathEngines {
+	return &pathEngines{engines: make(map[string]engine)}
+}
+
+func (p *pathEngines) get(path string) (engine, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	e, ok := p.engines[path]
+	return e, ok
+}
+
+func (p *pathEngines) set(path string, e engine) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.engines[path] = e
+}
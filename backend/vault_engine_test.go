@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -23,6 +24,15 @@ func TestNewEngineKV2(t *testing.T) {
 	assert.Equal(t, eng, engine.(kvEngineV2).name)
 }
 
+func TestNewEngineDynamic(t *testing.T) {
+	for _, eng := range []string{"database", "aws", "rabbitmq"} {
+		engine, err := newEngine(eng)
+		assert.Nil(t, err)
+		assert.Equal(t, eng, engine.(dynamicEngine).name)
+		assert.True(t, engine.leased())
+	}
+}
+
 func TestNotImplementedEngine(t *testing.T) {
 	eng := "kv3"
 	_, err := newEngine(eng)
@@ -63,3 +73,30 @@ func TestGetDataKv2WithKv1Engine(t *testing.T) {
 	assert.NotNil(t, d)
 	assert.Equal(t, data, d)
 }
+
+func TestGetVersionKv2(t *testing.T) {
+	data := make(map[string]interface{})
+	data["metadata"] = map[string]interface{}{"version": json.Number("3")}
+	s := &api.Secret{Data: data}
+	engine, _ := newEngine("kv2")
+	assert.Equal(t, "3", engine.getVersion(s))
+	assert.Equal(t, "", engine.getVersion(&api.Secret{}))
+}
+
+func TestReadParams(t *testing.T) {
+	engine, _ := newEngine("kv2")
+	params, err := engine.readParams("3")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"version": {"3"}}, params)
+	params, err = engine.readParams("")
+	assert.Nil(t, err)
+	assert.Nil(t, params)
+
+	engine, _ = newEngine("kv1")
+	_, err = engine.readParams("3")
+	assert.True(t, errors.IsSecretVersionNotSupported(err))
+
+	engine, _ = newEngine("database")
+	_, err = engine.readParams("3")
+	assert.True(t, errors.IsSecretVersionNotSupported(err))
+}
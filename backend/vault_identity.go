@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// namespaceIdentityPlaceholder is replaced by the Kubernetes namespace in the Vault role name
+const namespaceIdentityPlaceholder = "{namespace}"
+
+// namespaceIdentities logs in to Vault as a service account of each Kubernetes namespace, requesting
+// its tokens with the TokenRequest API, and keeps the Vault token of each namespace
+type namespaceIdentities struct {
+	serviceAccount string
+	role           string
+	audiences      []string
+	expiration     time.Duration
+	// mutex guards tokens and their fields, but not the logins, so namespaces don't wait for each other
+	mutex  sync.Mutex
+	tokens map[string]*identityToken
+}
+
+type identityToken struct {
+	// login serializes the logins of the namespace
+	login   sync.Mutex
+	logins  int
+	token   string
+	renewAt time.Time
+}
+
+func newNamespaceIdentities(cfg Config) (*namespaceIdentities, error) {
+	if cfg.VaultIdentityServiceAccount == "" {
+		return nil, nil
+	}
+	if cfg.KubernetesClientset == nil {
+		return nil, fmt.Errorf("vault namespace identities require a Kubernetes client")
+	}
+	role := cfg.VaultIdentityRole
+	if role == "" {
+		role = cfg.VaultKubernetesRole
+	}
+	var audiences []string
+	if cfg.VaultIdentityAudience != "" {
+		audiences = []string{cfg.VaultIdentityAudience}
+	}
+	return &namespaceIdentities{
+		serviceAccount: cfg.VaultIdentityServiceAccount,
+		role:           role,
+		audiences:      audiences,
+		expiration:     cfg.VaultIdentityTokenExpiration,
+		tokens:         make(map[string]*identityToken),
+	}, nil
+}
+
+// token returns the Vault token of namespace, calling login to get a new one once two thirds
+// of the TTL of the current one have elapsed. The tokens of other namespaces due for renewal
+// are forgotten, so namespaces no longer read from don't pile up.
+func (i *namespaceIdentities) token(namespace string, login func(namespace string) (string, time.Duration, error)) (string, error) {
+	i.mutex.Lock()
+	now := time.Now()
+	t, ok := i.tokens[namespace]
+	if ok && now.Before(t.renewAt) {
+		i.mutex.Unlock()
+		return t.token, nil
+	}
+	for other, otherToken := range i.tokens {
+		if other != namespace && otherToken.logins == 0 && !now.Before(otherToken.renewAt) {
+			delete(i.tokens, other)
+		}
+	}
+	if !ok {
+		t = &identityToken{}
+		i.tokens[namespace] = t
+	}
+	t.logins++
+	i.mutex.Unlock()
+
+	t.login.Lock()
+	defer t.login.Unlock()
+	token, renewAt, err := i.renewToken(namespace, t, login)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	t.logins--
+	if err != nil {
+		if t.logins == 0 && t.token == "" {
+			delete(i.tokens, namespace)
+		}
+		return "", err
+	}
+	t.token, t.renewAt = token, renewAt
+	return token, nil
+}
+
+// renewToken calls login to get a new token for namespace, unless other call renewed it while
+// waiting for the namespace login lock, and returns it with the time to renew it
+func (i *namespaceIdentities) renewToken(namespace string, t *identityToken, login func(namespace string) (string, time.Duration, error)) (string, time.Time, error) {
+	i.mutex.Lock()
+	now := time.Now()
+	token, renewAt := t.token, t.renewAt
+	i.mutex.Unlock()
+	if now.Before(renewAt) {
+		return token, renewAt, nil
+	}
+
+	token, ttl, err := login(namespace)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if ttl <= 0 {
+		ttl = i.expiration
+	}
+	return token, now.Add(ttl * 2 / 3), nil
+}
+
+// identityLogin logs in to Vault with the kubernetes auth method, using a token of the
+// service account of namespace
+func (c *client) identityLogin(namespace string) (string, time.Duration, error) {
+	expiration := int64(c.identities.expiration.Seconds())
+	request := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         c.identities.audiences,
+			ExpirationSeconds: &expiration,
+		},
+	}
+	serviceAccounts := c.kubernetesClientset.CoreV1().ServiceAccounts(namespace)
+	request, err := serviceAccounts.CreateToken(context.Background(), c.identities.serviceAccount, request, metav1.CreateOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+
+	vclient, err := c.cloneVaultClient("")
+	if err != nil {
+		return "", 0, err
+	}
+	login := map[string]interface{}{
+		"jwt":  request.Status.Token,
+		"role": strings.ReplaceAll(c.identities.role, namespaceIdentityPlaceholder, namespace),
+	}
+	resp, err := vclient.Logical().Write(fmt.Sprintf("auth/%s/login", c.kubernetesPath), login)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp == nil || resp.Auth == nil {
+		return "", 0, fmt.Errorf("no token returned by vault login for namespace %s", namespace)
+	}
+	return resp.Auth.ClientToken, time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// ForKubernetesNamespace returns a client reading secrets with the Vault token of the service account
+// of namespace, so Vault policies decide what each namespace can read. The client itself is returned
+// if it's not configured to use namespace identities.
+func (c *client) ForKubernetesNamespace(namespace string) (Client, error) {
+	if c.identities == nil {
+		return c, nil
+	}
+	token, err := c.identities.token(namespace, c.identityLogin)
+	if err != nil {
+		c.metrics.updateVaultLoginErrorsTotalMetric()
+		c.logger.Error(err, "unable to login to vault as the namespace identity", "namespace", namespace, "service_account", c.identities.serviceAccount)
+		return nil, err
+	}
+	vclient, err := c.cloneVaultClient(token)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := *c
+	identity.vclient = vclient
+	identity.logical = vclient.Logical()
+	identity.identities = nil
+	return &identity, nil
+}
+
+// cloneVaultClient returns a copy of the Vault client, with its headers, using token
+func (c *client) cloneVaultClient(token string) (*api.Client, error) {
+	vclient, err := c.vclient.Clone()
+	if err != nil {
+		return nil, err
+	}
+	vclient.SetHeaders(c.vclient.Headers())
+	vclient.SetToken(token)
+	return vclient, nil
+}
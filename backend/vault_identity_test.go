@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const vaultIdentityKubernetesPath = "kubernetes-identity"
+
+// v1AuthKubernetesIdentityLogin issues a token named after the service account token and role used to login
+func v1AuthKubernetesIdentityLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		JWT  string `json:"jwt"`
+		Role string `json:"role"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	if request.Role == "forbidden" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"auth": map[string]interface{}{
+			"client_token":   fmt.Sprintf("%s@%s", request.JWT, request.Role),
+			"lease_duration": 3600,
+			"renewable":      true,
+		},
+	})
+}
+
+// newFakeTokenRequestClientset returns a clientset issuing service account tokens named after
+// their namespace and service account
+func newFakeTokenRequestClientset() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateActionImpl)
+		if create.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		request := create.GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+		request.Status.Token = fmt.Sprintf("%s/%s", create.GetNamespace(), create.Name)
+		request.Status.ExpirationTimestamp.Time = time.Now().Add(time.Duration(*request.Spec.ExpirationSeconds) * time.Second)
+		return true, request, nil
+	})
+	return clientset
+}
+
+func TestVaultNamespaceIdentity(t *testing.T) {
+	clientset := newFakeTokenRequestClientset()
+	cfg := testingCfg
+	cfg.VaultEngine = "kv2"
+	cfg.VaultKubernetesPath = vaultIdentityKubernetesPath
+	cfg.KubernetesClientset = clientset
+	cfg.VaultIdentityServiceAccount = "secrets-reader"
+	cfg.VaultIdentityRole = "tenant-{namespace}"
+	cfg.VaultIdentityAudience = "vault"
+	cfg.VaultIdentityTokenExpiration = 10 * time.Minute
+	vc, err := vaultClient(logger, cfg)
+	assert.Nil(t, err)
+
+	teamA, err := vc.ForKubernetesNamespace("team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a/secrets-reader@tenant-team-a", teamA.(*client).vclient.Token())
+	teamB, err := vc.ForKubernetesNamespace("team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, "team-b/secrets-reader@tenant-team-b", teamB.(*client).vclient.Token())
+	// The controller token is left untouched
+	assert.Equal(t, fakeToken, vc.vclient.Token())
+
+	// Vault tokens are cached per namespace
+	_, err = vc.ForKubernetesNamespace("team-a")
+	assert.Nil(t, err)
+	assert.Len(t, clientset.Actions(), 2)
+	request := clientset.Actions()[0].(k8stesting.CreateActionImpl).GetObject().(*authenticationv1.TokenRequest)
+	assert.Equal(t, []string{"vault"}, request.Spec.Audiences)
+	assert.Equal(t, int64(600), *request.Spec.ExpirationSeconds)
+
+	// Namespace clients read secrets with their own token
+	value, err := teamA.ReadSecret("secret/data/test", "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", value)
+
+	vc.identities.role = "forbidden"
+	_, err = vc.ForKubernetesNamespace("team-c")
+	assert.NotNil(t, err)
+}
+
+func TestVaultNamespaceIdentityDisabled(t *testing.T) {
+	cfg := testingCfg
+	cfg.VaultEngine = "kv2"
+	vc, err := vaultClient(logger, cfg)
+	assert.Nil(t, err)
+	namespaced, err := vc.ForKubernetesNamespace("team-a")
+	assert.Nil(t, err)
+	assert.Equal(t, vc, namespaced)
+
+	cfg.VaultIdentityServiceAccount = "secrets-reader"
+	_, err = vaultClient(logger, cfg)
+	assert.EqualError(t, err, "vault namespace identities require a Kubernetes client")
+}
+
+func TestNamespaceIdentitiesTokenRenewal(t *testing.T) {
+	identities := namespaceIdentities{tokens: make(map[string]*identityToken), expiration: time.Minute}
+	logins := 0
+	login := func(ttl time.Duration) func(string) (string, time.Duration, error) {
+		return func(namespace string) (string, time.Duration, error) {
+			logins++
+			return fmt.Sprintf("%s-%d", namespace, logins), ttl, nil
+		}
+	}
+
+	token, err := identities.token("team-a", login(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "team-a-1", token)
+	token, _ = identities.token("team-a", login(time.Hour))
+	assert.Equal(t, "team-a-1", token)
+
+	// A token is replaced once two thirds of its TTL have elapsed
+	identities.tokens["team-a"] = &identityToken{token: "team-a-1", renewAt: time.Now().Add(-time.Second)}
+	token, _ = identities.token("team-a", login(time.Hour))
+	assert.Equal(t, "team-a-2", token)
+
+	_, err = identities.token("team-b", func(string) (string, time.Duration, error) {
+		return "", 0, fmt.Errorf("login failed")
+	})
+	assert.EqualError(t, err, "login failed")
+	assert.NotContains(t, identities.tokens, "team-b")
+
+	// Tokens due for renewal are forgotten when other namespaces log in
+	identities.tokens["team-a"].renewAt = time.Now().Add(-time.Second)
+	token, _ = identities.token("team-c", login(time.Hour))
+	assert.Equal(t, "team-c-3", token)
+	assert.NotContains(t, identities.tokens, "team-a")
+}
+
+func TestNamespaceIdentitiesConcurrentLogins(t *testing.T) {
+	identities := namespaceIdentities{tokens: make(map[string]*identityToken), expiration: time.Minute}
+	slowLogin := make(chan struct{})
+	var logins int32
+	login := func(namespace string) (string, time.Duration, error) {
+		atomic.AddInt32(&logins, 1)
+		if namespace == "slow" {
+			<-slowLogin
+		}
+		return namespace, time.Hour, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := identities.token("slow", login)
+			assert.Nil(t, err)
+			assert.Equal(t, "slow", token)
+		}()
+	}
+
+	// A slow login doesn't block the logins of other namespaces
+	token, err := identities.token("fast", login)
+	assert.Nil(t, err)
+	assert.Equal(t, "fast", token)
+
+	close(slowLogin)
+	wg.Wait()
+	// The namespace logs in once, the waiting calls reuse its token
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+}
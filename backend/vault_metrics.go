@@ -10,6 +10,8 @@ const (
 	vaultLookupSelfOperationName  = "lookup-self"
 	vaultRenewSelfOperationName   = "renew-self"
 	vaultIsRenewableOperationName = "is-renewable"
+	vaultRenewLeaseOperationName  = "renew-lease"
+	vaultRevokeLeaseOperationName = "revoke-lease"
 )
 
 var (
@@ -42,6 +44,12 @@ var (
 		Name:      "read_secret_errors_total",
 		Help:      "Vault read operations counter",
 	}, append(vaultLabelNames, secretLabelNames...))
+	leaseErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "vault",
+		Name:      "lease_errors_total",
+		Help:      "Vault dynamic secrets lease renewal and revocation errors counter",
+	}, append(vaultLabelNames, vaultErrorLabelNames...))
 	loginErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "secrets_manager",
 		Subsystem: "vault",
@@ -60,6 +68,7 @@ func init() {
 	r.MustRegister(maxTokenTTL)
 	r.MustRegister(tokenRenewalErrorsTotal)
 	r.MustRegister(secretReadErrorsTotal)
+	r.MustRegister(leaseErrorsTotal)
 	r.MustRegister(loginErrorsTotal)
 }
 
@@ -115,6 +124,17 @@ func (vm *vaultMetrics) updateVaultTokenRenewalErrorsTotalMetric(vaultOperation
 		errorType).Inc()
 }
 
+func (vm *vaultMetrics) updateVaultLeaseErrorsTotalMetric(vaultOperation string, errorType string) {
+	leaseErrorsTotal.WithLabelValues(
+		vm.vaultLabels["vault_addr"],
+		vm.vaultLabels["vault_engine"],
+		vm.vaultLabels["vault_version"],
+		vm.vaultLabels["vault_cluster_id"],
+		vm.vaultLabels["vault_cluster_name"],
+		vaultOperation,
+		errorType).Inc()
+}
+
 func (vm *vaultMetrics) updateVaultLoginErrorsTotalMetric() {
 	loginErrorsTotal.WithLabelValues(
 		vm.vaultLabels["vault_addr"],
@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const defaultPKIMount = "pki"
+
+// IssueCertificate issues a new certificate and private key from the PKI engine role
+func (c *client) IssueCertificate(request CertificateRequest) (Certificate, error) {
+	mount := strings.Trim(request.Mount, "/")
+	if mount == "" {
+		mount = defaultPKIMount
+	}
+	path := fmt.Sprintf("%s/issue/%s", mount, request.Role)
+
+	data := map[string]interface{}{
+		"common_name": request.CommonName,
+	}
+	if len(request.AltNames) > 0 {
+		data["alt_names"] = strings.Join(request.AltNames, ",")
+	}
+	if len(request.IPSANs) > 0 {
+		data["ip_sans"] = strings.Join(request.IPSANs, ",")
+	}
+	if request.TTL > 0 {
+		data["ttl"] = request.TTL.String()
+	}
+
+	secret, err := c.logical.Write(path, data)
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return Certificate{}, err
+	}
+	if secret == nil || secret.Data == nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.BackendSecretNotFoundErrorType)
+		return Certificate{}, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path}
+	}
+
+	cert := Certificate{}
+	cert.Certificate, _ = secret.Data["certificate"].(string)
+	cert.PrivateKey, _ = secret.Data["private_key"].(string)
+	cert.CA, _ = secret.Data["issuing_ca"].(string)
+	// The chain up to the root CA is returned when the issuer is an intermediate CA. The intermediate
+	// CAs are appended to the certificate too, as clients usually only trust the root one
+	if chain, ok := secret.Data["ca_chain"].([]interface{}); ok && len(chain) > 0 {
+		certs := make([]string, 0, len(chain))
+		for _, ca := range chain {
+			if encoded, ok := ca.(string); ok {
+				certs = append(certs, encoded)
+				if !selfSigned(encoded) {
+					cert.Certificate = strings.TrimRight(cert.Certificate, "\n") + "\n" + encoded
+				}
+			}
+		}
+		cert.CA = strings.Join(certs, "\n")
+	}
+
+	block, _ := pem.Decode([]byte(cert.Certificate))
+	if block == nil || cert.PrivateKey == "" {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return Certificate{}, fmt.Errorf("no certificate issued at %s", path)
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return Certificate{}, fmt.Errorf("invalid certificate issued at %s: %v", path, err)
+	}
+	cert.SerialNumber = fmt.Sprintf("%x", parsed.SerialNumber)
+	cert.NotBefore = parsed.NotBefore
+	cert.NotAfter = parsed.NotAfter
+	return cert, nil
+}
+
+// selfSigned returns true if the PEM certificate is signed by itself, like root CAs, or if it can't be parsed
+func selfSigned(encoded string) bool {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return true
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return bytes.Equal(parsed.RawIssuer, parsed.RawSubject) &&
+		parsed.CheckSignature(parsed.SignatureAlgorithm, parsed.RawTBSCertificate, parsed.Signature) == nil
+}
@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	vaultFakePKIRole             = "internal"
+	vaultFakePKIIntermediateRole = "intermediate"
+)
+
+// fakeCA returns a CA certificate signed by parent, or self signed if parent is nil, and its key
+func fakeCA(commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	ca, _ := x509.ParseCertificate(der)
+	return ca, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// v1PKIIssue issues a certificate for the requested common name, valid for the requested TTL. It's self signed,
+// or signed by an intermediate CA with the intermediate role
+func v1PKIIssue(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		CommonName string `json:"common_name"`
+		AltNames   string `json:"alt_names"`
+		TTL        string `json:"ttl"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	role := mux.Vars(r)["role"]
+	if role != vaultFakePKIRole && role != vaultFakePKIIntermediateRole {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["unknown role: ` + mux.Vars(r)["role"] + `"]}`))
+		return
+	}
+
+	ttl := 72 * time.Hour
+	if request.TTL != "" {
+		ttl, _ = time.ParseDuration(request.TTL)
+	}
+	now := time.Now().Truncate(time.Second)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1f2e3d),
+		Subject:      pkix.Name{CommonName: request.CommonName},
+		DNSNames:     append([]string{request.CommonName}, strings.Split(request.AltNames, ",")...),
+		NotBefore:    now,
+		NotAfter:     now.Add(ttl),
+	}
+	parent, parentKey := template, key
+	var chain []string
+	if role == vaultFakePKIIntermediateRole {
+		root, rootKey, rootPEM := fakeCA("root", nil, nil)
+		intermediate, intermediateKey, intermediatePEM := fakeCA("intermediate", root, rootKey)
+		parent, parentKey = intermediate, intermediateKey
+		chain = []string{intermediatePEM, rootPEM}
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if chain == nil {
+		chain = []string{certificate}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lease_id":       "",
+		"renewable":      false,
+		"lease_duration": 0,
+		"data": map[string]interface{}{
+			"certificate":      certificate,
+			"issuing_ca":       chain[0],
+			"ca_chain":         chain,
+			"private_key":      string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+			"private_key_type": "ec",
+			"serial_number":    "1f:2e:3d",
+		},
+	})
+}
+
+func TestIssueCertificate(t *testing.T) {
+	client, _ := vaultClient(logger, testingCfg)
+	cert, err := client.IssueCertificate(CertificateRequest{
+		Role:       vaultFakePKIRole,
+		CommonName: "payments.internal",
+		AltNames:   []string{"payments.default.svc"},
+		TTL:        24 * time.Hour,
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, cert.Certificate, "BEGIN CERTIFICATE")
+	assert.Contains(t, cert.PrivateKey, "BEGIN EC PRIVATE KEY")
+	assert.Equal(t, cert.Certificate, cert.CA)
+	assert.Equal(t, "1f2e3d", cert.SerialNumber)
+	assert.Equal(t, 24*time.Hour, cert.NotAfter.Sub(cert.NotBefore))
+
+	_, err = client.IssueCertificate(CertificateRequest{Mount: "/pki/", Role: "unknown", CommonName: "payments.internal"})
+	assert.NotNil(t, err)
+}
+
+func TestIssueCertificateFromIntermediateCA(t *testing.T) {
+	client, _ := vaultClient(logger, testingCfg)
+	cert, err := client.IssueCertificate(CertificateRequest{Role: vaultFakePKIIntermediateRole, CommonName: "payments.internal"})
+	assert.Nil(t, err)
+
+	var certificates []*x509.Certificate
+	rest := []byte(cert.Certificate)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		assert.Nil(t, err)
+		certificates = append(certificates, parsed)
+	}
+	assert.Len(t, certificates, 2)
+	assert.Equal(t, "payments.internal", certificates[0].Subject.CommonName)
+	assert.Equal(t, "intermediate", certificates[1].Subject.CommonName)
+	assert.Equal(t, 2, strings.Count(cert.CA, "BEGIN CERTIFICATE"))
+	assert.Equal(t, "1f2e3d", cert.SerialNumber)
+}
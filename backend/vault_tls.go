@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// vaultTLS holds the TLS configuration used to connect to Vault. The CA and client certificates
+// are loaded again whenever their files change, so rotated certificates are used without a restart.
+type vaultTLS struct {
+	caCert      string
+	caPath      string
+	clientCert  string
+	clientKey   string
+	mutex       sync.RWMutex
+	rootCAs     *x509.CertPool
+	certificate *tls.Certificate
+	transport   *http.Transport
+	watcher     *fsnotify.Watcher
+	logger      logr.Logger
+}
+
+func newVaultTLS(logger logr.Logger, cfg Config) (*vaultTLS, error) {
+	minVersion, ok := tlsVersions[cfg.VaultTLSMinVersion]
+	if cfg.VaultTLSMinVersion == "" {
+		minVersion, ok = tls.VersionTLS12, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported Vault min TLS version %s", cfg.VaultTLSMinVersion)
+	}
+	if (cfg.VaultClientCert == "") != (cfg.VaultClientKey == "") {
+		return nil, fmt.Errorf("both Vault client certificate and key are required for TLS authentication")
+	}
+
+	t := &vaultTLS{
+		caCert:     cfg.VaultCACert,
+		caPath:     cfg.VaultCAPath,
+		clientCert: cfg.VaultClientCert,
+		clientKey:  cfg.VaultClientKey,
+		logger:     logger,
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:           cfg.VaultTLSServerName,
+		MinVersion:           minVersion,
+		GetClientCertificate: t.getClientCertificate,
+	}
+	if t.caCert != "" || t.caPath != "" {
+		// RootCAs can't be replaced once connections are made, so the server certificate
+		// is verified against the CA certificates loaded last instead
+		verifyName := cfg.VaultTLSServerName
+		if verifyName == "" {
+			u, err := url.Parse(cfg.VaultURL)
+			if err != nil {
+				return nil, err
+			}
+			verifyName = u.Hostname()
+		}
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return t.verifyConnection(cs, verifyName)
+		}
+	}
+	t.transport = http.DefaultTransport.(*http.Transport).Clone()
+	t.transport.TLSClientConfig = tlsConfig
+
+	var dirs []string
+	for _, file := range []string{t.caCert, t.clientCert, t.clientKey} {
+		if file != "" {
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+	if t.caPath != "" {
+		dirs = append(dirs, t.caPath)
+	}
+	if len(dirs) == 0 {
+		return t, nil
+	}
+
+	// Directories are watched instead of files, as mounted volumes are updated by replacing symlinks
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	t.watcher = watcher
+	return t, nil
+}
+
+// load reads the CA and client certificates from their files
+func (t *vaultTLS) load() error {
+	var rootCAs *x509.CertPool
+	if t.caCert != "" || t.caPath != "" {
+		rootCAs = x509.NewCertPool()
+		files := []string{}
+		if t.caCert != "" {
+			files = append(files, t.caCert)
+		}
+		if t.caPath != "" {
+			entries, err := ioutil.ReadDir(t.caPath)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(t.caPath, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if !rootCAs.AppendCertsFromPEM(pem) && file == t.caCert {
+				return fmt.Errorf("no certificates found in Vault CA file %s", file)
+			}
+		}
+	}
+
+	var certificate *tls.Certificate
+	if t.clientCert != "" {
+		keyPair, err := tls.LoadX509KeyPair(t.clientCert, t.clientKey)
+		if err != nil {
+			return err
+		}
+		certificate = &keyPair
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rootCAs = rootCAs
+	t.certificate = certificate
+	return nil
+}
+
+// reload loads the certificates again, keeping the previous ones if they can't be loaded.
+// Idle connections are closed, so the next requests handshake with the new certificates.
+func (t *vaultTLS) reload() {
+	if err := t.load(); err != nil {
+		t.logger.Error(err, "unable to reload Vault TLS certificates, keeping the previous ones")
+		return
+	}
+	t.transport.CloseIdleConnections()
+	t.logger.Info("Vault TLS certificates reloaded")
+}
+
+func (t *vaultTLS) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.certificate == nil {
+		return &tls.Certificate{}, nil
+	}
+	return t.certificate, nil
+}
+
+func (t *vaultTLS) verifyConnection(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("no certificate presented by Vault server")
+	}
+	t.mutex.RLock()
+	rootCAs := t.rootCAs
+	t.mutex.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         rootCAs,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// close stops watching the certificates, for clients that fail to start
+func (t *vaultTLS) close() {
+	if t.watcher != nil {
+		t.watcher.Close()
+	}
+}
+
+// startWatcher reloads the certificates whenever something changes in their directories
+func (t *vaultTLS) startWatcher(ctx context.Context) {
+	if t.watcher == nil {
+		return
+	}
+	go func() {
+		defer t.watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-t.watcher.Events:
+				if !ok {
+					return
+				}
+				t.logger.V(1).Info("TLS certificate change detected", "file", event.Name, "operation", event.Op.String())
+				t.reload()
+			case err, ok := <-t.watcher.Errors:
+				if !ok {
+					return
+				}
+				t.logger.Error(err, "TLS certificates watcher error")
+			}
+		}
+	}()
+}
@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCertificate returns a certificate signed by parent, or a self-signed CA if parent is nil
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate) testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return testCertificate{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c testCertificate) writeFiles(t *testing.T, dir string, name string) (string, string) {
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	assert.Nil(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	assert.Nil(t, ioutil.WriteFile(certFile, c.pem, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+// newTestTLSServer returns a server requiring client certificates issued by ca, which answers
+// with the common name of the client certificate
+func newTestTLSServer(t *testing.T, ca testCertificate, serverName string) *httptest.Server {
+	serverCert := newTestCertificate(t, serverName, &ca)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	return server
+}
+
+func vaultTLSGet(t *vaultTLS, url string) (string, error) {
+	httpClient := &http.Client{Transport: t.transport}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestVaultTLSClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "ca", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newTestCertificate(t, "client-1", &ca).writeFiles(t, dir, "client")
+
+	server := newTestTLSServer(t, ca, "vault.example.com")
+	defer server.Close()
+
+	cfg := Config{
+		VaultURL:           server.URL,
+		VaultCACert:        caFile,
+		VaultClientCert:    certFile,
+		VaultClientKey:     keyFile,
+		VaultTLSServerName: "vault.example.com",
+	}
+	vaultTLS, err := newVaultTLS(logger, cfg)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vaultTLS.startWatcher(ctx)
+
+	commonName, err := vaultTLSGet(vaultTLS, server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "client-1", commonName)
+
+	// Rotated client certificates are used once their files change
+	newTestCertificate(t, "client-2", &ca).writeFiles(t, dir, "client")
+	assert.Eventually(t, func() bool {
+		commonName, err := vaultTLSGet(vaultTLS, server.URL)
+		return err == nil && commonName == "client-2"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestVaultTLSCAPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	caPath := filepath.Join(dir, "ca")
+	assert.Nil(t, os.Mkdir(caPath, 0700))
+
+	ca := newTestCertificate(t, "ca", nil)
+	otherCA := newTestCertificate(t, "other-ca", nil)
+	otherCA.writeFiles(t, caPath, "other-ca")
+	certFile, keyFile := newTestCertificate(t, "client", &ca).writeFiles(t, dir, "client")
+
+	server := newTestTLSServer(t, ca, "127.0.0.1")
+	defer server.Close()
+
+	cfg := Config{
+		VaultURL:        server.URL,
+		VaultCAPath:     caPath,
+		VaultClientCert: certFile,
+		VaultClientKey:  keyFile,
+	}
+	vaultTLS, err := newVaultTLS(logger, cfg)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vaultTLS.startWatcher(ctx)
+
+	// The server certificate is not issued by any of the trusted CAs
+	_, err = vaultTLSGet(vaultTLS, server.URL)
+	assert.NotNil(t, err)
+
+	// CAs added to the directory are trusted once loaded
+	ca.writeFiles(t, caPath, "ca")
+	assert.Eventually(t, func() bool {
+		commonName, err := vaultTLSGet(vaultTLS, server.URL)
+		return err == nil && commonName == "client"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestVaultTLSServerNameMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "ca", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := newTestCertificate(t, "client", &ca).writeFiles(t, dir, "client")
+
+	server := newTestTLSServer(t, ca, "vault.example.com")
+	defer server.Close()
+
+	cfg := Config{
+		VaultURL:           server.URL,
+		VaultCACert:        caFile,
+		VaultClientCert:    certFile,
+		VaultClientKey:     keyFile,
+		VaultTLSServerName: "other.example.com",
+	}
+	vaultTLS, err := newVaultTLS(logger, cfg)
+	assert.Nil(t, err)
+	_, err = vaultTLSGet(vaultTLS, server.URL)
+	assert.NotNil(t, err)
+}
+
+func TestVaultTLSInvalidConfig(t *testing.T) {
+	_, err := newVaultTLS(logger, Config{VaultTLSMinVersion: "1.4"})
+	assert.EqualError(t, err, "unsupported Vault min TLS version 1.4")
+
+	_, err = newVaultTLS(logger, Config{VaultClientCert: "/tmp/client.crt"})
+	assert.EqualError(t, err, "both Vault client certificate and key are required for TLS authentication")
+
+	_, err = newVaultTLS(logger, Config{VaultCACert: "/does/not/exist.crt"})
+	assert.NotNil(t, err)
+
+	vaultTLS, err := newVaultTLS(logger, Config{VaultTLSMinVersion: "1.3"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), vaultTLS.transport.TLSClientConfig.MinVersion)
+	assert.Nil(t, vaultTLS.watcher)
+}
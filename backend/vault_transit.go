@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/tuenti/secrets-manager/errors"
+)
+
+const defaultTransitMount = "transit"
+
+// Decrypt decrypts a ciphertext like vault:v1:... with a key of the transit engine
+func (c *client) Decrypt(mount string, key string, ciphertext string) ([]byte, error) {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		mount = defaultTransitMount
+	}
+	path := fmt.Sprintf("%s/decrypt/%s", mount, key)
+
+	secret, err := c.logical.Write(path, map[string]interface{}{
+		"ciphertext": strings.TrimSpace(ciphertext),
+	})
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.BackendSecretNotFoundErrorType)
+		return nil, &errors.BackendSecretNotFoundError{ErrType: errors.BackendSecretNotFoundErrorType, Path: path}
+	}
+
+	// Transit always returns the plaintext base64 encoded
+	encoded, _ := secret.Data["plaintext"].(string)
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		c.metrics.updateVaultSecretReadErrorsTotalMetric(path, "", errors.UnknownErrorType)
+		return nil, fmt.Errorf("invalid plaintext decrypted at %s: %v", path, err)
+	}
+	return plaintext, nil
+}
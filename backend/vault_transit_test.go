@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	vaultFakeTransitKey = "gitops"
+	// The fake transit engine "encrypts" base64 encoding the plaintext
+	vaultFakeCiphertextPrefix = "vault:v1:"
+)
+
+func v1TransitDecrypt(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	if mux.Vars(r)["key"] != vaultFakeTransitKey {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["encryption key not found"]}`))
+		return
+	}
+	if !strings.HasPrefix(request.Ciphertext, vaultFakeCiphertextPrefix) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["invalid ciphertext: no prefix"]}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"plaintext": strings.TrimPrefix(request.Ciphertext, vaultFakeCiphertextPrefix),
+		},
+	})
+}
+
+func TestDecrypt(t *testing.T) {
+	client, _ := vaultClient(logger, testingCfg)
+	ciphertext := vaultFakeCiphertextPrefix + base64.StdEncoding.EncodeToString([]byte("p4ssw0rd"))
+
+	plaintext, err := client.Decrypt("", vaultFakeTransitKey, ciphertext+"\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("p4ssw0rd"), plaintext)
+
+	_, err = client.Decrypt("/transit/", "unknown", ciphertext)
+	assert.NotNil(t, err)
+
+	_, err = client.Decrypt("", vaultFakeTransitKey, "not-encrypted")
+	assert.NotNil(t, err)
+}
+
+func TestTransitDecoder(t *testing.T) {
+	client, _ := vaultClient(logger, testingCfg)
+	decoder, _ := NewDecoder("base64")
+	transitDecoder := TransitDecoder{Client: client, Key: vaultFakeTransitKey, Decoder: decoder}
+	// The plaintext itself is base64 encoded
+	ciphertext := vaultFakeCiphertextPrefix + base64.StdEncoding.EncodeToString([]byte("cDRzc3cwcmQ="))
+
+	data, err := transitDecoder.DecodeString(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("p4ssw0rd"), data)
+}
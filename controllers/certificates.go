@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	smv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	caCertKey = "ca.crt"
+	// Certificates are renewed once two thirds of their lifetime have elapsed by default
+	defaultRenewPercentage = 66
+)
+
+// Keys of the Secret the certificate is written to, which can't be read from the keysMap
+var certificateKeys = []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, caCertKey}
+
+// certificateState is the certificate issued for the PKI of a SecretDefinition
+type certificateState struct {
+	Backend string `json:"backend,omitempty"`
+	Serial  string `json:"serial"`
+	// Request is a digest of the PKI spec the certificate was issued for
+	Request   string      `json:"request"`
+	NotBefore metav1.Time `json:"notBefore"`
+	NotAfter  metav1.Time `json:"notAfter"`
+}
+
+// renewAt returns when the certificate must be renewed, once the percentage of its lifetime has elapsed
+func (c certificateState) renewAt(percentage int32) time.Time {
+	lifetime := c.NotAfter.Sub(c.NotBefore.Time)
+	return c.NotBefore.Add(lifetime * time.Duration(percentage) / 100)
+}
+
+// annotatedCertificate returns the certificate annotated on a Secret, if any
+func annotatedCertificate(annotations map[string]string) *certificateState {
+	encoded, ok := annotations[certificateAnnotation]
+	if !ok {
+		return nil
+	}
+	certificate := &certificateState{}
+	// An invalid annotation is overwritten with the right certificate
+	if json.Unmarshal([]byte(encoded), certificate) != nil {
+		return nil
+	}
+	return certificate
+}
+
+func renewPercentage(pki *smv1alpha1.PKICertificate) int32 {
+	if pki.RenewPercentage <= 0 {
+		return defaultRenewPercentage
+	}
+	return pki.RenewPercentage
+}
+
+// certificateRequest returns the request issuing the certificate described by pki, together with its digest
+func certificateRequest(pki *smv1alpha1.PKICertificate) (backend.CertificateRequest, string) {
+	request := backend.CertificateRequest{
+		Mount:      pki.Mount,
+		Role:       pki.Role,
+		CommonName: pki.CommonName,
+		AltNames:   pki.AltNames,
+		IPSANs:     pki.IPSANs,
+	}
+	if pki.TTL != nil {
+		request.TTL = pki.TTL.Duration
+	}
+	encoded, _ := json.Marshal(request)
+	digest := sha256.Sum256(encoded)
+	return request, hex.EncodeToString(digest[:])
+}
+
+// getCertificateState returns the certificate keys of the Secret, together with the certificate they hold.
+// The current certificate is kept until it must be renewed, or the PKI spec changes.
+func (r *SecretDefinitionReconciler) getCertificateState(namespace string, spec smv1alpha1.SecretDefinitionSpec, currentState map[string][]byte, current *certificateState) (map[string][]byte, *certificateState, error) {
+	pki := spec.PKI
+	if pki == nil {
+		return nil, nil, nil
+	}
+	if err := validateBackendNames(spec); err != nil {
+		return nil, nil, err
+	}
+	for _, k := range certificateKeys {
+		if _, ok := spec.KeysMap[k]; ok {
+			return nil, nil, fmt.Errorf("key %s is written by the certificate and can't be read from keysMap", k)
+		}
+	}
+
+	backendName := backendName(namespace, spec, smv1alpha1.DataSource{Backend: pki.Backend})
+	log := r.Log.WithValues("backend", backendName, "role", pki.Role, "common_name", pki.CommonName)
+	request, digest := certificateRequest(pki)
+
+	if current != nil && current.Backend == backendName && current.Request == digest && time.Now().Before(current.renewAt(renewPercentage(pki))) {
+		data := make(map[string][]byte, len(certificateKeys))
+		for _, k := range certificateKeys {
+			data[k] = currentState[k]
+		}
+		if len(data[corev1.TLSCertKey]) > 0 && len(data[corev1.TLSPrivateKeyKey]) > 0 {
+			return data, current, nil
+		}
+	}
+
+	backendClient, err := r.backendClient(backend.Source{Backend: backendName, KubernetesNamespace: namespace})
+	if err != nil {
+		return nil, nil, err
+	}
+	certificateClient, ok := backendClient.(backend.CertificateClient)
+	if !ok {
+		return nil, nil, fmt.Errorf("backend %s can't issue certificates", servedByLabel(backend.Source{Backend: backendName}))
+	}
+	cert, err := certificateClient.IssueCertificate(request)
+	if err != nil {
+		log.Error(err, "unable to issue certificate")
+		return nil, nil, err
+	}
+	log.Info("certificate issued", "serial", cert.SerialNumber, "not_after", cert.NotAfter)
+
+	data := map[string][]byte{
+		corev1.TLSCertKey:       []byte(cert.Certificate),
+		corev1.TLSPrivateKeyKey: []byte(cert.PrivateKey),
+		caCertKey:               []byte(cert.CA),
+	}
+	return data, &certificateState{
+		Backend:   backendName,
+		Serial:    cert.SerialNumber,
+		Request:   digest,
+		NotBefore: metav1.NewTime(cert.NotBefore),
+		NotAfter:  metav1.NewTime(cert.NotAfter),
+	}, nil
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	smv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// leaseState is the lease of the dynamic secret some keys of a Secret are read from
+type leaseState struct {
+	Backend   string          `json:"backend,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Path      string          `json:"path"`
+	ID        string          `json:"id"`
+	Renewable bool            `json:"renewable,omitempty"`
+	Duration  metav1.Duration `json:"duration"`
+	Expires   metav1.Time     `json:"expires"`
+}
+
+func newLeaseState(source backend.Source, lease backend.Lease, now time.Time) leaseState {
+	return leaseState{
+		Backend:   source.Backend,
+		Namespace: source.Namespace,
+		Path:      source.Path,
+		ID:        lease.ID,
+		Renewable: lease.Renewable,
+		Duration:  metav1.Duration{Duration: lease.Duration},
+		Expires:   metav1.NewTime(now.Add(lease.Duration)),
+	}
+}
+
+func (l leaseState) lease() backend.Lease {
+	return backend.Lease{ID: l.ID, Duration: l.Duration.Duration, Renewable: l.Renewable}
+}
+
+// renewAt returns when the lease must be renewed, once two thirds of its duration have elapsed
+func (l leaseState) renewAt() time.Time {
+	return l.Expires.Add(-l.Duration.Duration / 3)
+}
+
+// annotatedLeases returns the leases annotated on a Secret
+func annotatedLeases(annotations map[string]string) []leaseState {
+	var leases []leaseState
+	if encoded, ok := annotations[leasesAnnotation]; ok {
+		// An invalid annotation is overwritten with the right leases
+		if json.Unmarshal([]byte(encoded), &leases) != nil {
+			return nil
+		}
+	}
+	return leases
+}
+
+// trustedLeases returns the leases annotated on a Secret that were issued for its SecretDefinition. As the
+// annotation can be edited by anyone updating the Secret, only the lease IDs recorded in the SecretDefinition
+// status, issued for the path of the lease, are renewed and revoked.
+func trustedLeases(annotated []leaseState, issued []string) []leaseState {
+	var leases []leaseState
+	for _, lease := range annotated {
+		if containsString(issued, lease.ID) && strings.HasPrefix(lease.ID, lease.Path+"/") {
+			leases = append(leases, lease)
+		}
+	}
+	return leases
+}
+
+// recordIssuedLeases adds the IDs of the leases issued to the SecretDefinition status, before the
+// credentials are written to the Secret
+func (r *SecretDefinitionReconciler) recordIssuedLeases(ctx context.Context, sDef *smv1alpha1.SecretDefinition, issued []leaseState) error {
+	if len(issued) == 0 {
+		return nil
+	}
+	for _, lease := range issued {
+		sDef.Status.IssuedLeases = append(sDef.Status.IssuedLeases, lease.ID)
+	}
+	return r.Status().Update(ctx, sDef)
+}
+
+// pruneIssuedLeases keeps in the SecretDefinition status only the IDs of the leases in use
+func (r *SecretDefinitionReconciler) pruneIssuedLeases(ctx context.Context, sDef *smv1alpha1.SecretDefinition, leases []leaseState) error {
+	ids := make([]string, 0, len(leases))
+	for _, lease := range leases {
+		ids = append(ids, lease.ID)
+	}
+	if len(ids) == len(sDef.Status.IssuedLeases) {
+		same := true
+		for _, id := range ids {
+			same = same && containsString(sDef.Status.IssuedLeases, id)
+		}
+		if same {
+			return nil
+		}
+	}
+	sDef.Status.IssuedLeases = ids
+	if len(ids) == 0 {
+		sDef.Status.IssuedLeases = nil
+	}
+	return r.Status().Update(ctx, sDef)
+}
+
+// leasedClient returns the client of the source if reading it issues a dynamic secret
+func (r *SecretDefinitionReconciler) leasedClient(source backend.Source) (backend.LeasedClient, bool) {
+	backendClient, err := r.backendClient(source)
+	if err != nil {
+		return nil, false
+	}
+	leasedClient, ok := backendClient.(backend.LeasedClient)
+	if !ok || !leasedClient.IsLeased(source.Path) {
+		return nil, false
+	}
+	return leasedClient, true
+}
+
+// getLeasedState returns the content of the keys read from dynamic secrets, together with their leases.
+// Keys read from the same backend path share the same credentials, which are kept while their
+// lease can be renewed, and are issued again before it expires.
+func (r *SecretDefinitionReconciler) getLeasedState(namespace string, spec smv1alpha1.SecretDefinitionSpec, currentState map[string][]byte, currentLeases []leaseState) (map[string][]byte, []leaseState, error) {
+	if err := validateBackendNames(spec); err != nil {
+		return nil, nil, err
+	}
+	keysBySource := make(map[backend.Source][]string)
+	for k, v := range spec.KeysMap {
+		source := dataSourceSources(namespace, spec, v)[0]
+		source.Key = ""
+		if inlineCiphertext(v) {
+			continue
+		}
+		if _, ok := r.leasedClient(source); !ok {
+			continue
+		}
+		if v.Version != "" || len(v.Fallbacks) > 0 || v.Transit != nil {
+			return nil, nil, fmt.Errorf("dynamic secret %s can't be read with versions, fallbacks nor transit", v.Path)
+		}
+		source.Version = ""
+		keysBySource[source] = append(keysBySource[source], k)
+	}
+
+	sources := make([]backend.Source, 0, len(keysBySource))
+	for source := range keysBySource {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Backend != sources[j].Backend {
+			return sources[i].Backend < sources[j].Backend
+		}
+		if sources[i].Namespace != sources[j].Namespace {
+			return sources[i].Namespace < sources[j].Namespace
+		}
+		return sources[i].Path < sources[j].Path
+	})
+
+	now := time.Now()
+	leasedState := make(map[string][]byte)
+	leases := make([]leaseState, 0, len(sources))
+	for _, source := range sources {
+		keys := keysBySource[source]
+		leasedClient, _ := r.leasedClient(source)
+		log := r.Log.WithValues("backend", source.Backend, "namespace", source.Namespace, "path", source.Path)
+
+		if lease, ok := r.keepLease(leasedClient, source, keys, currentState, currentLeases, now, log); ok {
+			for _, k := range keys {
+				leasedState[k] = currentState[k]
+				setKeyServedBy(namespace, spec.Name, k, servedByLabel(source))
+			}
+			leases = append(leases, lease)
+			continue
+		}
+
+		data, lease, err := leasedClient.ReadLeasedSecret(source.Path)
+		if err != nil {
+			log.Error(err, "unable to issue dynamic secret")
+			return nil, nil, err
+		}
+		log.Info("dynamic secret issued", "lease_duration", lease.Duration)
+		for _, k := range keys {
+			v := spec.KeysMap[k]
+			value, ok := data[v.Key]
+			if !ok {
+				return nil, nil, fmt.Errorf("key %s not found in dynamic secret %s", v.Key, v.Path)
+			}
+			decoder, err := backend.NewDecoder(v.Encoding)
+			if err != nil {
+				r.Log.Error(err, "refusing to use encoding", "encoding", v.Encoding)
+				return nil, nil, err
+			}
+			leasedState[k], err = decoder.DecodeString(value)
+			if err != nil {
+				r.Log.Error(err, "unable to decode data for secret", "encoding", v.Encoding, "path", v.Path, "key", v.Key)
+				return nil, nil, err
+			}
+			setKeyServedBy(namespace, spec.Name, k, servedByLabel(source))
+		}
+		leases = append(leases, newLeaseState(source, lease, now))
+	}
+	return leasedState, leases, nil
+}
+
+// keepLease returns the current lease of source if the Secret holds all the keys read from it and
+// the lease is still valid for long enough, renewing it if needed
+func (r *SecretDefinitionReconciler) keepLease(leasedClient backend.LeasedClient, source backend.Source, keys []string, currentState map[string][]byte, currentLeases []leaseState, now time.Time, log logr.Logger) (leaseState, bool) {
+	for _, k := range keys {
+		if _, ok := currentState[k]; !ok {
+			return leaseState{}, false
+		}
+	}
+	for _, lease := range currentLeases {
+		if lease.Backend != source.Backend || lease.Namespace != source.Namespace || lease.Path != source.Path {
+			continue
+		}
+		if now.Before(lease.renewAt()) {
+			return lease, true
+		}
+		if !lease.Renewable {
+			return leaseState{}, false
+		}
+		renewed, err := leasedClient.RenewLease(lease.lease())
+		if err != nil {
+			log.Error(err, "unable to renew lease, issuing new credentials", "lease_id", lease.ID)
+			return leaseState{}, false
+		}
+		// The lease can't be extended beyond its max TTL, so it's replaced once it's close to it
+		if renewed.Duration <= lease.Duration.Duration/3 {
+			log.Info("lease reached its max TTL, issuing new credentials", "lease_id", lease.ID)
+			return leaseState{}, false
+		}
+		lease.Expires = metav1.NewTime(now.Add(renewed.Duration))
+		log.Info("lease renewed", "lease_id", lease.ID, "lease_duration", renewed.Duration)
+		return lease, true
+	}
+	return leaseState{}, false
+}
+
+// revokeLeases revokes the leases of a Secret in namespace, which are left to expire if they can't be revoked
+func (r *SecretDefinitionReconciler) revokeLeases(namespace string, leases []leaseState, log logr.Logger) {
+	for _, lease := range leases {
+		leasedClient, ok := r.leasedClient(backend.Source{Backend: lease.Backend, Namespace: lease.Namespace, Path: lease.Path, KubernetesNamespace: namespace})
+		if !ok {
+			log.Info("unable to revoke lease, backend not available", "backend", lease.Backend, "lease_id", lease.ID)
+			continue
+		}
+		if err := leasedClient.RevokeLease(lease.lease()); err != nil {
+			log.Error(err, "unable to revoke lease", "backend", lease.Backend, "lease_id", lease.ID)
+			continue
+		}
+		log.Info("lease revoked", "backend", lease.Backend, "lease_id", lease.ID)
+	}
+}
+
+// droppedLeases returns the leases whose dynamic secret is not read anymore. Leases replaced by
+// new credentials are not revoked, as the old credentials can still be in use until they expire.
+func droppedLeases(current []leaseState, desired []leaseState) []leaseState {
+	var dropped []leaseState
+	for _, lease := range current {
+		found := false
+		for _, d := range desired {
+			if d.Backend == lease.Backend && d.Namespace == lease.Namespace && d.Path == lease.Path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dropped = append(dropped, lease)
+		}
+	}
+	return dropped
+}
+
+// issuedLeases returns the leases of the credentials issued in this reconciliation
+func issuedLeases(current []leaseState, desired []leaseState) []leaseState {
+	var issued []leaseState
+	for _, lease := range desired {
+		found := false
+		for _, c := range current {
+			if c.ID == lease.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			issued = append(issued, lease)
+		}
+	}
+	return issued
+}
+
+// leaseRenewals returns when each of the leases must be renewed
+func leaseRenewals(leases []leaseState) []time.Time {
+	renewals := make([]time.Time, 0, len(leases))
+	for _, lease := range leases {
+		renewals = append(renewals, lease.renewAt())
+	}
+	return renewals
+}
+
+// requeueAfter returns when the SecretDefinition must be reconciled again, which can be
+// before the reconciliation period if a lease or certificate must be renewed earlier
+func requeueAfter(period time.Duration, now time.Time, renewals ...time.Time) time.Duration {
+	requeue := period
+	for _, renewAt := range renewals {
+		renewIn := renewAt.Sub(now)
+		if renewIn < time.Second {
+			renewIn = time.Second
+		}
+		if requeue <= 0 || renewIn < requeue {
+			requeue = renewIn
+		}
+	}
+	return requeue
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -29,11 +31,46 @@ var (
 		Name:      "last_sync_status",
 		Help:      "The result of the last sync of a secret. 1 = OK, 0 = Error",
 	}, []string{"namespace", "name"})
+
+	keysServed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "secrets_manager",
+		Subsystem: "controller",
+		Name:      "keys_served",
+		Help:      "The backend that served each secret key in its last read. Always 1.",
+	}, []string{"namespace", "name", "key", "backend"})
 )
 
+// servedKey identifies a secret key in the keys_served metric
+type servedKey struct {
+	namespace string
+	name      string
+	key       string
+}
+
+// keysServedBy keeps the backend that served each key, to delete its series when another one serves it
+var keysServedBy = struct {
+	sync.Mutex
+	backends map[servedKey]string
+}{backends: make(map[servedKey]string)}
+
+// setKeyServedBy sets the backend that served a secret key in the keys_served metric,
+// removing the series of the backend that served it before
+func setKeyServedBy(namespace string, name string, key string, backend string) {
+	keysServedBy.Lock()
+	defer keysServedBy.Unlock()
+
+	k := servedKey{namespace: namespace, name: name, key: key}
+	if previous, ok := keysServedBy.backends[k]; ok && previous != backend {
+		keysServed.DeleteLabelValues(namespace, name, key, previous)
+	}
+	keysServedBy.backends[k] = backend
+	keysServed.WithLabelValues(namespace, name, key, backend).Set(1.0)
+}
+
 func init() {
 	r := metrics.Registry
 	r.MustRegister(secretReadErrorsTotal)
 	r.MustRegister(secretSyncErrorsTotal)
 	r.MustRegister(secretLastSyncStatus)
+	r.MustRegister(keysServed)
 }
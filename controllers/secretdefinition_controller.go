@@ -18,8 +18,11 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -29,8 +32,13 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
@@ -39,17 +47,28 @@ const (
 	finalizerName   = "secret.finalizer." + smv1alpha1.Group
 	managedByLabel  = "app.kubernetes.io/managed-by"
 	lastUpdateLabel = smv1alpha1.Group + "/lastUpdateTime"
+	// JSON map of the Secret keys to the version of the secret they were read from
+	versionsAnnotation = smv1alpha1.Group + "/versions"
+	// JSON list of the leases of the dynamic secrets the Secret keys are read from
+	leasesAnnotation = smv1alpha1.Group + "/leases"
+	// JSON description of the certificate issued for the SecretDefinition PKI
+	certificateAnnotation = smv1alpha1.Group + "/certificate"
 )
 
 // SecretDefinitionReconciler reconciles a SecretDefinition object
 type SecretDefinitionReconciler struct {
 	client.Client
-	Backend              backend.Client
+	Backends             *backend.Registry
 	Log                  logr.Logger
 	APIReader            client.Reader
 	ReconciliationPeriod time.Duration
 	ExcludeNamespaces    map[string]bool
 	Scheme               *runtime.Scheme
+
+	// Source Secrets are only watched once a backend reading from them is used
+	controller      controller.Controller
+	watchMutex      sync.Mutex
+	watchingSecrets bool
 }
 
 // Annotations to skip when copying from a SecretDef to a Secret
@@ -75,10 +94,33 @@ func mergeMap(dst map[string]string, srcMap map[string]string, skipKey skipfn) {
 	}
 }
 
-func getSecretFromSecretDefinition(sDef *smv1alpha1.SecretDefinition, data map[string][]byte) *corev1.Secret {
+// stateAnnotations returns the annotations keeping track of the versions, leases and certificate of the secrets read
+func stateAnnotations(versions map[string]string, leases []leaseState, certificate *certificateState) map[string]string {
+	annotations := make(map[string]string)
+	if len(versions) > 0 {
+		encoded, _ := json.Marshal(versions)
+		annotations[versionsAnnotation] = string(encoded)
+	}
+	if len(leases) > 0 {
+		encoded, _ := json.Marshal(leases)
+		annotations[leasesAnnotation] = string(encoded)
+	}
+	if certificate != nil {
+		encoded, _ := json.Marshal(certificate)
+		annotations[certificateAnnotation] = string(encoded)
+	}
+	return annotations
+}
+
+func getSecretFromSecretDefinition(sDef *smv1alpha1.SecretDefinition, data map[string][]byte, stateAnnotations map[string]string) *corev1.Secret {
 	objectMeta := getObjectMetaFromSecretDefinition(sDef)
+	mergeMap(objectMeta.Annotations, stateAnnotations, noSkip)
+	secretType := corev1.SecretType(sDef.Spec.Type)
+	if secretType == "" && sDef.Spec.PKI != nil {
+		secretType = corev1.SecretTypeTLS
+	}
 	return &corev1.Secret{
-		Type:       corev1.SecretType(sDef.Spec.Type),
+		Type:       secretType,
 		ObjectMeta: objectMeta,
 		Data:       data,
 	}
@@ -117,33 +159,182 @@ func isNotMarkedForRemoval(sDef smv1alpha1.SecretDefinition) bool {
 	return sDef.ObjectMeta.DeletionTimestamp.IsZero()
 }
 
-// getDesiredState reads the content from the Datasource for later comparison
-func (r *SecretDefinitionReconciler) getDesiredState(keysMap map[string]smv1alpha1.DataSource) (map[string][]byte, error) {
+// backendName returns the name of the backend a DataSource of a SecretDefinition in namespace is read from
+func backendName(namespace string, spec smv1alpha1.SecretDefinitionSpec, dataSource smv1alpha1.DataSource) string {
+	if dataSource.Backend != "" {
+		return dataSource.Backend
+	}
+	if spec.StoreRef != nil {
+		return storeBackendName(spec.StoreRef.Kind, namespace, spec.StoreRef.Name)
+	}
+	return spec.Backend
+}
+
+// validateBackendNames returns an error if any backend of spec is selected by a name with a slash, like the
+// ones stores are registered with, so stores can only be read through storeRef from their own namespace
+func validateBackendNames(spec smv1alpha1.SecretDefinitionSpec) error {
+	names := []string{spec.Backend}
+	if spec.PKI != nil {
+		names = append(names, spec.PKI.Backend)
+	}
+	for _, dataSource := range spec.KeysMap {
+		names = append(names, dataSource.Backend)
+		if dataSource.Transit != nil {
+			names = append(names, dataSource.Transit.Backend)
+		}
+		for _, fallback := range dataSource.Fallbacks {
+			names = append(names, fallback.Backend)
+		}
+	}
+	for _, name := range names {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("invalid backend name %s, stores must be selected with storeRef", name)
+		}
+	}
+	return nil
+}
+
+// dataSourceSources returns the sources a DataSource is read from, in the order they are tried
+func dataSourceSources(namespace string, spec smv1alpha1.SecretDefinitionSpec, dataSource smv1alpha1.DataSource) []backend.Source {
+	sources := []backend.Source{{Backend: backendName(namespace, spec, dataSource), Path: dataSource.Path, Key: dataSource.Key, Version: dataSource.Version, ObjectType: dataSource.ObjectType, Namespace: dataSource.VaultNamespace, KubernetesNamespace: namespace}}
+	for _, fallback := range dataSource.Fallbacks {
+		source := backend.Source{Backend: fallback.Backend, Path: dataSource.Path, Key: dataSource.Key, Version: fallback.Version, ObjectType: fallback.ObjectType, Namespace: fallback.VaultNamespace, KubernetesNamespace: namespace}
+		if fallback.StoreRef != nil {
+			source.Backend = storeBackendName(fallback.StoreRef.Kind, namespace, fallback.StoreRef.Name)
+		}
+		if fallback.Path != "" {
+			source.Path = fallback.Path
+		}
+		if fallback.Key != "" {
+			source.Key = fallback.Key
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// versionedObject returns source without its key and version, identifying the backend object it reads
+func versionedObject(source backend.Source) backend.Source {
+	source.Key = ""
+	source.Version = ""
+	return source
+}
+
+// pinObjectVersions sets the sources without a version to the version already read from their object,
+// so that all the keys of an object, like a certificate and its private key, are read from the same
+// version even if it's rotated between reads
+func pinObjectVersions(sources []backend.Source, objectVersions map[backend.Source]string) []backend.Source {
+	for i, source := range sources {
+		if version, ok := objectVersions[versionedObject(source)]; ok && source.Version == "" {
+			sources[i].Version = version
+		}
+	}
+	return sources
+}
+
+// backendClient returns the client of the backend of source, with the identity of its
+// Kubernetes namespace and reading from its backend namespace if the backend supports them
+func (r *SecretDefinitionReconciler) backendClient(source backend.Source) (backend.Client, error) {
+	return r.Backends.SourceClient(source)
+}
+
+// inlineCiphertext returns true if the DataSource content is the transit ciphertext set in it
+func inlineCiphertext(dataSource smv1alpha1.DataSource) bool {
+	return dataSource.Transit != nil && dataSource.Transit.Ciphertext != ""
+}
 
+// dataSourceDecoder returns the Decoder of the DataSource content, which is decrypted
+// first if it's a transit ciphertext
+func (r *SecretDefinitionReconciler) dataSourceDecoder(namespace string, spec smv1alpha1.SecretDefinitionSpec, dataSource smv1alpha1.DataSource) (backend.Decoder, error) {
+	decoder, err := backend.NewDecoder(dataSource.Encoding)
+	if err != nil || dataSource.Transit == nil {
+		return decoder, err
+	}
+
+	transitBackend := dataSource.Transit.Backend
+	if transitBackend == "" {
+		transitBackend = backendName(namespace, spec, dataSource)
+	}
+	backendClient, err := r.backendClient(backend.Source{Backend: transitBackend, Namespace: dataSource.VaultNamespace, KubernetesNamespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+	transitClient, ok := backendClient.(backend.TransitClient)
+	if !ok {
+		return nil, fmt.Errorf("backend %s can't decrypt transit ciphertexts", servedByLabel(backend.Source{Backend: transitBackend}))
+	}
+	return backend.TransitDecoder{
+		Client:  transitClient,
+		Mount:   dataSource.Transit.Mount,
+		Key:     dataSource.Transit.Key,
+		Decoder: decoder,
+	}, nil
+}
+
+// servedByLabel returns the name of the backend a source is read from as a metric label
+func servedByLabel(source backend.Source) string {
+	if source.Backend == "" {
+		return "default"
+	}
+	return source.Backend
+}
+
+// getDesiredState reads the content from the Datasource for later comparison, together
+// with the versions of the secrets read, for the backends supporting them
+func (r *SecretDefinitionReconciler) getDesiredState(namespace string, spec smv1alpha1.SecretDefinitionSpec) (map[string][]byte, map[string]string, error) {
+
+	if err := validateBackendNames(spec); err != nil {
+		return nil, nil, err
+	}
 	desiredState := make(map[string][]byte)
+	versions := make(map[string]string)
+	objectVersions := make(map[backend.Source]string)
 	var err error
-	for k, v := range keysMap {
-		bSecret, err := r.Backend.ReadSecret(v.Path, v.Key)
-		if err != nil {
-			r.Log.Error(err, "unable to read secret from backend", "path", v.Path, "key", v.Key)
-			return nil, err
+	for k, v := range spec.KeysMap {
+		sources := pinObjectVersions(dataSourceSources(namespace, spec, v), objectVersions)
+		source := sources[0]
+		var bSecret string
+		if inlineCiphertext(v) {
+			if v.Path != "" || len(v.Fallbacks) > 0 {
+				return nil, nil, fmt.Errorf("transit ciphertext of key %s can't be set together with a path or fallbacks", k)
+			}
+			bSecret = v.Transit.Ciphertext
+		} else {
+			// Dynamic secrets are read by getLeasedState
+			if _, ok := r.leasedClient(source); ok {
+				continue
+			}
+			bSecret, source, err = r.Backends.ReadSecret(sources)
+			if err != nil {
+				r.Log.Error(err, "unable to read secret from backend", "backend", sources[0].Backend, "path", v.Path, "key", v.Key, "fallbacks", len(v.Fallbacks))
+				return nil, nil, err
+			}
+		}
+		if source.Version != "" {
+			versions[k] = source.Version
+			objectVersions[versionedObject(source)] = source.Version
+		}
+		if source.Backend != sources[0].Backend || source.Path != sources[0].Path || source.Key != sources[0].Key {
+			r.Log.Info("secret read from fallback", "backend", source.Backend, "path", source.Path, "key", source.Key)
 		}
-		decoder, err := backend.NewDecoder(v.Encoding)
+		setKeyServedBy(namespace, spec.Name, k, servedByLabel(source))
+		decoder, err := r.dataSourceDecoder(namespace, spec, v)
 		if err != nil {
-			r.Log.Error(err, "refusing to use encoding", "encoding", v.Encoding)
-			return nil, err
+			r.Log.Error(err, "unable to get decoder for secret", "encoding", v.Encoding, "transit", v.Transit != nil)
+			return nil, nil, err
 		}
 		desiredState[k], err = decoder.DecodeString(bSecret)
 		if err != nil {
 			r.Log.Error(err, "unable to decode data for secret", "encoding", v.Encoding, "path", v.Path, "key", v.Key)
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return desiredState, err
+	return desiredState, versions, err
 }
 
-// getCurrentState reads the content from the Kubernetes Secret API object for later comparison
-func (r *SecretDefinitionReconciler) getCurrentState(ctx context.Context, namespace string, name string) (map[string][]byte, error) {
+// getCurrentState reads the content from the Kubernetes Secret API object for later comparison,
+// together with its annotations
+func (r *SecretDefinitionReconciler) getCurrentState(ctx context.Context, namespace string, name string) (map[string][]byte, map[string]string, error) {
 	// We don't read secrets from cache, as it's not the object we reconcile
 	reader := r.APIReader
 	data := make(map[string][]byte)
@@ -154,15 +345,25 @@ func (r *SecretDefinitionReconciler) getCurrentState(ctx context.Context, namesp
 	}, secret)
 	if err != nil {
 		secretReadErrorsTotal.WithLabelValues(name, namespace).Inc()
-		return data, err
+		return data, nil, err
 	}
 	data = secret.Data
-	return data, err
+	return data, secret.Annotations, err
+}
+
+// sameStateAnnotations returns true if the current annotations hold the desired versions, leases and certificate
+func sameStateAnnotations(desired map[string]string, current map[string]string) bool {
+	for _, annotation := range []string{versionsAnnotation, leasesAnnotation, certificateAnnotation} {
+		if desired[annotation] != current[annotation] {
+			return false
+		}
+	}
+	return true
 }
 
 // upsertSecret will create or update a secret
-func (r *SecretDefinitionReconciler) upsertSecret(ctx context.Context, sDef *smv1alpha1.SecretDefinition, data map[string][]byte) error {
-	secret := getSecretFromSecretDefinition(sDef, data)
+func (r *SecretDefinitionReconciler) upsertSecret(ctx context.Context, sDef *smv1alpha1.SecretDefinition, data map[string][]byte, stateAnnotations map[string]string) error {
+	secret := getSecretFromSecretDefinition(sDef, data, stateAnnotations)
 	err := r.Create(ctx, secret)
 	if errors.IsAlreadyExists(err) {
 		err = r.Update(ctx, secret)
@@ -222,6 +423,7 @@ func getObjectMetaFromSecretDefinition(sDef *smv1alpha1.SecretDefinition) metav1
 //+kubebuilder:rbac:groups=secrets-manager.tuenti.io,resources=secretdefinitions/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=secrets-manager.tuenti.io,resources=secretdefinitions/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -260,8 +462,24 @@ func (r *SecretDefinitionReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			log.Info("Secret definition in excluded namespace, ignoring", "excluded_namespaces", r.ExcludeNamespaces)
 			return ctrl.Result{}, nil
 		}
+
+		if len(sourceSecrets(r.Backends, *sDef)) > 0 {
+			if err = r.watchSourceSecrets(); err != nil {
+				log.Error(err, "unable to watch source Secrets")
+			}
+		}
+		// Get the actual secret from Kubernetes
+		currentState, currentAnnotations, err := r.getCurrentState(ctx, secretNamespace, secretName)
+
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "unable to get current state of secret")
+			secretSyncErrorsTotal.WithLabelValues(secretNamespace, secretName).Inc()
+			secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(0.0)
+			return ctrl.Result{}, ignoreNotFoundError(err)
+		}
+
 		// Get data from the secret source of truth
-		desiredState, err := r.getDesiredState(sDef.Spec.KeysMap)
+		desiredState, desiredVersions, err := r.getDesiredState(sDef.Namespace, sDef.Spec)
 
 		if err != nil {
 			log.Error(err, "unable to get desired state for secret")
@@ -270,38 +488,82 @@ func (r *SecretDefinitionReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			return ctrl.Result{}, err
 		}
 
-		// Get the actual secret from Kubernetes
-		currentState, err := r.getCurrentState(ctx, secretNamespace, secretName)
+		// Dynamic secrets are only issued again when their lease can't be renewed
+		currentLeases := trustedLeases(annotatedLeases(currentAnnotations), sDef.Status.IssuedLeases)
+		leasedState, desiredLeases, err := r.getLeasedState(sDef.Namespace, sDef.Spec, currentState, currentLeases)
 
-		if err != nil && !errors.IsNotFound(err) {
-			log.Error(err, "unable to get current state of secret")
+		if err != nil {
+			log.Error(err, "unable to get dynamic secrets")
 			secretSyncErrorsTotal.WithLabelValues(secretNamespace, secretName).Inc()
 			secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(0.0)
-			return ctrl.Result{}, ignoreNotFoundError(err)
+			return ctrl.Result{}, err
+		}
+		for k, v := range leasedState {
+			desiredState[k] = v
 		}
 
-		eq := reflect.DeepEqual(desiredState, currentState)
+		// Certificates are only issued again when they must be renewed
+		certificateState, desiredCertificate, err := r.getCertificateState(sDef.Namespace, sDef.Spec, currentState, annotatedCertificate(currentAnnotations))
+
+		if err != nil {
+			log.Error(err, "unable to get certificate")
+			r.revokeLeases(secretNamespace, issuedLeases(currentLeases, desiredLeases), log)
+			secretSyncErrorsTotal.WithLabelValues(secretNamespace, secretName).Inc()
+			secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(0.0)
+			return ctrl.Result{}, err
+		}
+		for k, v := range certificateState {
+			desiredState[k] = v
+		}
+		desiredAnnotations := stateAnnotations(desiredVersions, desiredLeases, desiredCertificate)
+
+		eq := reflect.DeepEqual(desiredState, currentState) && sameStateAnnotations(desiredAnnotations, currentAnnotations)
 		if !eq {
 			log.Info("secret must be updated")
-			if err := r.upsertSecret(ctx, sDef, desiredState); err != nil {
+			issued := issuedLeases(currentLeases, desiredLeases)
+			if err := r.recordIssuedLeases(ctx, sDef, issued); err != nil {
+				log.Error(err, "unable to record issued leases")
+				r.revokeLeases(secretNamespace, issued, log)
+				secretSyncErrorsTotal.WithLabelValues(secretNamespace, secretName).Inc()
+				secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(0.0)
+				return ctrl.Result{}, err
+			}
+			if err := r.upsertSecret(ctx, sDef, desiredState, desiredAnnotations); err != nil {
 				log.Error(err, "unable to upsert secret")
+				// Nobody will use the credentials just issued
+				r.revokeLeases(secretNamespace, issued, log)
 				secretSyncErrorsTotal.WithLabelValues(secretNamespace, secretName).Inc()
 				secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(0.0)
 				return ctrl.Result{}, err
 			}
 			log.Info("secret updated")
+			r.revokeLeases(secretNamespace, droppedLeases(currentLeases, desiredLeases), log)
+		}
+		if err := r.pruneIssuedLeases(ctx, sDef, desiredLeases); err != nil {
+			// Leases no longer in use are pruned in the next reconciliation
+			log.Error(err, "unable to prune issued leases")
 		}
 		secretLastSyncStatus.WithLabelValues(secretNamespace, secretName).Set(1.0)
-		return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+		renewals := leaseRenewals(desiredLeases)
+		if desiredCertificate != nil {
+			renewals = append(renewals, desiredCertificate.renewAt(renewPercentage(sDef.Spec.PKI)))
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter(r.ReconciliationPeriod, time.Now(), renewals...)}, nil
 
 	} else {
 		// SecretDefinition has been marked for deletion and contains finalizer
 		if containsString(sDef.ObjectMeta.Finalizers, finalizerName) {
+			_, currentAnnotations, err := r.getCurrentState(ctx, secretNamespace, secretName)
+			if err != nil && !errors.IsNotFound(err) {
+				log.Error(err, "unable to get current state of secret")
+				return ctrl.Result{}, err
+			}
 			if err = r.deleteSecret(ctx, secretNamespace, secretName); err != nil && !errors.IsNotFound(err) {
 				log.Error(err, "unable to delete secret")
 				return ctrl.Result{}, ignoreNotFoundError(err)
 			}
 			log.Info("secret deleted successfully")
+			r.revokeLeases(secretNamespace, trustedLeases(annotatedLeases(currentAnnotations), sDef.Status.IssuedLeases), log)
 			// If success remove finalizer
 			sDef.ObjectMeta.Finalizers = removeString(sDef.ObjectMeta.Finalizers, finalizerName)
 			if err = r.Update(ctx, sDef); err != nil {
@@ -314,12 +576,106 @@ func (r *SecretDefinitionReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 }
 
+// sourceSecrets returns the Kubernetes Secrets the SecretDefinition keys are read from
+func sourceSecrets(backends *backend.Registry, sDef smv1alpha1.SecretDefinition) []types.NamespacedName {
+	if validateBackendNames(sDef.Spec) != nil {
+		return nil
+	}
+	var secrets []types.NamespacedName
+	for _, v := range sDef.Spec.KeysMap {
+		for _, dataSource := range dataSourceSources(sDef.Namespace, sDef.Spec, v) {
+			backendClient, err := backends.Get(dataSource.Backend)
+			if err != nil {
+				continue
+			}
+			sourceClient, ok := backendClient.(backend.KubernetesSourceClient)
+			if !ok {
+				continue
+			}
+			if source, err := sourceClient.SourceSecret(dataSource.Path); err == nil {
+				secrets = append(secrets, source)
+			}
+		}
+	}
+	return secrets
+}
+
+// referencesSecret will return true if any of the SecretDefinition keys is read from the given source Secret
+func referencesSecret(backends *backend.Registry, sDef smv1alpha1.SecretDefinition, secret types.NamespacedName) bool {
+	for _, source := range sourceSecrets(backends, sDef) {
+		if source == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// secretDefinitionsForSourceSecret maps a source Secret to the SecretDefinitions reading from it,
+// so that they are reconciled as soon as the Secret changes
+func (r *SecretDefinitionReconciler) secretDefinitionsForSourceSecret() handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		secret := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		if r.shouldExclude(secret.Namespace) {
+			return nil
+		}
+
+		sDefList := &smv1alpha1.SecretDefinitionList{}
+		if err := r.List(context.Background(), sDefList); err != nil {
+			r.Log.Error(err, "unable to list SecretDefinitions for source secret", "secret", secret)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, sDef := range sDefList.Items {
+			if r.shouldExclude(sDef.Namespace) || !referencesSecret(r.Backends, sDef, secret) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: sDef.Namespace, Name: sDef.Name},
+			})
+		}
+		return requests
+	}
+}
+
+// watchSourceSecrets starts watching Secrets, so that the SecretDefinitions reading from them through
+// backends like kubernetes don't need to wait for the next reconciliation period to pick up their changes.
+// Secrets aren't watched until then, as it caches every Secret of the watched namespaces.
+func (r *SecretDefinitionReconciler) watchSourceSecrets() error {
+	r.watchMutex.Lock()
+	defer r.watchMutex.Unlock()
+
+	if r.watchingSecrets || r.controller == nil {
+		return nil
+	}
+	err := r.controller.Watch(&source.Kind{Type: &corev1.Secret{}},
+		handler.EnqueueRequestsFromMapFunc(r.secretDefinitionsForSourceSecret()))
+	if err != nil {
+		return err
+	}
+	r.Log.Info("watching source Secrets")
+	r.watchingSecrets = true
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *SecretDefinitionReconciler) SetupWithManager(mgr ctrl.Manager, name string) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&smv1alpha1.SecretDefinition{}).
 		Named(name).
-		Complete(r)
+		Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+
+	// Backends added later by stores start the watch once a SecretDefinition reads from them
+	for _, backendClient := range r.Backends.Clients() {
+		if _, ok := backendClient.(backend.KubernetesSourceClient); ok {
+			return r.watchSourceSecrets()
+		}
+	}
+	return nil
 }
 
 func init() {
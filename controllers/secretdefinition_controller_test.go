@@ -7,7 +7,9 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	smv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
 	"github.com/tuenti/secrets-manager/errors"
 
 	"reflect"
@@ -246,7 +248,7 @@ var _ = Describe("SecretsManager", func() {
 					Name:      secretdefinition.Name,
 				},
 			})
-			data, err3 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
+			data, _, err3 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
 			print(data)
 			// then:
 			Expect(err).To(BeNil())
@@ -283,7 +285,7 @@ var _ = Describe("SecretsManager", func() {
 			//Expect(secretdefinition.ObjectMeta.Finalizers).To(BeEmpty())
 
 			// when:
-			data, err3 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
+			data, _, err3 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
 
 			// then:
 			Expect(err3).To(BeNil())
@@ -297,7 +299,7 @@ var _ = Describe("SecretsManager", func() {
 					Name:      secretdefinition.Name,
 				},
 			})
-			data2, err6 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
+			data2, _, err6 := r.getCurrentState(ctx, "default", secretdefinition.ObjectMeta.Name)
 
 			// then:
 			Expect(err4).To(BeNil())
@@ -364,8 +366,8 @@ var _ = Describe("SecretsManager", func() {
 			ctx := context.Background()
 
 			// when:
-			err := r.upsertSecret(ctx, secretdefinition, anyData)
-			err2 := r.upsertSecret(ctx, secretdefinition, anyData)
+			err := r.upsertSecret(ctx, secretdefinition, anyData, nil)
+			err2 := r.upsertSecret(ctx, secretdefinition, anyData, nil)
 
 			// then:
 			Expect(err).To(BeNil())
@@ -377,7 +379,7 @@ var _ = Describe("SecretsManager", func() {
 			ctx := context.Background()
 
 			// when:
-			err := r.upsertSecret(ctx, secretdefinition, anyData)
+			err := r.upsertSecret(ctx, secretdefinition, anyData, nil)
 
 			// then:
 			Expect(err).To(BeNil())
@@ -417,6 +419,672 @@ var _ = Describe("SecretsManager", func() {
 		})
 
 	})
+	Context("SecretDefinitionReconciler.getDesiredState", func() {
+
+		It("Reads every key from the selected backend", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "ZGVmYXVsdA=="},
+			}))
+			backends.Add("vault-eu", newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "ZXU="},
+			}))
+			backends.Add("azure", newFakeBackend([]fakeBackendSecret{
+				{"app-password", "", "YXp1cmU="},
+			}))
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name:    "multi-backend",
+				Backend: "vault-eu",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"eu":    {Path: "secret/data/app", Key: "password", Encoding: "base64"},
+					"azure": {Path: "app-password", Encoding: "base64", Backend: "azure"},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"eu": []byte("eu"), "azure": []byte("azure")}))
+
+			// when:
+			spec.Backend = ""
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"default": {Path: "secret/data/app", Key: "password", Encoding: "base64"},
+			}
+			desiredState, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"default": []byte("default")}))
+
+			// when:
+			spec.Backend = "not-configured"
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(errors.IsBackendNotFound(err)).To(BeTrue())
+		})
+
+		It("Reads from the referenced store", func() {
+			// given:
+			backends := backend.NewRegistry(nil)
+			backends.Add("SecretStore/default/team-vault", newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "dGVhbQ=="},
+			}))
+			backends.Add("ClusterSecretStore/shared-vault", newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "c2hhcmVk"},
+			}))
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name:     "store",
+				StoreRef: &smv1alpha1.StoreReference{Name: "team-vault"},
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"password": {Path: "secret/data/app", Key: "password", Encoding: "base64"},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"password": []byte("team")}))
+
+			// when:
+			spec.StoreRef = &smv1alpha1.StoreReference{Kind: smv1alpha1.ClusterSecretStoreKind, Name: "shared-vault"}
+			desiredState, _, err = r2.getDesiredState("other", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"password": []byte("shared")}))
+
+			// when:
+			spec.StoreRef = &smv1alpha1.StoreReference{Name: "team-vault"}
+			_, _, err = r2.getDesiredState("other", spec)
+
+			// then:
+			Expect(errors.IsBackendNotFound(err)).To(BeTrue())
+		})
+
+		It("Doesn't read from stores of other namespaces by name", func() {
+			// given:
+			backends := backend.NewRegistry(nil)
+			backends.Add("SecretStore/default/team-vault", newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "team"},
+			}))
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "store",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"password": {Path: "secret/data/app", Key: "password", Backend: "SecretStore/default/team-vault"},
+				},
+			}
+
+			// when:
+			_, _, err := r2.getDesiredState("other", spec)
+
+			// then:
+			Expect(err).To(MatchError("invalid backend name SecretStore/default/team-vault, stores must be selected with storeRef"))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"password": {Path: "secret/data/app", Key: "password", Fallbacks: []smv1alpha1.FallbackSource{{Backend: "SecretStore/default/team-vault"}}},
+			}
+			_, _, err = r2.getDesiredState("other", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+			Expect(referencesSecret(backends, smv1alpha1.SecretDefinition{Spec: spec}, types.NamespacedName{})).To(BeFalse())
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with versions", func() {
+
+		It("Returns the version of the secrets read", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "ZGVmYXVsdA=="},
+			}))
+			backends.Add("vault", fakeVersionedBackend{
+				fakeBackend: newFakeBackend([]fakeBackendSecret{
+					{"secret/data/app", "password", "dmF1bHQ="},
+				}),
+				latestVersion: "4",
+			})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "versioned",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"latest":      {Path: "secret/data/app", Key: "password", Backend: "vault"},
+					"pinned":      {Path: "secret/data/app", Key: "password", Backend: "vault", Version: "2"},
+					"unversioned": {Path: "secret/data/app", Key: "password"},
+				},
+			}
+
+			// when:
+			_, versions, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(Equal(map[string]string{"latest": "4", "pinned": "2"}))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"pinned": {Path: "secret/data/app", Key: "password", Version: "2"},
+			}
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(errors.IsSecretVersionNotSupported(err)).To(BeTrue())
+		})
+
+		It("Annotates the versions on the Secret", func() {
+			// when:
+			secret := getSecretFromSecretDefinition(sd, anyData, stateAnnotations(map[string]string{"foo": "4"}, nil, nil))
+
+			// then:
+			Expect(secret.Annotations).To(HaveKeyWithValue(versionsAnnotation, `{"foo":"4"}`))
+
+			// when:
+			secret = getSecretFromSecretDefinition(sd, anyData, nil)
+
+			// then:
+			Expect(secret.Annotations).ToNot(HaveKey(versionsAnnotation))
+		})
+	})
+	Context("SecretDefinitionReconciler.getLeasedState", func() {
+
+		It("Issues dynamic secrets once per path and keeps them while their lease is valid", func() {
+			// given:
+			database := newFakeLeasedBackend(map[string]string{"username": "v-app-1", "password": "p4ss"}, time.Hour)
+			backends := backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "c3RhdGlj"},
+			}))
+			backends.Add("database", database)
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "dynamic",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"static":   {Path: "secret/data/app", Key: "password", Encoding: "base64"},
+					"username": {Path: "database/creds/app", Key: "username", Backend: "database"},
+					"password": {Path: "database/creds/app", Key: "password", Backend: "database"},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"static": []byte("static")}))
+
+			// when:
+			leasedState, leases, err := r2.getLeasedState("default", spec, nil, nil)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(leasedState).To(Equal(map[string][]byte{"username": []byte("v-app-1"), "password": []byte("p4ss")}))
+			Expect(leases).To(HaveLen(1))
+			Expect(leases[0].Backend).To(Equal("database"))
+			Expect(leases[0].Path).To(Equal("database/creds/app"))
+			Expect(database.state.issued).To(Equal(1))
+
+			// when:
+			keptState, keptLeases, err := r2.getLeasedState("default", spec, leasedState, leases)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keptState).To(Equal(leasedState))
+			Expect(keptLeases).To(Equal(leases))
+			Expect(database.state.issued).To(Equal(1))
+			Expect(database.state.renewed).To(Equal(0))
+		})
+
+		It("Renews the leases close to expire and issues new secrets when they can't be renewed", func() {
+			// given:
+			database := newFakeLeasedBackend(map[string]string{"username": "v-app-1"}, time.Hour)
+			backends := backend.NewRegistry(nil)
+			backends.Add("database", database)
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "dynamic",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"username": {Path: "database/creds/app", Key: "username", Backend: "database"},
+				},
+			}
+			currentState := map[string][]byte{"username": []byte("v-app-0")}
+			expiring := leaseState{
+				Backend:   "database",
+				Path:      "database/creds/app",
+				ID:        "database/creds/app/lease-0",
+				Renewable: true,
+				Duration:  metav1.Duration{Duration: time.Hour},
+				Expires:   metav1.NewTime(time.Now().Add(10 * time.Minute)),
+			}
+
+			// when:
+			leasedState, leases, err := r2.getLeasedState("default", spec, currentState, []leaseState{expiring})
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(leasedState).To(Equal(currentState))
+			Expect(leases[0].ID).To(Equal("database/creds/app/lease-0"))
+			Expect(leases[0].Expires.After(expiring.Expires.Time)).To(BeTrue())
+			Expect(database.state.renewed).To(Equal(1))
+
+			// when:
+			database.state.maxTTLReached = true
+			leasedState, leases, err = r2.getLeasedState("default", spec, currentState, []leaseState{expiring})
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(leasedState).To(Equal(map[string][]byte{"username": []byte("v-app-1")}))
+			Expect(leases[0].ID).ToNot(Equal("database/creds/app/lease-0"))
+			Expect(database.state.issued).To(Equal(1))
+			Expect(requeueAfter(time.Hour, time.Now(), leaseRenewals(leases)...)).To(BeNumerically("<=", 40*time.Minute))
+
+			// when:
+			r2.revokeLeases("default", droppedLeases([]leaseState{expiring}, nil), r.Log)
+
+			// then:
+			Expect(database.state.revoked).To(Equal([]string{"database/creds/app/lease-0"}))
+
+			// when:
+			spec.KeysMap["username"] = smv1alpha1.DataSource{Path: "database/creds/app", Key: "username", Backend: "database", Version: "2"}
+			_, _, err = r2.getLeasedState("default", spec, nil, nil)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Only trusts the leases issued for the SecretDefinition", func() {
+			// given:
+			own := leaseState{Backend: "database", Path: "database/creds/app", ID: "database/creds/app/lease-1"}
+			foreign := leaseState{Backend: "database", Path: "database/creds/app", ID: "database/creds/other/lease-2"}
+			unrecorded := leaseState{Backend: "database", Path: "database/creds/app", ID: "database/creds/app/lease-3"}
+
+			// when:
+			leases := trustedLeases([]leaseState{own, foreign, unrecorded}, []string{own.ID, foreign.ID})
+
+			// then:
+			Expect(leases).To(Equal([]leaseState{own}))
+		})
+	})
+	Context("SecretDefinitionReconciler.getCertificateState", func() {
+
+		It("Issues a certificate and keeps it until it must be renewed", func() {
+			// given:
+			issued := 0
+			backends := backend.NewRegistry(newFakeBackend(nil))
+			backends.Add("vault-pki", fakeCertificateBackend{fakeBackend: newFakeBackend(nil), issued: &issued})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "payments-tls",
+				PKI: &smv1alpha1.PKICertificate{
+					Backend:    "vault-pki",
+					Role:       "internal",
+					CommonName: "payments.internal",
+					TTL:        &metav1.Duration{Duration: 24 * time.Hour},
+				},
+			}
+
+			// when:
+			data, certificate, err := r2.getCertificateState("default", spec, nil, nil)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(map[string][]byte{
+				"tls.crt": []byte("certificate-1 for payments.internal"),
+				"tls.key": []byte("key-1"),
+				"ca.crt":  []byte("ca"),
+			}))
+			Expect(certificate.Serial).To(Equal("1"))
+			Expect(certificate.renewAt(renewPercentage(spec.PKI))).To(BeTemporally("~", time.Now().Add(24*time.Hour*66/100), time.Minute))
+
+			// when:
+			kept, keptCertificate, err := r2.getCertificateState("default", spec, data, certificate)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kept).To(Equal(data))
+			Expect(keptCertificate).To(Equal(certificate))
+			Expect(issued).To(Equal(1))
+
+			// when:
+			spec.PKI.AltNames = []string{"payments.default.svc"}
+			_, renewed, err := r2.getCertificateState("default", spec, data, certificate)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(renewed.Serial).To(Equal("2"))
+
+			// when:
+			expiring := *renewed
+			expiring.NotBefore = metav1.NewTime(time.Now().Add(-20 * time.Hour))
+			expiring.NotAfter = metav1.NewTime(time.Now().Add(4 * time.Hour))
+			_, renewed, err = r2.getCertificateState("default", spec, data, &expiring)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(renewed.Serial).To(Equal("3"))
+
+			// when:
+			spec.PKI.Backend = ""
+			_, _, err = r2.getCertificateState("default", spec, nil, nil)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Creates TLS Secrets for certificates", func() {
+			// given:
+			tlsSd := sd.DeepCopy()
+			tlsSd.Spec.Type = ""
+			tlsSd.Spec.PKI = &smv1alpha1.PKICertificate{Role: "internal", CommonName: "payments.internal"}
+
+			// when:
+			secret := getSecretFromSecretDefinition(tlsSd, anyData, nil)
+
+			// then:
+			Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with transit", func() {
+
+		It("Decrypts the ciphertexts set inline or read from the backend", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "vault:v1:drowssap"},
+			}))
+			backends.Add("vault", fakeTransitBackend{newFakeBackend(nil)})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "encrypted",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"inline": {Backend: "vault", Transit: &smv1alpha1.TransitDecryption{Key: "gitops", Ciphertext: "vault:v1:nekot"}},
+					"read":   {Path: "secret/data/app", Key: "password", Transit: &smv1alpha1.TransitDecryption{Backend: "vault", Key: "gitops"}},
+					"base64": {Backend: "vault", Encoding: "base64", Transit: &smv1alpha1.TransitDecryption{Key: "gitops", Ciphertext: "vault:v1:=4WahxGc"}},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{
+				"inline": []byte("token"),
+				"read":   []byte("password"),
+				"base64": []byte("plain"),
+			}))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"not-transit": {Transit: &smv1alpha1.TransitDecryption{Key: "gitops", Ciphertext: "vault:v1:nekot"}},
+			}
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with Vault namespaces", func() {
+
+		It("Reads every key from its Vault namespace", func() {
+			// given:
+			backends := backend.NewRegistry(fakeNamespacedBackend{newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "root"},
+				{"payments/secret/data/app", "password", "payments"},
+			})})
+			backends.Add("azure", newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "azure"},
+			}))
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "namespaced",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"root":     {Path: "secret/data/app", Key: "password"},
+					"payments": {Path: "secret/data/app", Key: "password", VaultNamespace: "payments"},
+					"fallback": {Path: "secret/data/app", Key: "password", VaultNamespace: "billing", Fallbacks: []smv1alpha1.FallbackSource{{Backend: "azure"}}},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{
+				"root":     []byte("root"),
+				"payments": []byte("payments"),
+				"fallback": []byte("azure"),
+			}))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"azure": {Path: "secret/data/app", Key: "password", Backend: "azure", VaultNamespace: "payments"},
+			}
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(errors.IsNamespaceNotSupported(err)).To(BeTrue())
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with namespace identities", func() {
+
+		It("Reads every key with the identity of the SecretDefinition namespace", func() {
+			// given:
+			backends := backend.NewRegistry(fakeIdentityBackend{newFakeBackend([]fakeBackendSecret{
+				{"secret/data/team-a/app", "password", "team-a"},
+				{"secret/data/team-b/app", "password", "team-b"},
+			})})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "tenant",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"password": {Path: "secret/data/team-a/app", Key: "password"},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("team-a", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"password": []byte("team-a")}))
+
+			// when:
+			_, _, err = r2.getDesiredState("team-b", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with object types", func() {
+
+		It("Reads every key from the object of its type", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend(nil))
+			backends.Add("azure-kv", fakeObjectBackend{newFakeBackend([]fakeBackendSecret{
+				{"certificate/www", "certificate", "certificate"},
+				{"certificate/www", "privateKey", "private-key"},
+				{"www", "certificate", "secret"},
+			})})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "www-tls",
+				Type: "kubernetes.io/tls",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"tls.crt": {Path: "www", Key: "certificate", Backend: "azure-kv", ObjectType: "certificate"},
+					"tls.key": {Path: "www", Key: "privateKey", Backend: "azure-kv", ObjectType: "certificate"},
+					"secret":  {Path: "www", Key: "certificate", Backend: "azure-kv"},
+				},
+			}
+
+			// when:
+			desiredState, versions, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{
+				"tls.crt": []byte("certificate"),
+				"tls.key": []byte("private-key"),
+				"secret":  []byte("secret"),
+			}))
+			Expect(versions).To(Equal(map[string]string{"tls.crt": "1", "tls.key": "1"}))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"tls.crt": {Path: "www", Key: "certificate", ObjectType: "certificate"},
+			}
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(errors.IsObjectTypeNotSupported(err)).To(BeTrue())
+		})
+
+		It("Reads every key of an object from the same version", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend(nil))
+			backends.Add("azure-kv", fakeRotatingObjectBackend{latest: make(map[string]int)})
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "www-tls",
+				Type: "kubernetes.io/tls",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"tls.crt": {Path: "www", Key: "certificate", Backend: "azure-kv", ObjectType: "certificate"},
+					"tls.key": {Path: "www", Key: "privateKey", Backend: "azure-kv", ObjectType: "certificate"},
+				},
+			}
+
+			// when:
+			desiredState, versions, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{
+				"tls.crt": []byte("certificate-1"),
+				"tls.key": []byte("privateKey-1"),
+			}))
+			Expect(versions).To(Equal(map[string]string{"tls.crt": "1", "tls.key": "1"}))
+
+			// when:
+			desiredState, versions, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{
+				"tls.crt": []byte("certificate-2"),
+				"tls.key": []byte("privateKey-2"),
+			}))
+			Expect(versions).To(Equal(map[string]string{"tls.crt": "2", "tls.key": "2"}))
+		})
+	})
+	Context("SecretDefinitionReconciler.getDesiredState with fallbacks", func() {
+
+		It("Reads every key from the first backend serving it", func() {
+			// given:
+			backends := backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
+				{"secret/data/app", "password", "dmF1bHQ="},
+			}))
+			backends.Add("azure", newFakeBackend([]fakeBackendSecret{
+				{"app-token", "password", "YXp1cmU="},
+				{"app-token", "token", "dG9rZW4="},
+			}))
+			r2 := &SecretDefinitionReconciler{Backends: backends, Log: r.Log}
+			fallbacks := []smv1alpha1.FallbackSource{
+				{Backend: "azure", Path: "app-token"},
+			}
+			spec := smv1alpha1.SecretDefinitionSpec{
+				Name: "migrating",
+				KeysMap: map[string]smv1alpha1.DataSource{
+					"password": {Path: "secret/data/app", Key: "password", Encoding: "base64", Fallbacks: fallbacks},
+					"token":    {Path: "secret/data/app", Key: "token", Encoding: "base64", Fallbacks: fallbacks},
+				},
+			}
+
+			// when:
+			desiredState, _, err := r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(desiredState).To(Equal(map[string][]byte{"password": []byte("vault"), "token": []byte("token")}))
+
+			// when:
+			spec.KeysMap = map[string]smv1alpha1.DataSource{
+				"missing": {Path: "secret/data/app", Key: "missing", Fallbacks: fallbacks},
+			}
+			_, _, err = r2.getDesiredState("default", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("setKeyServedBy", func() {
+
+		It("Only keeps the series of the backend that served the key last", func() {
+			// when:
+			setKeyServedBy("default", "migrating", "password", "vault")
+			setKeyServedBy("default", "migrating", "password", "azure")
+
+			// then:
+			Expect(testutil.ToFloat64(keysServed.WithLabelValues("default", "migrating", "password", "azure"))).To(Equal(1.0))
+			Expect(keysServed.DeleteLabelValues("default", "migrating", "password", "vault")).To(BeFalse())
+		})
+	})
+	Context("SecretDefinitionReconciler.secretDefinitionsForSourceSecret", func() {
+
+		It("Enqueues SecretDefinitions reading from the source secret", func() {
+			// given:
+			ctx := context.Background()
+			sourceBackend := fakeSourceBackend{newFakeBackend([]fakeBackendSecret{
+				{"shared/registry", "token", encodedValue},
+			})}
+			r2 := &SecretDefinitionReconciler{
+				Client:            r.Client,
+				Backends:          backend.NewRegistry(sourceBackend),
+				APIReader:         r.APIReader,
+				Log:               r.Log,
+				ExcludeNamespaces: map[string]bool{"notwatched": true},
+			}
+			newSourceSecretDefinition := func(namespace string, name string, path string) *smv1alpha1.SecretDefinition {
+				return &smv1alpha1.SecretDefinition{
+					ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+					Spec: smv1alpha1.SecretDefinitionSpec{
+						Name: name,
+						Type: "Opaque",
+						KeysMap: map[string]smv1alpha1.DataSource{
+							"token": {Path: path, Key: "token", Encoding: "base64"},
+						},
+					},
+				}
+			}
+			replicated := newSourceSecretDefinition("watched1", "replicated-secret", "shared/registry")
+			excluded := newSourceSecretDefinition("notwatched", "replicated-secret", "shared/registry")
+			unrelated := newSourceSecretDefinition("watched2", "unrelated-secret", "shared/other")
+			for _, sDef := range []*smv1alpha1.SecretDefinition{replicated, excluded, unrelated} {
+				Expect(r2.Create(ctx, sDef)).To(Succeed())
+			}
+			source := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "registry"}}
+
+			// when:
+			requests := r2.secretDefinitionsForSourceSecret()(source)
+
+			// then:
+			Expect(requests).To(Equal([]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "watched1", Name: "replicated-secret"}},
+			}))
+
+			// when:
+			r2.ExcludeNamespaces["shared"] = true
+			requests = r2.secretDefinitionsForSourceSecret()(source)
+
+			// then:
+			Expect(requests).To(BeEmpty())
+		})
+	})
 	Context("Manager.MultiNamespacedCache", func() {
 
 		It("Creates secret in watched namespace", func(done Done) {
@@ -447,7 +1115,7 @@ var _ = Describe("SecretsManager", func() {
 			r2.Create(ctx, sdWatched)
 			// Sleep for 4 * the reconcile interval set on the controller (just to be safe)
 			time.Sleep(4 * time.Second)
-			data, err := r2.getCurrentState(ctx, "watched", sdWatched.Spec.Name)
+			data, _, err := r2.getCurrentState(ctx, "watched", sdWatched.Spec.Name)
 			Expect(err).To(BeNil())
 			Expect(data).To(Equal(map[string][]byte{"watched": decodedBytes}))
 			cancelfunc()
@@ -478,7 +1146,7 @@ var _ = Describe("SecretsManager", func() {
 			r2.Create(ctx, sdNotWatched)
 			// Sleep for 4 * the reconcile interval set on the controller (just to be safe)
 			time.Sleep(4 * time.Second)
-			data, err := r2.getCurrentState(ctx, "notwatched", sdNotWatched.Spec.Name)
+			data, _, err := r2.getCurrentState(ctx, "notwatched", sdNotWatched.Spec.Name)
 			Expect(err.Error()).To(Equal("secrets \"secret-notwatched\" not found"))
 			Expect(data).To(BeEmpty())
 			cancelfunc()
@@ -512,11 +1180,11 @@ var _ = Describe("SecretsManager", func() {
 			r2.Create(ctx, sdMultiWatched2)
 			// Sleep for 4 * the reconcile interval set on the controller (just to be safe)
 			time.Sleep(4 * time.Second)
-			data, err2 := r2.getCurrentState(ctx, "watched1", sdMultiWatched1.Spec.Name)
+			data, _, err2 := r2.getCurrentState(ctx, "watched1", sdMultiWatched1.Spec.Name)
 			Expect(err2).To(BeNil())
 			Expect(data).To(Equal(map[string][]byte{"multival1": decodedBytes}))
 
-			data2, err3 := r2.getCurrentState(ctx, "watched2", sdMultiWatched2.Spec.Name)
+			data2, _, err3 := r2.getCurrentState(ctx, "watched2", sdMultiWatched2.Spec.Name)
 			Expect(err3).To(BeNil())
 			Expect(data2).To(Equal(map[string][]byte{"multival2": decodedBytes}))
 
@@ -0,0 +1,383 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	smv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	storeReadyReason = "BackendReady"
+	storeErrorReason = "BackendError"
+)
+
+// namespacedStoreBackend lists the flags a SecretStore can set for a backend,
+// and the authentication methods it can use
+type namespacedStoreBackend struct {
+	authMethodFlag string
+	authMethods    map[string]bool
+	flags          map[string]bool
+}
+
+// Namespaced stores can only use the backends and authentication methods whose
+// credentials are all set in the store, so they can't authenticate with the
+// secrets-manager identity, read its files nor Secrets in other namespaces
+var namespacedStoreBackends = map[string]namespacedStoreBackend{
+	"vault": {
+		authMethodFlag: "vault.auth-method",
+		authMethods:    map[string]bool{"approle": true},
+		flags: map[string]bool{
+			"config.backend-timeout":     true,
+			"vault.url":                  true,
+			"vault.auth-method":          true,
+			"vault.role-id":              true,
+			"vault.secret-id":            true,
+			"vault.approle-path":         true,
+			"vault.engine":               true,
+			"vault.namespace":            true,
+			"vault.max-token-ttl":        true,
+			"vault.token-polling-period": true,
+			"vault.renew-ttl-increment":  true,
+			"vault.tls-server-name":      true,
+			"vault.tls-min-version":      true,
+		},
+	},
+	"azure-kv": {
+		authMethodFlag: "azure-kv.auth-method",
+		authMethods:    map[string]bool{"client-secret": true},
+		flags: map[string]bool{
+			"config.backend-timeout": true,
+			"azure-kv.name":          true,
+			"azure-kv.auth-method":   true,
+			"azure-kv.tenant-id":     true,
+			"azure-kv.client-id":     true,
+			"azure-kv.client-secret": true,
+		},
+	},
+	"aws-sm": {
+		authMethodFlag: "aws-sm.auth-method",
+		authMethods:    map[string]bool{"static": true},
+		flags: map[string]bool{
+			"config.backend-timeout":   true,
+			"aws-sm.region":            true,
+			"aws-sm.endpoint":          true,
+			"aws-sm.auth-method":       true,
+			"aws-sm.access-key-id":     true,
+			"aws-sm.secret-access-key": true,
+		},
+	},
+	"aws-ssm": {
+		authMethodFlag: "aws-ssm.auth-method",
+		authMethods:    map[string]bool{"static": true},
+		flags: map[string]bool{
+			"config.backend-timeout":    true,
+			"aws-ssm.region":            true,
+			"aws-ssm.endpoint":          true,
+			"aws-ssm.auth-method":       true,
+			"aws-ssm.access-key-id":     true,
+			"aws-ssm.secret-access-key": true,
+		},
+	},
+	"consul": {
+		flags: map[string]bool{
+			"config.backend-timeout": true,
+			"consul.address":         true,
+			"consul.datacenter":      true,
+			"consul.token":           true,
+			"consul.tls-server-name": true,
+		},
+	},
+	"conjur": {
+		authMethodFlag: "conjur.auth-method",
+		authMethods:    map[string]bool{"api-key": true},
+		flags: map[string]bool{
+			"config.backend-timeout":      true,
+			"conjur.url":                  true,
+			"conjur.account":              true,
+			"conjur.auth-method":          true,
+			"conjur.login":                true,
+			"conjur.api-key":              true,
+			"conjur.token-refresh-period": true,
+		},
+	},
+	"onepassword": {
+		flags: map[string]bool{
+			"config.backend-timeout": true,
+			"onepassword.url":        true,
+			"onepassword.token":      true,
+		},
+	},
+	"bitwarden": {
+		flags: map[string]bool{
+			"config.backend-timeout": true,
+			"bitwarden.api-url":      true,
+			"bitwarden.identity-url": true,
+			"bitwarden.access-token": true,
+		},
+	},
+}
+
+// storeClient keeps track of the backend client built for a store
+type storeClient struct {
+	configHash string
+	cancel     context.CancelFunc
+}
+
+// SecretStoreReconciler reconciles SecretStore objects, or ClusterSecretStore
+// objects if ClusterScoped is set, registering a backend client for each of them
+type SecretStoreReconciler struct {
+	client.Client
+	Backends *backend.Registry
+	// BackendConfig holds the backend settings that can't be set with flags
+	BackendConfig backend.Config
+	// Context bounds the lifetime of the backend clients
+	Context              context.Context
+	Log                  logr.Logger
+	BackendLog           logr.Logger
+	APIReader            client.Reader
+	ClusterScoped        bool
+	ReconciliationPeriod time.Duration
+	ExcludeNamespaces    map[string]bool
+	Scheme               *runtime.Scheme
+
+	// Only accessed from Reconcile, which is never run concurrently
+	stores map[string]storeClient
+}
+
+// storeBackendName returns the name the backend client of a store is registered with
+func storeBackendName(kind string, namespace string, name string) string {
+	if kind == smv1alpha1.ClusterSecretStoreKind {
+		return fmt.Sprintf("%s/%s", smv1alpha1.ClusterSecretStoreKind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", smv1alpha1.SecretStoreKind, namespace, name)
+}
+
+func (r *SecretStoreReconciler) kind() string {
+	if r.ClusterScoped {
+		return smv1alpha1.ClusterSecretStoreKind
+	}
+	return smv1alpha1.SecretStoreKind
+}
+
+// getStore returns the store object together with its spec and status
+func (r *SecretStoreReconciler) getStore(ctx context.Context, key types.NamespacedName) (client.Object, *smv1alpha1.SecretStoreSpec, *smv1alpha1.SecretStoreStatus, error) {
+	if r.ClusterScoped {
+		store := &smv1alpha1.ClusterSecretStore{}
+		err := r.Get(ctx, key, store)
+		return store, &store.Spec, &store.Status, err
+	}
+	store := &smv1alpha1.SecretStore{}
+	err := r.Get(ctx, key, store)
+	return store, &store.Spec, &store.Status, err
+}
+
+// storeFlags returns the flags configuring the store backend, reading the ones set from Secrets
+func (r *SecretStoreReconciler) storeFlags(ctx context.Context, namespace string, spec smv1alpha1.SecretStoreSpec) (map[string]string, error) {
+	allowed, ok := namespacedStoreBackends[spec.Backend]
+	if !r.ClusterScoped && !ok {
+		return nil, fmt.Errorf("backend %s can only be used by ClusterSecretStores", spec.Backend)
+	}
+
+	flags := make(map[string]string, len(spec.Config)+len(spec.ConfigFrom))
+	for name, value := range spec.Config {
+		flags[name] = value
+	}
+	for name, ref := range spec.ConfigFrom {
+		secretNamespace := ref.Namespace
+		if !r.ClusterScoped {
+			secretNamespace = namespace
+		}
+		if secretNamespace == "" {
+			return nil, fmt.Errorf("namespace of the Secret %s for %s is required", ref.Name, name)
+		}
+		// We don't read secrets from cache, as it's not the object we reconcile
+		secret := &corev1.Secret{}
+		err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: secretNamespace, Name: ref.Name}, secret)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in Secret %s/%s", ref.Key, secretNamespace, ref.Name)
+		}
+		flags[name] = string(value)
+	}
+
+	if !r.ClusterScoped {
+		for name := range flags {
+			if !allowed.flags[name] {
+				return nil, fmt.Errorf("%s can only be set by ClusterSecretStores", name)
+			}
+		}
+		// The authentication method is required, as the default one may use the secrets-manager identity
+		if method := flags[allowed.authMethodFlag]; allowed.authMethodFlag != "" && !allowed.authMethods[method] {
+			return nil, fmt.Errorf("%s authentication method %q can only be used by ClusterSecretStores", spec.Backend, method)
+		}
+	}
+	return flags, nil
+}
+
+// configHash returns a digest of the store configuration, so that the backend
+// client is only rebuilt when it changes
+func configHash(backendType string, flags map[string]string) string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", backendType)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, flags[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// upsertStore builds the backend client of a store and registers it, replacing
+// the previous one if its configuration changed
+func (r *SecretStoreReconciler) upsertStore(ctx context.Context, name string, namespace string, spec smv1alpha1.SecretStoreSpec) error {
+	flags, err := r.storeFlags(ctx, namespace, spec)
+	if err != nil {
+		return err
+	}
+	hash := configHash(spec.Backend, flags)
+	previous, found := r.stores[name]
+	if found && previous.configHash == hash {
+		return nil
+	}
+
+	cfg, err := backend.ConfigFromFlags(r.BackendConfig, flags)
+	if err != nil {
+		return err
+	}
+	storeCtx, cancel := context.WithCancel(r.Context)
+	backendClient, err := backend.NewBackendClient(storeCtx, spec.Backend, r.BackendLog.WithName(name), cfg)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	r.Backends.Add(name, *backendClient)
+	r.stores[name] = storeClient{configHash: hash, cancel: cancel}
+	if found {
+		previous.cancel()
+	}
+	return nil
+}
+
+// removeStore unregisters the backend client of a store and stops it
+func (r *SecretStoreReconciler) removeStore(name string) {
+	if current, found := r.stores[name]; found {
+		r.Backends.Remove(name)
+		current.cancel()
+		delete(r.stores, name)
+	}
+}
+
+//+kubebuilder:rbac:groups=secrets-manager.tuenti.io,resources=secretstores;clustersecretstores,verbs=get;list;watch
+//+kubebuilder:rbac:groups=secrets-manager.tuenti.io,resources=secretstores/status;clustersecretstores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile keeps the backend client of a store in sync with its spec, and
+// reports in the store Ready condition whether the backend can be used
+func (r *SecretStoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	kind := r.kind()
+	log := r.Log.WithValues(strings.ToLower(kind), req.NamespacedName)
+	name := storeBackendName(kind, req.Namespace, req.Name)
+
+	if !r.ClusterScoped && r.ExcludeNamespaces[req.Namespace] {
+		log.Info("store in excluded namespace, ignoring", "excluded_namespaces", r.ExcludeNamespaces)
+		return ctrl.Result{}, nil
+	}
+
+	store, spec, status, err := r.getStore(ctx, req.NamespacedName)
+	if errors.IsNotFound(err) {
+		r.removeStore(name)
+		log.Info("store removed")
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, fmt.Sprintf("could not get %s '%s'", kind, req.NamespacedName))
+		return ctrl.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               smv1alpha1.SecretStoreReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: store.GetGeneration(),
+		Reason:             storeReadyReason,
+		Message:            "backend client ready",
+	}
+	storeErr := r.upsertStore(ctx, name, req.Namespace, *spec)
+	if storeErr != nil {
+		log.Error(storeErr, "unable to build backend client for store", "backend", spec.Backend)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = storeErrorReason
+		condition.Message = storeErr.Error()
+	}
+
+	conditions := append([]metav1.Condition(nil), status.Conditions...)
+	meta.SetStatusCondition(&status.Conditions, condition)
+	if !reflect.DeepEqual(conditions, status.Conditions) {
+		if err = r.Status().Update(ctx, store); err != nil {
+			log.Error(err, "unable to update store status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if storeErr != nil {
+		return ctrl.Result{}, storeErr
+	}
+	// Requeue to pick up changes in the Secrets the configuration is read from
+	return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SecretStoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.stores = make(map[string]storeClient)
+
+	var store client.Object = &smv1alpha1.SecretStore{}
+	if r.ClusterScoped {
+		store = &smv1alpha1.ClusterSecretStore{}
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(store).
+		Named(r.kind()).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
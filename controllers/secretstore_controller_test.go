@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	smv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
+	"github.com/tuenti/secrets-manager/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("SecretStore", func() {
+	var (
+		storeReconciler = func(clusterScoped bool) *SecretStoreReconciler {
+			return &SecretStoreReconciler{
+				Client:        k8sClient,
+				APIReader:     k8sClient,
+				Backends:      backend.NewRegistry(nil),
+				Context:       context.Background(),
+				Log:           r.Log,
+				BackendLog:    r.Log,
+				ClusterScoped: clusterScoped,
+				stores:        make(map[string]storeClient),
+			}
+		}
+	)
+
+	Context("storeBackendName", func() {
+
+		It("Namespaces SecretStores but not ClusterSecretStores", func() {
+			Expect(storeBackendName("", "default", "vault")).To(Equal("SecretStore/default/vault"))
+			Expect(storeBackendName(smv1alpha1.SecretStoreKind, "default", "vault")).To(Equal("SecretStore/default/vault"))
+			Expect(storeBackendName(smv1alpha1.ClusterSecretStoreKind, "default", "vault")).To(Equal("ClusterSecretStore/vault"))
+		})
+	})
+
+	Context("SecretStoreReconciler.storeFlags", func() {
+
+		It("Reads the configuration from Secrets in the store namespace", func() {
+			// given:
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vault-approle"},
+				Data:       map[string][]byte{"secret_id": []byte("s3cr3t")},
+			}
+			Expect(k8sClient.Create(context.Background(), secret)).To(Succeed())
+			defer k8sClient.Delete(context.Background(), secret)
+			spec := smv1alpha1.SecretStoreSpec{
+				Backend: "vault",
+				Config:  map[string]string{"vault.auth-method": "approle", "vault.role-id": "role"},
+				ConfigFrom: map[string]smv1alpha1.SecretKeyReference{
+					"vault.secret-id": {Name: "vault-approle", Namespace: "other", Key: "secret_id"},
+				},
+			}
+
+			// when:
+			flags, err := storeReconciler(false).storeFlags(context.Background(), "default", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			Expect(flags).To(Equal(map[string]string{"vault.auth-method": "approle", "vault.role-id": "role", "vault.secret-id": "s3cr3t"}))
+
+			// when:
+			spec.ConfigFrom["vault.secret-id"] = smv1alpha1.SecretKeyReference{Name: "vault-approle", Key: "not-found"}
+			_, err = storeReconciler(false).storeFlags(context.Background(), "default", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Refuses local backends and files in SecretStores", func() {
+			// given:
+			spec := smv1alpha1.SecretStoreSpec{Backend: "file", Config: map[string]string{"file.root": "/"}}
+
+			// when:
+			_, err := storeReconciler(false).storeFlags(context.Background(), "default", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+
+			// when:
+			_, err = storeReconciler(true).storeFlags(context.Background(), "", spec)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+
+			// when:
+			spec = smv1alpha1.SecretStoreSpec{Backend: "gcp-sm", Config: map[string]string{"gcp-sm.credentials-file": "/etc/key.json"}}
+			_, err = storeReconciler(false).storeFlags(context.Background(), "default", spec)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Only allows SecretStores to authenticate with their own credentials", func() {
+			for _, config := range []map[string]string{
+				{"vault.url": "https://vault.example.com"},
+				{"vault.auth-method": "kubernetes", "vault.kubernetes-role": "app"},
+				{"vault.auth-method": "jwt", "vault.jwt-role": "app"},
+				{"vault.auth-method": "approle", "vault.ca-cert": "/etc/ssl/ca.pem"},
+				{"vault.auth-method": "approle", "vault.client-key": "/etc/ssl/key.pem"},
+				{"vault.auth-method": "approle", "vault.identity-service-account": "secrets-reader"},
+			} {
+				// when:
+				_, err := storeReconciler(false).storeFlags(context.Background(), "default", smv1alpha1.SecretStoreSpec{Backend: "vault", Config: config})
+
+				// then:
+				Expect(err).To(HaveOccurred(), "%v", config)
+
+				// when:
+				_, err = storeReconciler(true).storeFlags(context.Background(), "", smv1alpha1.SecretStoreSpec{Backend: "vault", Config: config})
+
+				// then:
+				Expect(err).ToNot(HaveOccurred(), "%v", config)
+			}
+
+			for backendType, config := range map[string]map[string]string{
+				"azure-kv": {"azure-kv.name": "team"},
+				"aws-sm":   {"aws-sm.auth-method": "instance-profile"},
+				"gcp-sm":   {"gcp-sm.auth-method": "workload-identity"},
+			} {
+				// when:
+				_, err := storeReconciler(false).storeFlags(context.Background(), "default", smv1alpha1.SecretStoreSpec{Backend: backendType, Config: config})
+
+				// then:
+				Expect(err).To(HaveOccurred(), backendType)
+			}
+
+			// when:
+			_, err := storeReconciler(false).storeFlags(context.Background(), "default", smv1alpha1.SecretStoreSpec{
+				Backend: "azure-kv",
+				Config: map[string]string{
+					"azure-kv.name":          "team",
+					"azure-kv.auth-method":   "client-secret",
+					"azure-kv.tenant-id":     "tenant",
+					"azure-kv.client-id":     "client",
+					"azure-kv.client-secret": "s3cr3t",
+				},
+			})
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("SecretStoreReconciler.Reconcile", func() {
+
+		It("Registers the store backend and reports it ready", func() {
+			// given:
+			root, err := ioutil.TempDir("", "secretstore")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(root)
+			Expect(ioutil.WriteFile(root+"/password", []byte("p4ssw0rd"), 0600)).To(Succeed())
+
+			store := &smv1alpha1.ClusterSecretStore{
+				ObjectMeta: metav1.ObjectMeta{Name: "files"},
+				Spec: smv1alpha1.SecretStoreSpec{
+					Backend: "file",
+					Config:  map[string]string{"file.root": root},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), store)).To(Succeed())
+			r2 := storeReconciler(true)
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "files"}}
+
+			// when:
+			_, err = r2.Reconcile(context.Background(), req)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			backendClient, err := r2.Backends.Get("ClusterSecretStore/files")
+			Expect(err).ToNot(HaveOccurred())
+			value, err := backendClient.ReadSecret("password", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal("p4ssw0rd"))
+
+			Expect(k8sClient.Get(context.Background(), req.NamespacedName, store)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(store.Status.Conditions, smv1alpha1.SecretStoreReady)).To(BeTrue())
+
+			// when:
+			Expect(k8sClient.Delete(context.Background(), store)).To(Succeed())
+			_, err = r2.Reconcile(context.Background(), req)
+
+			// then:
+			Expect(err).ToNot(HaveOccurred())
+			_, err = r2.Backends.Get("ClusterSecretStore/files")
+			Expect(errors.IsBackendNotFound(err)).To(BeTrue())
+		})
+
+		It("Reports the store not ready if the backend can't be built", func() {
+			// given:
+			store := &smv1alpha1.SecretStore{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "not-supported"},
+				Spec:       smv1alpha1.SecretStoreSpec{Backend: "not-supported"},
+			}
+			Expect(k8sClient.Create(context.Background(), store)).To(Succeed())
+			defer k8sClient.Delete(context.Background(), store)
+			r2 := storeReconciler(false)
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "not-supported"}}
+
+			// when:
+			_, err := r2.Reconcile(context.Background(), req)
+
+			// then:
+			Expect(err).To(HaveOccurred())
+			Expect(k8sClient.Get(context.Background(), req.NamespacedName, store)).To(Succeed())
+			condition := meta.FindStatusCondition(store.Status.Conditions, smv1alpha1.SecretStoreReady)
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(storeErrorReason))
+		})
+	})
+})
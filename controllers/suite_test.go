@@ -18,7 +18,9 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,11 +28,14 @@ import (
 	. "github.com/onsi/gomega"
 
 	secretsmanagerv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
+	"github.com/tuenti/secrets-manager/backend"
+	smerrors "github.com/tuenti/secrets-manager/errors"
 	"k8s.io/client-go/rest"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
@@ -72,10 +77,169 @@ func (f fakeBackend) ReadSecret(path string, key string) (string, error) {
 			return fakeSecret.Content, nil
 		}
 	}
-	return "", errors.New("Not found")
+	return "", &smerrors.BackendSecretNotFoundError{ErrType: smerrors.BackendSecretNotFoundErrorType, Path: path, Key: key}
 
 }
 
+type fakeSourceBackend struct {
+	fakeBackend
+}
+
+func (f fakeSourceBackend) SourceSecret(path string) (types.NamespacedName, error) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return types.NamespacedName{}, errors.New("Invalid path")
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+type fakeVersionedBackend struct {
+	fakeBackend
+	latestVersion string
+}
+
+func (f fakeVersionedBackend) ReadSecretVersion(path string, key string, version string) (string, string, error) {
+	if version == "" {
+		version = f.latestVersion
+	}
+	value, err := f.ReadSecret(path, key)
+	return value, version, err
+}
+
+type fakeLeasedBackendState struct {
+	issued        int
+	renewed       int
+	revoked       []string
+	maxTTLReached bool
+}
+
+type fakeLeasedBackend struct {
+	fakeBackend
+	data     map[string]string
+	duration time.Duration
+	state    *fakeLeasedBackendState
+}
+
+func newFakeLeasedBackend(data map[string]string, duration time.Duration) fakeLeasedBackend {
+	return fakeLeasedBackend{data: data, duration: duration, state: &fakeLeasedBackendState{}}
+}
+
+func (f fakeLeasedBackend) IsLeased(path string) bool {
+	return strings.Contains(path, "/creds/")
+}
+
+func (f fakeLeasedBackend) ReadLeasedSecret(path string) (map[string]string, backend.Lease, error) {
+	f.state.issued++
+	lease := backend.Lease{ID: fmt.Sprintf("%s/lease-%d", path, f.state.issued), Duration: f.duration, Renewable: true}
+	return f.data, lease, nil
+}
+
+func (f fakeLeasedBackend) RenewLease(lease backend.Lease) (backend.Lease, error) {
+	f.state.renewed++
+	if f.state.maxTTLReached {
+		lease.Duration = time.Minute
+	}
+	return lease, nil
+}
+
+func (f fakeLeasedBackend) RevokeLease(lease backend.Lease) error {
+	f.state.revoked = append(f.state.revoked, lease.ID)
+	return nil
+}
+
+type fakeCertificateBackend struct {
+	fakeBackend
+	issued *int
+}
+
+func (f fakeCertificateBackend) IssueCertificate(request backend.CertificateRequest) (backend.Certificate, error) {
+	*f.issued++
+	now := time.Now().Truncate(time.Second)
+	return backend.Certificate{
+		Certificate:  fmt.Sprintf("certificate-%d for %s", *f.issued, request.CommonName),
+		PrivateKey:   fmt.Sprintf("key-%d", *f.issued),
+		CA:           "ca",
+		SerialNumber: fmt.Sprintf("%x", *f.issued),
+		NotBefore:    now,
+		NotAfter:     now.Add(request.TTL),
+	}, nil
+}
+
+type fakeTransitBackend struct {
+	fakeBackend
+}
+
+// Decrypt "decrypts" the ciphertexts of the fake transit key, which are the reversed plaintext
+func (f fakeTransitBackend) Decrypt(mount string, key string, ciphertext string) ([]byte, error) {
+	if key != "gitops" || !strings.HasPrefix(ciphertext, "vault:v1:") {
+		return nil, errors.New("Invalid ciphertext")
+	}
+	runes := []rune(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return []byte(string(runes)), nil
+}
+
+type fakeNamespacedBackend struct {
+	fakeBackend
+}
+
+// WithNamespace returns a backend reading the secrets prefixed with the namespace
+func (f fakeNamespacedBackend) WithNamespace(namespace string) (backend.Client, error) {
+	var fakeSecrets []fakeBackendSecret
+	for _, fakeSecret := range f.fakeSecrets {
+		if strings.HasPrefix(fakeSecret.Path, namespace+"/") {
+			fakeSecrets = append(fakeSecrets, fakeBackendSecret{strings.TrimPrefix(fakeSecret.Path, namespace+"/"), fakeSecret.Key, fakeSecret.Content})
+		}
+	}
+	return newFakeBackend(fakeSecrets), nil
+}
+
+type fakeIdentityBackend struct {
+	fakeBackend
+}
+
+// ForKubernetesNamespace returns a backend only reading the secrets under the namespace path,
+// as a Vault policy of the namespace identity would
+func (f fakeIdentityBackend) ForKubernetesNamespace(namespace string) (backend.Client, error) {
+	var fakeSecrets []fakeBackendSecret
+	for _, fakeSecret := range f.fakeSecrets {
+		if strings.HasPrefix(fakeSecret.Path, "secret/data/"+namespace+"/") {
+			fakeSecrets = append(fakeSecrets, fakeSecret)
+		}
+	}
+	return newFakeBackend(fakeSecrets), nil
+}
+
+type fakeObjectBackend struct {
+	fakeBackend
+}
+
+// ReadObjectVersion reads the objects of objectType as the secrets under the object type path
+func (f fakeObjectBackend) ReadObjectVersion(objectType string, path string, key string, version string) (string, string, error) {
+	value, err := f.ReadSecret(objectType+"/"+path, key)
+	return value, "1", err
+}
+
+// fakeRotatingObjectBackend rotates its objects to a new version every time their latest version is read
+type fakeRotatingObjectBackend struct {
+	latest map[string]int
+}
+
+func (f fakeRotatingObjectBackend) ReadSecret(path string, key string) (string, error) {
+	value, _, err := f.ReadObjectVersion("", path, key, "")
+	return value, err
+}
+
+func (f fakeRotatingObjectBackend) ReadObjectVersion(objectType string, path string, key string, version string) (string, string, error) {
+	if version == "" {
+		f.latest[path]++
+		version = fmt.Sprintf("%d", f.latest[path])
+	}
+	return fmt.Sprintf("%s-%s", key, version), version, nil
+}
+
 func getReconciler() *SecretDefinitionReconciler {
 	return r
 }
@@ -137,9 +301,9 @@ var _ = BeforeSuite(func(done Done) {
 	}
 
 	r = &SecretDefinitionReconciler{
-		Backend: newFakeBackend([]fakeBackendSecret{
+		Backends: backend.NewRegistry(newFakeBackend([]fakeBackendSecret{
 			{"secret/data/pathtosecret1", "value", "bG9yZW0gaXBzdW0gZG9ybWEK"},
-		}),
+		})),
 		Client:               k8sClient,
 		APIReader:            k8sClient,
 		ReconciliationPeriod: 1 * time.Second,
@@ -6,8 +6,12 @@ import "fmt"
 const (
 	UnknownErrorType                   = "UnknownError"
 	BackendNotImplementedErrorType     = "BackendNotImplementedError"
+	BackendNotFoundErrorType           = "BackendNotFoundError"
 	BackendSecretNotFoundErrorType     = "BackendSecretNotFoundError"
 	BackendSecretForbiddenErrorType    = "BackendSecretForbiddenError"
+	SecretVersionNotSupportedErrorType = "SecretVersionNotSupportedError"
+	NamespaceNotSupportedErrorType     = "NamespaceNotSupportedError"
+	ObjectTypeNotSupportedErrorType    = "ObjectTypeNotSupportedError"
 	K8sSecretNotFoundErrorType         = "K8sSecretNotFoundError"
 	EncodingNotImplementedErrorType    = "EncodingNotImplementedError"
 	VaultEngineNotImplementedErrorType = "VaultEngineNotImplementedError"
@@ -20,6 +24,12 @@ type BackendNotImplementedError struct {
 	Backend string
 }
 
+// BackendNotFoundError will be raised if no backend is configured with the selected name
+type BackendNotFoundError struct {
+	ErrType string
+	Backend string
+}
+
 // BackendSecretNotFoundError will be raised if secret is not found in the selected backend
 type BackendSecretNotFoundError struct {
 	ErrType string
@@ -27,6 +37,32 @@ type BackendSecretNotFoundError struct {
 	Key     string
 }
 
+// BackendSecretForbiddenError will be raised if access to the secret is denied by the selected backend
+type BackendSecretForbiddenError struct {
+	ErrType string
+	Path    string
+	Key     string
+}
+
+// SecretVersionNotSupportedError will be raised if a secret version is requested from a backend without versions
+type SecretVersionNotSupportedError struct {
+	ErrType string
+	Backend string
+}
+
+// NamespaceNotSupportedError will be raised if a secret is read from a namespace of a backend without namespaces
+type NamespaceNotSupportedError struct {
+	ErrType string
+	Backend string
+}
+
+// ObjectTypeNotSupportedError will be raised if an object other than a secret is read from a backend only keeping secrets
+type ObjectTypeNotSupportedError struct {
+	ErrType    string
+	Backend    string
+	ObjectType string
+}
+
 // K8sSecretNotFoundError will be raised if secret is not found by its name in the given namespace
 type K8sSecretNotFoundError struct {
 	ErrType   string
@@ -55,8 +91,18 @@ func getErrorType(err error) string {
 	switch err.(type) {
 	case *BackendNotImplementedError:
 		return BackendNotImplementedErrorType
+	case *BackendNotFoundError:
+		return BackendNotFoundErrorType
 	case *BackendSecretNotFoundError:
 		return BackendSecretNotFoundErrorType
+	case *BackendSecretForbiddenError:
+		return BackendSecretForbiddenErrorType
+	case *SecretVersionNotSupportedError:
+		return SecretVersionNotSupportedErrorType
+	case *NamespaceNotSupportedError:
+		return NamespaceNotSupportedErrorType
+	case *ObjectTypeNotSupportedError:
+		return ObjectTypeNotSupportedErrorType
 	case *K8sSecretNotFoundError:
 		return K8sSecretNotFoundErrorType
 	case *EncodingNotImplementedError:
@@ -74,10 +120,30 @@ func (e BackendNotImplementedError) Error() string {
 	return fmt.Sprintf("[%s] backend %s not supported", e.ErrType, e.Backend)
 }
 
+func (e BackendNotFoundError) Error() string {
+	return fmt.Sprintf("[%s] backend %s not configured", e.ErrType, e.Backend)
+}
+
 func (e BackendSecretNotFoundError) Error() string {
 	return fmt.Sprintf("[%s] secret key %s not found at %s", e.ErrType, e.Key, e.Path)
 }
 
+func (e BackendSecretForbiddenError) Error() string {
+	return fmt.Sprintf("[%s] access to secret key %s at %s forbidden", e.ErrType, e.Key, e.Path)
+}
+
+func (e SecretVersionNotSupportedError) Error() string {
+	return fmt.Sprintf("[%s] backend %s does not support secret versions", e.ErrType, e.Backend)
+}
+
+func (e NamespaceNotSupportedError) Error() string {
+	return fmt.Sprintf("[%s] backend %s does not support namespaces", e.ErrType, e.Backend)
+}
+
+func (e ObjectTypeNotSupportedError) Error() string {
+	return fmt.Sprintf("[%s] backend %s does not support %s objects", e.ErrType, e.Backend, e.ObjectType)
+}
+
 func (e K8sSecretNotFoundError) Error() string {
 	return fmt.Sprintf("[%s] secret '%s/%s' not found", e.ErrType, e.Namespace, e.Name)
 }
@@ -99,11 +165,36 @@ func IsBackendNotImplemented(err error) bool {
 	return getErrorType(err) == BackendNotImplementedErrorType
 }
 
+// IsBackendNotFound returns true if the error is type of BackendNotFoundError and false otherwise
+func IsBackendNotFound(err error) bool {
+	return getErrorType(err) == BackendNotFoundErrorType
+}
+
 // IsBackendSecretNotFound returns true if the error is type of BackendSecretNotFound and false otherwise
 func IsBackendSecretNotFound(err error) bool {
 	return getErrorType(err) == BackendSecretNotFoundErrorType
 }
 
+// IsBackendSecretForbidden returns true if the error is type of BackendSecretForbiddenError and false otherwise
+func IsBackendSecretForbidden(err error) bool {
+	return getErrorType(err) == BackendSecretForbiddenErrorType
+}
+
+// IsSecretVersionNotSupported returns true if the error is type of SecretVersionNotSupportedError and false otherwise
+func IsSecretVersionNotSupported(err error) bool {
+	return getErrorType(err) == SecretVersionNotSupportedErrorType
+}
+
+// IsNamespaceNotSupported returns true if the error is type of NamespaceNotSupportedError and false otherwise
+func IsNamespaceNotSupported(err error) bool {
+	return getErrorType(err) == NamespaceNotSupportedErrorType
+}
+
+// IsObjectTypeNotSupported returns true if the error is type of ObjectTypeNotSupportedError and false otherwise
+func IsObjectTypeNotSupported(err error) bool {
+	return getErrorType(err) == ObjectTypeNotSupportedErrorType
+}
+
 // IsK8sSecretNotFound returns true if the error is type of K8sSecretNotFound and false otherwise
 func IsK8sSecretNotFound(err error) bool {
 	return getErrorType(err) == K8sSecretNotFoundErrorType
@@ -13,6 +13,8 @@ func TestErrorString(t *testing.T) {
 	assert.EqualError(t, err1, fmt.Sprintf("[%s] backend %s not supported", err1.ErrType, err1.Backend))
 	err2 := &BackendSecretNotFoundError{ErrType: BackendSecretNotFoundErrorType, Path: "foo", Key: "bar"}
 	assert.EqualError(t, err2, fmt.Sprintf("[%s] secret key %s not found at %s", err2.ErrType, err2.Key, err2.Path))
+	err4 := &BackendSecretForbiddenError{ErrType: BackendSecretForbiddenErrorType, Path: "foo", Key: "bar"}
+	assert.EqualError(t, err4, fmt.Sprintf("[%s] access to secret key %s at %s forbidden", err4.ErrType, err4.Key, err4.Path))
 	err3 := &K8sSecretNotFoundError{ErrType: K8sSecretNotFoundErrorType, Name: "foo", Namespace: "bar"}
 	assert.EqualError(t, err3, fmt.Sprintf("[%s] secret '%s/%s' not found", err3.ErrType, err3.Namespace, err3.Name))
 	err5 := &EncodingNotImplementedError{ErrType: EncodingNotImplementedErrorType, Encoding: "foo"}
@@ -21,6 +23,14 @@ func TestErrorString(t *testing.T) {
 	assert.EqualError(t, err6, fmt.Sprintf("[%s] vault engine %s not supported", err6.ErrType, err6.Engine))
 	err7 := &VaultTokenNotRenewableError{ErrType: VaultTokenNotRenewableErrorType}
 	assert.EqualError(t, err7, fmt.Sprintf("[%s] vault token not renewable", err7.ErrType))
+	err8 := &BackendNotFoundError{ErrType: BackendNotFoundErrorType, Backend: "foo"}
+	assert.EqualError(t, err8, fmt.Sprintf("[%s] backend %s not configured", err8.ErrType, err8.Backend))
+	err9 := &SecretVersionNotSupportedError{ErrType: SecretVersionNotSupportedErrorType, Backend: "foo"}
+	assert.EqualError(t, err9, fmt.Sprintf("[%s] backend %s does not support secret versions", err9.ErrType, err9.Backend))
+	err10 := &NamespaceNotSupportedError{ErrType: NamespaceNotSupportedErrorType, Backend: "foo"}
+	assert.EqualError(t, err10, fmt.Sprintf("[%s] backend %s does not support namespaces", err10.ErrType, err10.Backend))
+	err11 := &ObjectTypeNotSupportedError{ErrType: ObjectTypeNotSupportedErrorType, Backend: "foo", ObjectType: "certificate"}
+	assert.EqualError(t, err11, fmt.Sprintf("[%s] backend %s does not support %s objects", err11.ErrType, err11.Backend, err11.ObjectType))
 }
 
 func TestGetErrorType(t *testing.T) {
@@ -32,12 +42,22 @@ func TestGetErrorType(t *testing.T) {
 	assert.Equal(t, getErrorType(err3), BackendSecretNotFoundErrorType)
 	err4 := &K8sSecretNotFoundError{ErrType: K8sSecretNotFoundErrorType}
 	assert.Equal(t, getErrorType(err4), K8sSecretNotFoundErrorType)
+	err5 := &BackendSecretForbiddenError{ErrType: BackendSecretForbiddenErrorType}
+	assert.Equal(t, getErrorType(err5), BackendSecretForbiddenErrorType)
 	err6 := &EncodingNotImplementedError{ErrType: EncodingNotImplementedErrorType}
 	assert.Equal(t, getErrorType(err6), EncodingNotImplementedErrorType)
 	err7 := &VaultEngineNotImplementedError{ErrType: VaultEngineNotImplementedErrorType}
 	assert.Equal(t, getErrorType(err7), VaultEngineNotImplementedErrorType)
 	err8 := &VaultTokenNotRenewableError{ErrType: VaultTokenNotRenewableErrorType}
 	assert.Equal(t, getErrorType(err8), VaultTokenNotRenewableErrorType)
+	err9 := &BackendNotFoundError{ErrType: BackendNotFoundErrorType}
+	assert.Equal(t, getErrorType(err9), BackendNotFoundErrorType)
+	err10 := &SecretVersionNotSupportedError{ErrType: SecretVersionNotSupportedErrorType}
+	assert.Equal(t, getErrorType(err10), SecretVersionNotSupportedErrorType)
+	err11 := &NamespaceNotSupportedError{ErrType: NamespaceNotSupportedErrorType}
+	assert.Equal(t, getErrorType(err11), NamespaceNotSupportedErrorType)
+	err12 := &ObjectTypeNotSupportedError{ErrType: ObjectTypeNotSupportedErrorType}
+	assert.Equal(t, getErrorType(err12), ObjectTypeNotSupportedErrorType)
 }
 
 func TestIsBackendNotImplemented(t *testing.T) {
@@ -47,6 +67,13 @@ func TestIsBackendNotImplemented(t *testing.T) {
 	assert.False(t, IsBackendNotImplemented(err2))
 }
 
+func TestIsBackendNotFound(t *testing.T) {
+	err := &BackendNotFoundError{ErrType: BackendNotFoundErrorType}
+	assert.True(t, IsBackendNotFound(err))
+	err2 := e.New("foo")
+	assert.False(t, IsBackendNotFound(err2))
+}
+
 func TestIsBackendSecretNotFound(t *testing.T) {
 	err := &BackendSecretNotFoundError{ErrType: BackendSecretNotFoundErrorType}
 	assert.True(t, IsBackendSecretNotFound(err))
@@ -54,6 +81,34 @@ func TestIsBackendSecretNotFound(t *testing.T) {
 	assert.False(t, IsBackendSecretNotFound(err2))
 }
 
+func TestIsBackendSecretForbidden(t *testing.T) {
+	err := &BackendSecretForbiddenError{ErrType: BackendSecretForbiddenErrorType}
+	assert.True(t, IsBackendSecretForbidden(err))
+	err2 := e.New("foo")
+	assert.False(t, IsBackendSecretForbidden(err2))
+}
+
+func TestIsSecretVersionNotSupported(t *testing.T) {
+	err := &SecretVersionNotSupportedError{ErrType: SecretVersionNotSupportedErrorType}
+	assert.True(t, IsSecretVersionNotSupported(err))
+	err2 := e.New("foo")
+	assert.False(t, IsSecretVersionNotSupported(err2))
+}
+
+func TestIsNamespaceNotSupported(t *testing.T) {
+	err := &NamespaceNotSupportedError{ErrType: NamespaceNotSupportedErrorType}
+	assert.True(t, IsNamespaceNotSupported(err))
+	err2 := e.New("foo")
+	assert.False(t, IsNamespaceNotSupported(err2))
+}
+
+func TestIsObjectTypeNotSupported(t *testing.T) {
+	err := &ObjectTypeNotSupportedError{ErrType: ObjectTypeNotSupportedErrorType}
+	assert.True(t, IsObjectTypeNotSupported(err))
+	err2 := e.New("foo")
+	assert.False(t, IsObjectTypeNotSupported(err2))
+}
+
 func TestIsK8sSecretNotFound(t *testing.T) {
 	err := &K8sSecretNotFoundError{ErrType: K8sSecretNotFoundErrorType}
 	assert.True(t, IsK8sSecretNotFound(err))
@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
@@ -29,6 +30,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -37,6 +39,7 @@ import (
 
 	//logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
 
 	secretsmanagerv1alpha1 "github.com/tuenti/secrets-manager/api/v1alpha1"
 	"github.com/tuenti/secrets-manager/backend"
@@ -56,6 +59,13 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
+// namedBackendConfig is an additional backend, configured with the same flags as the default one
+type namedBackendConfig struct {
+	Name    string            `json:"name"`
+	Backend string            `json:"backend"`
+	Flags   map[string]string `json:"flags"`
+}
+
 // To be filled from build ldflags
 var version string
 
@@ -67,6 +77,7 @@ func main() {
 	var versionFlag bool
 	var reconcilePeriod time.Duration
 	var selectedBackend string
+	var backendsConfig string
 	var watchNamespaces string
 	var excludeNamespaces string
 	var mgr ctrl.Manager
@@ -79,28 +90,12 @@ func main() {
 	flag.StringVar(&controllerName, "controller-name", "SecretDefinition", "If running secrets manager in multiple namespaces, set the controller name to something unique avoid 'duplicate metrics collector registration attempted' errors.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&selectedBackend, "backend", "vault", "Selected backend. One of vault or azure-kv")
+	flag.StringVar(&selectedBackend, "backend", "vault", "Selected default backend, empty to only use the backends in --backends-config. One of vault, azure-kv, aws-sm, aws-ssm, gcp-sm, kubernetes, file, consul, conjur, onepassword, sops or bitwarden")
 	flag.BoolVar(&enableDebugLog, "enable-debug-log", false, "Enable this to get more logs verbosity and debug messages.")
 	flag.BoolVar(&versionFlag, "version", false, "Display Secret Manager version")
 	flag.DurationVar(&reconcilePeriod, "reconcile-period", 5*time.Second, "How often the controller will re-queue secretdefinition events")
-	flag.DurationVar(&backendCfg.BackendTimeout, "config.backend-timeout", 5*time.Second, "Backend connection timeout")
-	flag.StringVar(&backendCfg.VaultURL, "vault.url", "https://127.0.0.1:8200", "Vault address. VAULT_ADDR environment would take precedence.")
-	flag.StringVar(&backendCfg.VaultAuthMethod, "vault.auth-method", "approle", "Vault authentication method. Supported: approle, kubernetes.")
-	flag.StringVar(&backendCfg.VaultRoleID, "vault.role-id", "", "Vault approle role id. VAULT_ROLE_ID environment would take precedence.")
-	flag.StringVar(&backendCfg.VaultSecretID, "vault.secret-id", "", "Vault approle secret id. VAULT_SECRET_ID environment would take precedence.")
-	flag.StringVar(&backendCfg.VaultKubernetesRole, "vault.kubernetes-role", "", "Vault kubernetes role name.")
-	flag.Int64Var(&backendCfg.VaultMaxTokenTTL, "vault.max-token-ttl", 300, "Max seconds to consider a token expired.")
-	flag.DurationVar(&backendCfg.VaultTokenPollingPeriod, "vault.token-polling-period", 15*time.Second, "Polling interval to check token expiration time.")
-	flag.IntVar(&backendCfg.VaultRenewTTLIncrement, "vault.renew-ttl-increment", 600, "TTL time for renewed token.")
-	flag.StringVar(&backendCfg.VaultEngine, "vault.engine", "kv2", "Vault secret engine. Only KV version 1 and 2 supported")
-	flag.StringVar(&backendCfg.VaultApprolePath, "vault.approle-path", "approle", "Vault approle login path")
-	flag.StringVar(&backendCfg.VaultKubernetesPath, "vault.kubernetes-path", "kubernetes", "Vault kubernetes login path")
-	flag.StringVar(&backendCfg.AzureKVName, "azure-kv.name", "", "Azure KeyVault name. AZURE_KV_NAME environment would take precedence")
-	flag.StringVar(&backendCfg.AzureKVTenantID, "azure-kv.tenant-id", "", "Azure KeyVault Tenant ID. AZURE_TENANT_ID environment would take precedence")
-	flag.StringVar(&backendCfg.AzureKVClientID, "azure-kv.client-id", "", "Azure KeyVault ClientID used to authenticate. AZURE_CLIENT_ID environment would take precedence")
-	flag.StringVar(&backendCfg.AzureKVClientSecret, "azure-kv.client-secret", "", "Azure KeyVault Client Secret used to authenticate. AZURE_CLIENT_SECRET environment would take precedence")
-	flag.StringVar(&backendCfg.AzureKVManagedClientID, "azure-kv.managed-client-id", "", "Azure Managed Identity Client ID used to authenticate. AZURE_MANAGED_CLIENT_ID environment would take precedence")
-	flag.StringVar(&backendCfg.AzureKVManagedResourceID, "azure-kv.managed-resource-id", "", "Azure Managed Identity Resource ID used to authenticate. AZURE_MANAGED_RESOURCE_ID environment would take precedence")
+	flag.StringVar(&backendsConfig, "backends-config", "", "Path to a YAML file with additional named backends SecretDefinitions can select")
+	backend.BindFlags(flag.CommandLine, &backendCfg)
 	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated list of namespaces that secrets-manager will watch for SecretDefinitions. By default all namespaces are watched.")
 	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "", "Comma separated list of namespaces that secrets-manager will not watch for SecretDefinitions. By default all namespaces are watched.")
 
@@ -131,6 +126,30 @@ func main() {
 		backendCfg.VaultSecretID = os.Getenv("VAULT_SECRET_ID")
 	}
 
+	if os.Getenv("VAULT_NAMESPACE") != "" {
+		backendCfg.VaultNamespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	if os.Getenv("VAULT_CACERT") != "" {
+		backendCfg.VaultCACert = os.Getenv("VAULT_CACERT")
+	}
+
+	if os.Getenv("VAULT_CAPATH") != "" {
+		backendCfg.VaultCAPath = os.Getenv("VAULT_CAPATH")
+	}
+
+	if os.Getenv("VAULT_CLIENT_CERT") != "" {
+		backendCfg.VaultClientCert = os.Getenv("VAULT_CLIENT_CERT")
+	}
+
+	if os.Getenv("VAULT_CLIENT_KEY") != "" {
+		backendCfg.VaultClientKey = os.Getenv("VAULT_CLIENT_KEY")
+	}
+
+	if os.Getenv("VAULT_TLS_SERVER_NAME") != "" {
+		backendCfg.VaultTLSServerName = os.Getenv("VAULT_TLS_SERVER_NAME")
+	}
+
 	if os.Getenv("AZURE_KV_NAME") != "" {
 		backendCfg.AzureKVName = os.Getenv("AZURE_KV_NAME")
 	}
@@ -157,14 +176,128 @@ func main() {
 		backendCfg.AzureKVManagedResourceID = os.Getenv("AZURE_MANAGED_RESOURCE_ID")
 	}
 
+	if os.Getenv("AZURE_AUTHORITY_HOST") != "" {
+		backendCfg.AzureKVAuthorityHost = os.Getenv("AZURE_AUTHORITY_HOST")
+	}
+
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+		backendCfg.AzureKVFederatedTokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+	}
+
+	if os.Getenv("AZURE_CLIENT_CERTIFICATE_PATH") != "" {
+		backendCfg.AzureKVClientCertificateFile = os.Getenv("AZURE_CLIENT_CERTIFICATE_PATH")
+	}
+
+	if os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD") != "" {
+		backendCfg.AzureKVClientCertificatePassword = os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD")
+	}
+
+	// Capture the same environment variables the AWS SDK and EKS IRSA webhook use
+	if os.Getenv("AWS_REGION") != "" {
+		backendCfg.AWSSMRegion = os.Getenv("AWS_REGION")
+		backendCfg.AWSSSMRegion = os.Getenv("AWS_REGION")
+	}
+
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		backendCfg.AWSSMAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		backendCfg.AWSSSMAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+
+	if os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
+		backendCfg.AWSSMSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		backendCfg.AWSSSMSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	if os.Getenv("AWS_ROLE_ARN") != "" {
+		backendCfg.AWSSMRoleARN = os.Getenv("AWS_ROLE_ARN")
+		backendCfg.AWSSSMRoleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+
+	if os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" {
+		backendCfg.AWSSMWebIdentityTokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		backendCfg.AWSSSMWebIdentityTokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	if os.Getenv("GOOGLE_CLOUD_PROJECT") != "" {
+		backendCfg.GCPSMProject = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+
+	if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+		backendCfg.GCPSMCredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	if os.Getenv("CONSUL_HTTP_ADDR") != "" {
+		backendCfg.ConsulAddress = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+
+	if os.Getenv("CONSUL_HTTP_TOKEN") != "" {
+		backendCfg.ConsulToken = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	if os.Getenv("CONSUL_CACERT") != "" {
+		backendCfg.ConsulCAFile = os.Getenv("CONSUL_CACERT")
+	}
+
+	if os.Getenv("CONSUL_CLIENT_CERT") != "" {
+		backendCfg.ConsulClientCertFile = os.Getenv("CONSUL_CLIENT_CERT")
+	}
+
+	if os.Getenv("CONSUL_CLIENT_KEY") != "" {
+		backendCfg.ConsulClientKeyFile = os.Getenv("CONSUL_CLIENT_KEY")
+	}
+
+	if os.Getenv("CONSUL_TLS_SERVER_NAME") != "" {
+		backendCfg.ConsulTLSServerName = os.Getenv("CONSUL_TLS_SERVER_NAME")
+	}
+
+	if os.Getenv("CONJUR_APPLIANCE_URL") != "" {
+		backendCfg.ConjurURL = os.Getenv("CONJUR_APPLIANCE_URL")
+	}
+
+	if os.Getenv("CONJUR_ACCOUNT") != "" {
+		backendCfg.ConjurAccount = os.Getenv("CONJUR_ACCOUNT")
+	}
+
+	if os.Getenv("CONJUR_AUTHN_LOGIN") != "" {
+		backendCfg.ConjurLogin = os.Getenv("CONJUR_AUTHN_LOGIN")
+	}
+
+	if os.Getenv("CONJUR_AUTHN_API_KEY") != "" {
+		backendCfg.ConjurAPIKey = os.Getenv("CONJUR_AUTHN_API_KEY")
+	}
+
+	if os.Getenv("CONJUR_AUTHN_JWT_SERVICE_ID") != "" {
+		backendCfg.ConjurJWTServiceID = os.Getenv("CONJUR_AUTHN_JWT_SERVICE_ID")
+	}
+
+	if os.Getenv("JWT_TOKEN_PATH") != "" {
+		backendCfg.ConjurJWTTokenFile = os.Getenv("JWT_TOKEN_PATH")
+	}
+
+	if os.Getenv("CONJUR_CERT_FILE") != "" {
+		backendCfg.ConjurCAFile = os.Getenv("CONJUR_CERT_FILE")
+	}
+
+	if os.Getenv("OP_CONNECT_HOST") != "" {
+		backendCfg.OnePasswordURL = os.Getenv("OP_CONNECT_HOST")
+	}
+
+	if os.Getenv("OP_CONNECT_TOKEN") != "" {
+		backendCfg.OnePasswordToken = os.Getenv("OP_CONNECT_TOKEN")
+	}
+
+	if os.Getenv("SOPS_AGE_KEY_FILE") != "" {
+		backendCfg.SopsAgeKeyFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+
+	if os.Getenv("BWS_ACCESS_TOKEN") != "" {
+		backendCfg.BitwardenAccessToken = os.Getenv("BWS_ACCESS_TOKEN")
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	backendClient, err := backend.NewBackendClient(ctx, selectedBackend, backendLog, backendCfg)
-	if err != nil {
-		setupLog.Error(err, "could not build backend client")
-		os.Exit(1)
-	}
+	var err error
 
 	nsSlice := func(ns string) []string {
 		trimmed := strings.Trim(strings.TrimSpace(ns), "\"")
@@ -208,9 +341,37 @@ func main() {
 		}
 	}
 
+	// The kubernetes backend reads source Secrets through the manager client
+	backendCfg.KubernetesReader = mgr.GetClient()
+	// Vault requests tokens of namespace service accounts to read secrets with their identity
+	backendCfg.KubernetesClientset, err = kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes client")
+		os.Exit(1)
+	}
+	backendCfg.ExcludeNamespaces = excludeNs
+
+	var defaultBackend backend.Client
+	if selectedBackend != "" {
+		backendClient, err := backend.NewBackendClient(ctx, selectedBackend, backendLog, backendCfg)
+		if err != nil {
+			setupLog.Error(err, "could not build backend client")
+			os.Exit(1)
+		}
+		defaultBackend = *backendClient
+	}
+	backends := backend.NewRegistry(defaultBackend)
+
+	if backendsConfig != "" {
+		if err = addNamedBackends(ctx, backends, backendsConfig, backendCfg); err != nil {
+			setupLog.Error(err, "could not build named backend clients", "backends_config", backendsConfig)
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.SecretDefinitionReconciler{
 		Client:               mgr.GetClient(),
-		Backend:              *backendClient,
+		Backends:             backends,
 		APIReader:            mgr.GetAPIReader(),
 		Log:                  ctrl.Log.WithName("controllers").WithName("SecretDefinition"),
 		ReconciliationPeriod: reconcilePeriod,
@@ -219,6 +380,39 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "SecretDefinition")
 		os.Exit(1)
 	}
+	if err = (&controllers.SecretStoreReconciler{
+		Client:               mgr.GetClient(),
+		Backends:             backends,
+		BackendConfig:        backendCfg,
+		Context:              ctx,
+		APIReader:            mgr.GetAPIReader(),
+		Log:                  ctrl.Log.WithName("controllers").WithName("SecretStore"),
+		BackendLog:           backendLog,
+		ReconciliationPeriod: reconcilePeriod,
+		ExcludeNamespaces:    excludeNs,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SecretStore")
+		os.Exit(1)
+	}
+	// The cache restricted to the watched namespaces can't watch cluster scoped objects
+	if len(namespaceList) == 0 {
+		if err = (&controllers.SecretStoreReconciler{
+			Client:               mgr.GetClient(),
+			Backends:             backends,
+			BackendConfig:        backendCfg,
+			Context:              ctx,
+			APIReader:            mgr.GetAPIReader(),
+			Log:                  ctrl.Log.WithName("controllers").WithName("ClusterSecretStore"),
+			BackendLog:           backendLog,
+			ClusterScoped:        true,
+			ReconciliationPeriod: reconcilePeriod,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ClusterSecretStore")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("ClusterSecretStores are not supported when watching a restricted namespace list")
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -236,3 +430,47 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// addNamedBackends builds the backends listed in the file at path and adds them to the registry.
+// Each backend starts from the flags defaults, environment variables aren't taken into account.
+func addNamedBackends(ctx context.Context, backends *backend.Registry, path string, baseCfg backend.Config) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file := struct {
+		Backends []namedBackendConfig `json:"backends"`
+	}{}
+	if err = yaml.UnmarshalStrict(content, &file); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, named := range file.Backends {
+		if named.Name == "" {
+			return fmt.Errorf("backend without name in %s", path)
+		}
+		// Stores are registered as <kind>/<namespace>/<name>, so they can't clash with named backends
+		if strings.Contains(named.Name, "/") {
+			return fmt.Errorf("invalid backend name %s in %s, names can't contain /", named.Name, path)
+		}
+		if names[named.Name] {
+			return fmt.Errorf("duplicated backend name %s in %s", named.Name, path)
+		}
+		names[named.Name] = true
+
+		cfg, err := backend.ConfigFromFlags(baseCfg, named.Flags)
+		if err != nil {
+			return fmt.Errorf("could not configure backend %s: %v", named.Name, err)
+		}
+
+		logger := ctrl.Log.WithName("backend").WithName(named.Name)
+		client, err := backend.NewBackendClient(ctx, named.Backend, logger, cfg)
+		if err != nil {
+			return fmt.Errorf("could not build backend %s: %v", named.Name, err)
+		}
+		backends.Add(named.Name, *client)
+		setupLog.Info("named backend ready", "name", named.Name, "backend", named.Backend)
+	}
+	return nil
+}